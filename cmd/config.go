@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/mxdc/nrc2strava/utils"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// appName prefixes the environment variables, e.g. NRC2STRAVA_NRC_TOKEN for --nrc.token
+	appName = "nrc2strava"
+
+	// configEnvar overrides the location of the config file
+	configEnvar = "NRC2STRAVA_CONFIG"
+)
+
+// defaultConfigPath returns ~/.config/nrc2strava/config.yaml, or its location under $XDG_CONFIG_HOME
+func defaultConfigPath() string {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if len(configDir) == 0 {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		configDir = filepath.Join(homeDir, ".config")
+	}
+
+	return filepath.Join(configDir, appName, "config.yaml")
+}
+
+// loadConfig reads the config file and sets its values as the defaults of the flags.
+// The top level keys are application flag names, or flag names applied to every command having the flag,
+// a command name key holds the flags of this command only and takes precedence.
+// Values given on the command line or in the environment still take precedence over the file.
+func loadConfig(app *kingpin.Application) error {
+	configPath, explicit := os.LookupEnv(configEnvar)
+	if !explicit {
+		configPath = defaultConfigPath()
+	}
+
+	if len(configPath) == 0 {
+		return nil
+	}
+
+	data, err := os.ReadFile(configPath)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+
+	config := map[string]any{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("error parsing config file %s: %w", configPath, err)
+	}
+
+	commandSections := map[string]map[string]any{}
+	globalValues := map[string]any{}
+	for key, value := range config {
+		section, isMap := value.(map[string]any)
+		if isMap && app.GetCommand(key) != nil {
+			commandSections[key] = section
+			continue
+		}
+		globalValues[key] = value
+	}
+
+	// Global values first, so the command sections override them
+	for name, value := range globalValues {
+		// The application flags, such as the log level, are shared by every command
+		if flag := app.GetFlag(name); flag != nil {
+			setFlagDefault(flag, value)
+			continue
+		}
+
+		found := false
+		for _, command := range app.Model().Commands {
+			flag := app.GetCommand(command.Name).GetFlag(name)
+			if flag == nil {
+				continue
+			}
+
+			found = true
+			setFlagDefault(flag, value)
+		}
+
+		if !found {
+			return fmt.Errorf("error in config file %s: unknown flag %q", configPath, name)
+		}
+	}
+
+	for commandName, section := range commandSections {
+		command := app.GetCommand(commandName)
+		for name, value := range section {
+			flag := command.GetFlag(name)
+			if flag == nil {
+				return fmt.Errorf("error in config file %s: unknown flag %q of command %s", configPath, name, commandName)
+			}
+
+			setFlagDefault(flag, value)
+		}
+	}
+
+	return nil
+}
+
+// setFlagDefault sets the config value as the default of the flag,
+// a mapping is turned into key=value defaults and a list into repeated defaults
+func setFlagDefault(flag *kingpin.FlagClause, value any) {
+	switch typedValue := value.(type) {
+	case nil:
+		return
+	case map[string]any:
+		keys := make([]string, 0, len(typedValue))
+		for key := range typedValue {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		defaults := make([]string, 0, len(keys))
+		for _, key := range keys {
+			defaults = append(defaults, fmt.Sprintf("%s=%v", key, typedValue[key]))
+		}
+		flag.Default(defaults...)
+	case []any:
+		defaults := make([]string, 0, len(typedValue))
+		for _, item := range typedValue {
+			defaults = append(defaults, fmt.Sprint(item))
+		}
+		flag.Default(defaults...)
+	default:
+		flag.Default(fmt.Sprint(typedValue))
+	}
+}
+
+// resolveToken returns the token, or reads it from the token file when the token is empty.
+// A "-" token file reads the token from the standard input.
+// A missing or unreadable token wraps utils.ErrUnauthorized.
+func resolveToken(token, tokenFile string) (string, error) {
+	if len(token) > 0 {
+		return token, nil
+	}
+	if len(tokenFile) == 0 {
+		return "", fmt.Errorf("missing token, give the token or its token file: %w", utils.ErrUnauthorized)
+	}
+
+	var data []byte
+	var err error
+	if tokenFile == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(expandHome(tokenFile))
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading token: %w: %w", err, utils.ErrUnauthorized)
+	}
+
+	token = strings.TrimSpace(string(data))
+	if len(token) == 0 {
+		return "", fmt.Errorf("empty token file %s: %w", tokenFile, utils.ErrUnauthorized)
+	}
+
+	return token, nil
+}
+
+// expandHome replaces the leading ~ of the path by the home directory, the shell doesn't expand it in the config file
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(homeDir, path[2:])
+}
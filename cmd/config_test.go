@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/mxdc/nrc2strava/report"
+	"github.com/mxdc/nrc2strava/utils"
+)
+
+// writeConfig writes the config file and points NRC2STRAVA_CONFIG to it
+func writeConfig(t *testing.T, content string) {
+	t.Helper()
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("error writing config file: %v", err)
+	}
+	t.Setenv(configEnvar, configPath)
+}
+
+func TestLoadConfig(t *testing.T) {
+	writeConfig(t, `
+log.level: debug
+http.connect-timeout: 5s
+http.read-timeout: 20s
+http.timeout: 10s
+fit.dir: ./shared
+convert:
+  fit.dir: ./converted
+`)
+
+	app := kingpin.New(appName, "")
+	level := app.Flag("log.level", "").Default("info").String()
+	connectTimeout := app.Flag("http.connect-timeout", "").Default("10s").Duration()
+	readTimeout := app.Flag("http.read-timeout", "").Default("30s").Duration()
+	timeout := app.Flag("http.timeout", "").Default("0s").Duration()
+	convert := app.Command("convert", "")
+	convertDir := convert.Flag("fit.dir", "").Default("./output").String()
+	upload := app.Command("upload", "")
+	uploadDir := upload.Flag("fit.dir", "").Default("").String()
+
+	if err := loadConfig(app); err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if _, err := app.Parse([]string{"convert"}); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if *level != "debug" {
+		t.Errorf("log.level = %q, want the application flag set by the config", *level)
+	}
+	// The shared timeouts of the scheduled runs
+	if *connectTimeout != 5*time.Second || *readTimeout != 20*time.Second || *timeout != 10*time.Second {
+		t.Errorf("http timeouts = %s, %s, %s, want 5s, 20s, 10s", *connectTimeout, *readTimeout, *timeout)
+	}
+	if *convertDir != "./converted" {
+		t.Errorf("convert fit.dir = %q, want the command section value", *convertDir)
+	}
+	if _, err := app.Parse([]string{"upload"}); err != nil || *uploadDir != "./shared" {
+		t.Errorf("upload fit.dir = %q, %v, want the top level value", *uploadDir, err)
+	}
+}
+
+func TestLoadConfigUnknownFlag(t *testing.T) {
+	writeConfig(t, "unknown.flag: 1\n")
+
+	app := kingpin.New(appName, "")
+	app.Command("convert", "")
+
+	if err := loadConfig(app); err == nil {
+		t.Errorf("loadConfig() of an unknown flag returned no error")
+	}
+}
+
+func TestResolveToken(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	emptyFile := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyFile, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		tokenFile string
+		want      string
+	}{
+		{"token", "flag-token", tokenFile, "flag-token"},
+		{"token file", "", tokenFile, "file-token"},
+		{"missing", "", "", ""},
+		{"unreadable file", "", filepath.Join(dir, "missing"), ""},
+		{"empty file", "", emptyFile, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := resolveToken(tt.token, tt.tokenFile)
+			if token != tt.want {
+				t.Errorf("resolveToken() = %q, want %q", token, tt.want)
+			}
+
+			// A missing token exits with the authentication code
+			if len(tt.want) == 0 && (!errors.Is(err, utils.ErrUnauthorized) || exitCode(err, report.NewReport("")) != exitAuth) {
+				t.Errorf("resolveToken() error = %v, want an authentication failure", err)
+			}
+			if len(tt.want) > 0 && err != nil {
+				t.Errorf("resolveToken() error = %v", err)
+			}
+		})
+	}
+}
@@ -1,125 +1,492 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	kingpin "github.com/alecthomas/kingpin/v2"
 	"github.com/mxdc/nrc2strava/converter"
+	"github.com/mxdc/nrc2strava/dem"
 	"github.com/mxdc/nrc2strava/fit"
 	"github.com/mxdc/nrc2strava/migrator"
 	"github.com/mxdc/nrc2strava/nrc"
 	"github.com/mxdc/nrc2strava/parser"
+	"github.com/mxdc/nrc2strava/reconciler"
+	"github.com/mxdc/nrc2strava/records"
+	"github.com/mxdc/nrc2strava/report"
 	"github.com/mxdc/nrc2strava/strava"
 	"github.com/mxdc/nrc2strava/utils"
-	"github.com/sirupsen/logrus"
 )
 
 var (
+	// global
+	logLevel   = kingpin.Flag("log.level", "Log level").Default("info").Enum("trace", "debug", "info", "warn", "error")
+	logFormat  = kingpin.Flag("log.format", "Log format").Default(utils.LogFormatText).Enum(utils.LogFormatText, utils.LogFormatJSON)
+	reportFile = kingpin.Flag("report.file", "Write a JSON report of the processed, skipped and failed activities to this file, - for stdout").Default("").String()
+
 	// migrate
-	migrate               = kingpin.Command("migrate", "Migrate NRC activities to Strava.")
-	migrateToken          = migrate.Flag("nrc.token", "NRC access token").Default("").String()
-	migrateActivityDir    = migrate.Flag("fit.dir", "FIT activities directory").Default("").String()
-	migrateStrava4Session = migrate.Flag("strava.token", "Strava session token").Default("").String()
+	migrate                = kingpin.Command("migrate", "Migrate NRC activities to Strava.")
+	migrateToken           = migrate.Flag("nrc.token", "NRC access token").Default("").String()
+	migrateTokenFile       = migrate.Flag("nrc.token-file", "File containing the NRC access token, - for stdin").Default("").String()
+	migrateApiURL          = migrate.Flag("nrc.api-url", "NRC API base URL").Default(nrc.DefaultBaseURL).String()
+	migrateActivityDir     = migrate.Flag("fit.dir", "FIT activities directory").Default("").String()
+	migrateStrava4Session  = migrate.Flag("strava.token", "Strava session token").Default("").String()
+	migrateStravaTokenFile = migrate.Flag("strava.token-file", "File containing the Strava session token, - for stdin").Default("").String()
+	migrateStravaURL       = migrate.Flag("strava.url", "Strava website base URL").Default(strava.DefaultBaseURL).String()
+	migrateGearMapping     = migrate.Flag("strava.gear", "Strava gear ID of a NRC shoe ID or name (shoe=gear)").StringMap()
+	migrateConversionFlags = addConversionFlags(migrate)
 
 	// download
 	download              = kingpin.Command("download", "Download NRC activities.")
 	downloadActivitiesDir = download.Flag("activities.dir", "Downloaded NRC activities directory").Default("./downloaded").String()
 	downloadToken         = download.Flag("nrc.token", "NRC access token").Default("").String()
+	downloadTokenFile     = download.Flag("nrc.token-file", "File containing the NRC access token, - for stdin").Default("").String()
+	downloadApiURL        = download.Flag("nrc.api-url", "NRC API base URL").Default(nrc.DefaultBaseURL).String()
 
 	// strava-download
 	stravaDownload              = kingpin.Command("strava-download", "Download Strava activities.")
 	stravaDownloadActivitiesDir = stravaDownload.Flag("activities.dir", "Downloaded Strava activities directory").Default("./strava-downloaded").String()
 	stravaDownloadToken         = stravaDownload.Flag("strava.token", "Strava session token").Default("").String()
+	stravaDownloadTokenFile     = stravaDownload.Flag("strava.token-file", "File containing the Strava session token, - for stdin").Default("").String()
+	stravaDownloadURL           = stravaDownload.Flag("strava.url", "Strava website base URL").Default(strava.DefaultBaseURL).String()
 
 	// convert
 	convert          = kingpin.Command("convert", "Convert NRC activities into FIT activities.")
 	nrcActivitiesDir = convert.Flag("activities.dir", "Downloaded NRC activities directory").Default("").String()
 	nrcActivityFile  = convert.Flag("activity.file", "Downloaded NRC Activity file").Default("").String()
 	outputDir        = convert.Flag("fit.dir", "FIT Activities output directory").Default("./output").String()
+	converterFlags   = addConversionFlags(convert)
 
 	// upload
 	upload                = kingpin.Command("upload", "Upload FIT activities to Strava.")
 	uploadStrava4Session  = upload.Flag("strava.token", "Strava session token").Default("").String()
+	uploadStravaTokenFile = upload.Flag("strava.token-file", "File containing the Strava session token, - for stdin").Default("").String()
+	uploadStravaURL       = upload.Flag("strava.url", "Strava website base URL").Default(strava.DefaultBaseURL).String()
 	uploadFitActivityFile = upload.Flag("fit.file", "FIT activity file").Default("").String()
 	uploadFitActivityDir  = upload.Flag("fit.dir", "FIT activities directory").Default("").String()
+	uploadGearMapping     = upload.Flag("strava.gear", "Strava gear ID of a NRC shoe ID or name (shoe=gear)").StringMap()
+
+	// validate
+	validate                = kingpin.Command("validate", "Validate FIT activities before uploading them.")
+	validateFitActivityFile = validate.Flag("fit.file", "FIT activity file").Default("").String()
+	validateFitActivityDir  = validate.Flag("fit.dir", "FIT activities directory").Default("").String()
+
+	// inspect
+	inspect                = kingpin.Command("inspect", "Print a summary of FIT activities.")
+	inspectFitActivityFile = inspect.Flag("fit.file", "FIT activity file").Default("").String()
+	inspectFitActivityDir  = inspect.Flag("fit.dir", "FIT activities directory").Default("").String()
+	inspectFormat          = inspect.Flag("format", "Output format").Default("text").Enum("text", "json")
+
+	// reconcile
+	reconcile                    = kingpin.Command("reconcile", "Compare NRC activities with the activities downloaded from Strava.")
+	reconcileNrcActivitiesDir    = reconcile.Flag("activities.dir", "Downloaded NRC activities directory").Default("./downloaded").String()
+	reconcileStravaActivitiesDir = reconcile.Flag("strava.dir", "Downloaded Strava activities directory").Default("./strava-downloaded").String()
+	reconcileFormat              = reconcile.Flag("format", "Output format").Default("text").Enum("text", "json")
+	reconcileFlags               = addConversionFlags(reconcile)
+
+	// records
+	personalRecords              = kingpin.Command("records", "List the personal records and best efforts of the NRC activities.")
+	personalRecordsActivitiesDir = personalRecords.Flag("activities.dir", "Downloaded NRC activities directory").Default("./downloaded").String()
+	personalRecordsFormat        = personalRecords.Flag("format", "Output format").Default("text").Enum("text", "json")
+	personalRecordsFlags         = addConversionFlags(personalRecords)
+
+	// http
+	httpConnectTimeout = kingpin.Flag("http.connect-timeout", "Timeout of the connection to the NRC and Strava servers").Default(utils.DefaultHTTPTimeouts.Connect.String()).Duration()
+	httpReadTimeout    = kingpin.Flag("http.read-timeout", "Timeout waiting for the response of the NRC and Strava servers").Default(utils.DefaultHTTPTimeouts.Read.String()).Duration()
+	httpTimeout        = kingpin.Flag("http.timeout", "Overall timeout of a request to the NRC and Strava servers").Default(utils.DefaultHTTPTimeouts.Total.String()).Duration()
 
 	// logger
-	logger = logrus.New()
+	logger = utils.Logger
+
+	// runReport records the outcome of the activities processed by the command
+	runReport *report.Report
+
+	// httpClient is shared by the NRC and Strava clients
+	httpClient *http.Client
 )
 
-func init() {
-	kingpin.Parse()
-	logger.SetFormatter(utils.LogFormat)
+// recordIntervalNative is the --record.interval value of the NRC sample times
+const recordIntervalNative = "native"
+
+// conversionFlags holds the conversion options shared by the commands converting the NRC activities
+type conversionFlags struct {
+	gpsMaxSpeed    *float64
+	gpsSmoothing   *string
+	gpsKalmanNoise *float64
+
+	speedSource *string
+	speedWindow *int
+
+	recordInterval *string
+
+	powerModel *string
+
+	athleteWeight           *float64
+	athleteHeight           *float64
+	athleteAge              *uint8
+	athleteSex              *string
+	athleteMaxHeartRate     *uint8
+	athleteRestingHeartRate *uint8
+
+	caloriesSource *string
+
+	heartRateZones *string
+	paceZones      *string
+
+	treadmillFactor    *float64
+	treadmillDistances *map[string]string
+
+	demDir        *string
+	demHysteresis *float64
+
+	overridesFile *string
+}
+
+// addConversionFlags registers the conversion flags on the command
+func addConversionFlags(cmd *kingpin.CmdClause) *conversionFlags {
+	return &conversionFlags{
+		gpsMaxSpeed:    cmd.Flag("gps.max-speed", "Reject GPS positions reached faster than this speed in km/h (0 to disable)").Default("0").Float64(),
+		gpsSmoothing:   cmd.Flag("gps.smoothing", "GPS track smoothing method").Default(converter.SmoothingNone).Enum(converter.SmoothingNone, converter.SmoothingKalman),
+		gpsKalmanNoise: cmd.Flag("gps.kalman-noise", "Kalman filter process noise in m/s, the higher the less smoothing").Default("3").Float64(),
+
+		speedSource: cmd.Flag("speed.source", "Source of the record speeds: NRC speed series, rolling window or per second distance").Default(converter.SpeedSourceNRC).Enum(converter.SpeedSourceNRC, converter.SpeedSourceRolling, converter.SpeedSourceDistance),
+		speedWindow: cmd.Flag("speed.window", "Rolling window in seconds used to derive the speed from the distance").Default("10").Int(),
+
+		recordInterval: cmd.Flag("record.interval", "Interval between two records, native for the NRC sample times").Default("1s").Enum("1s", "2s", "5s", recordIntervalNative),
+
+		powerModel: cmd.Flag("power.model", "Running power estimation model").Default(converter.PowerModelNone).Enum(converter.PowerModelNone, converter.PowerModelStryd, converter.PowerModelACSM),
+
+		athleteWeight:           cmd.Flag("athlete.weight", "Athlete weight in kg (0 if unknown, 70kg for the estimations)").Default("0").Float64(),
+		athleteHeight:           cmd.Flag("athlete.height", "Athlete height in cm (0 if unknown)").Default("0").Float64(),
+		athleteAge:              cmd.Flag("athlete.age", "Athlete age in years (0 if unknown)").Default("0").Uint8(),
+		athleteSex:              cmd.Flag("athlete.sex", "Athlete sex: male, female or empty if unknown").Default("").String(),
+		athleteMaxHeartRate:     cmd.Flag("athlete.max-hr", "Athlete max heart rate in bpm (0 if unknown)").Default("0").Uint8(),
+		athleteRestingHeartRate: cmd.Flag("athlete.resting-hr", "Athlete resting heart rate in bpm (0 if unknown)").Default("0").Uint8(),
+
+		caloriesSource: cmd.Flag("calories.source", "Source of the calories: NRC summary, estimated when missing, or always estimated").Default(converter.CaloriesSourceNRC).Enum(converter.CaloriesSourceNRC, converter.CaloriesSourceEstimate),
+
+		heartRateZones: cmd.Flag("zones.hr", "Comma separated lower bounds in bpm of the heart rate zones 1 to N, from the athlete max heart rate by default").Default("").String(),
+		paceZones:      cmd.Flag("zones.pace", "Comma separated lower bounds in min/km (m:ss) of the pace zones 1 to N, from the slowest").Default("").String(),
+
+		treadmillFactor:    cmd.Flag("treadmill.factor", "Factor applied to the distance of every treadmill run").Default("1").Float64(),
+		treadmillDistances: cmd.Flag("treadmill.distance", "True distance in km of a treadmill run (NRC activity ID=km)").StringMap(),
+
+		demDir:        cmd.Flag("dem.dir", "Directory of SRTM .hgt tiles used to correct the elevation").Default("").String(),
+		demHysteresis: cmd.Flag("dem.hysteresis", "Minimum altitude change in meters counted in the ascent and descent").Default("3").Float64(),
+
+		overridesFile: cmd.Flag("overrides.file", "YAML or JSON file of overrides by NRC activity ID").Default("").String(),
+	}
+}
+
+// newAthlete returns the athlete profile of the flags, the unknown values are 0
+func newAthlete(flags *conversionFlags) (converter.Athlete, error) {
+	if *flags.athleteWeight < 0 {
+		return converter.Athlete{}, fmt.Errorf("invalid athlete weight: %.1f", *flags.athleteWeight)
+	}
+	if *flags.athleteHeight < 0 {
+		return converter.Athlete{}, fmt.Errorf("invalid athlete height: %.1f", *flags.athleteHeight)
+	}
+
+	// 255 is the invalid value of the FIT age and heart rates
+	if *flags.athleteAge == 255 {
+		return converter.Athlete{}, fmt.Errorf("invalid athlete age: %d", *flags.athleteAge)
+	}
+	if *flags.athleteMaxHeartRate == 255 {
+		return converter.Athlete{}, fmt.Errorf("invalid athlete max heart rate: %d", *flags.athleteMaxHeartRate)
+	}
+	if *flags.athleteRestingHeartRate == 255 {
+		return converter.Athlete{}, fmt.Errorf("invalid athlete resting heart rate: %d", *flags.athleteRestingHeartRate)
+	}
+	if *flags.athleteMaxHeartRate > 0 && *flags.athleteRestingHeartRate >= *flags.athleteMaxHeartRate {
+		return converter.Athlete{}, fmt.Errorf("athlete resting heart rate %d is not below the max heart rate %d", *flags.athleteRestingHeartRate, *flags.athleteMaxHeartRate)
+	}
+
+	sex := strings.ToLower(*flags.athleteSex)
+	if len(sex) > 0 && sex != converter.SexMale && sex != converter.SexFemale {
+		return converter.Athlete{}, fmt.Errorf("invalid athlete sex %q, expected %s or %s", *flags.athleteSex, converter.SexMale, converter.SexFemale)
+	}
+
+	return converter.Athlete{
+		Weight:           *flags.athleteWeight,
+		Height:           *flags.athleteHeight / 100,
+		Age:              *flags.athleteAge,
+		Sex:              sex,
+		MaxHeartRate:     *flags.athleteMaxHeartRate,
+		RestingHeartRate: *flags.athleteRestingHeartRate,
+	}, nil
+}
+
+// newActivitiesConverter returns an ActivitiesConverter configured from the flags,
+// the sidecar override files are loaded from the activities directory
+func newActivitiesConverter(flags *conversionFlags, activitiesDir string) (*converter.ActivitiesConverter, error) {
+	activitiesConverter := converter.InitActivitiesConverter()
+	activitiesConverter.GPSFilter = converter.GPSFilter{
+		MaxSpeed:    *flags.gpsMaxSpeed / 3.6,
+		Smoothing:   *flags.gpsSmoothing,
+		KalmanNoise: *flags.gpsKalmanNoise,
+	}
+
+	activitiesConverter.SpeedStrategy = converter.SpeedStrategy{
+		Source: *flags.speedSource,
+		Window: *flags.speedWindow,
+	}
+
+	activitiesConverter.RecordInterval = converter.RecordIntervalNative
+	if *flags.recordInterval != recordIntervalNative {
+		interval, err := time.ParseDuration(*flags.recordInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid record interval: %w", err)
+		}
+		activitiesConverter.RecordInterval = interval
+	}
+
+	activitiesConverter.PowerModel = *flags.powerModel
+	activitiesConverter.CaloriesSource = *flags.caloriesSource
+
+	athlete, err := newAthlete(flags)
+	if err != nil {
+		return nil, err
+	}
+	activitiesConverter.Athlete = athlete
+
+	zones, err := newZones(*flags.heartRateZones, *flags.paceZones)
+	if err != nil {
+		return nil, err
+	}
+	activitiesConverter.Zones = zones
+
+	treadmillDistances := map[string]float64{}
+	for activityID, value := range *flags.treadmillDistances {
+		distance, err := strconv.ParseFloat(value, 64)
+		if err != nil || distance <= 0 {
+			return nil, fmt.Errorf("invalid treadmill distance for %s: %q", activityID, value)
+		}
+		treadmillDistances[activityID] = distance * 1000
+	}
+
+	activitiesConverter.TreadmillCalibration = converter.TreadmillCalibration{
+		Factor:    *flags.treadmillFactor,
+		Distances: treadmillDistances,
+	}
+
+	if len(*flags.demDir) > 0 {
+		activitiesConverter.ElevationModel = dem.NewHGTReader(*flags.demDir)
+		activitiesConverter.ElevationHysteresis = *flags.demHysteresis
+	}
+
+	overrides, err := parser.InitActivitiesParser(activitiesDir, "").LoadOverrides(*flags.overridesFile)
+	if err != nil {
+		return nil, err
+	}
+	activitiesConverter.Overrides = overrides
+
+	return activitiesConverter, nil
 }
 
 func main() {
+	// Every flag can be set by a NRC2STRAVA_* environment variable or in the config file
+	kingpin.CommandLine.Name = appName
+	kingpin.CommandLine.DefaultEnvars()
+	kingpin.FatalIfError(loadConfig(kingpin.CommandLine), "")
+
 	kingpin.Version("1.0.0")
-	switch kingpin.Parse() {
+	command := kingpin.Parse()
+	kingpin.FatalIfError(utils.ConfigureLogger(*logLevel, *logFormat), "")
+	if *reportFile == "-" && writesToStdout(command) {
+		kingpin.Fatalf("--report.file=- would mix the report with the output of %s, give a file", command)
+	}
+	runReport = report.NewReport(command)
+
+	httpClient = utils.NewHTTPClient(utils.HTTPTimeouts{
+		Connect: *httpConnectTimeout,
+		Read:    *httpReadTimeout,
+		Total:   *httpTimeout,
+	})
+
+	// Abort cleanly on SIGINT and SIGTERM, the report is still written
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch command {
 	case migrate.FullCommand():
-		handleMigrate(*migrateToken, *migrateStrava4Session, *migrateActivityDir)
+		err = handleMigrate(ctx, *migrateToken, *migrateTokenFile, *migrateApiURL, *migrateStrava4Session, *migrateStravaTokenFile, *migrateStravaURL, *migrateActivityDir, *migrateGearMapping, migrateConversionFlags)
 	case download.FullCommand():
-		handleDownload(*downloadActivitiesDir, *downloadToken)
+		err = handleDownload(ctx, *downloadActivitiesDir, *downloadToken, *downloadTokenFile, *downloadApiURL)
 	case convert.FullCommand():
-		handleConvert(*nrcActivitiesDir, *nrcActivityFile, *outputDir)
+		err = handleConvert(ctx, *nrcActivitiesDir, *nrcActivityFile, *outputDir, converterFlags)
 	case upload.FullCommand():
-		handleUpload(*uploadFitActivityDir, *uploadFitActivityFile, *uploadStrava4Session)
+		err = handleUpload(ctx, *uploadFitActivityDir, *uploadFitActivityFile, *uploadStrava4Session, *uploadStravaTokenFile, *uploadStravaURL, *uploadGearMapping)
 	case stravaDownload.FullCommand():
-		handleStravaDownload(*stravaDownloadActivitiesDir, *stravaDownloadToken)
+		err = handleStravaDownload(ctx, *stravaDownloadActivitiesDir, *stravaDownloadToken, *stravaDownloadTokenFile, *stravaDownloadURL)
+	case validate.FullCommand():
+		err = handleValidate(*validateFitActivityDir, *validateFitActivityFile)
+	case inspect.FullCommand():
+		err = handleInspect(*inspectFitActivityDir, *inspectFitActivityFile, *inspectFormat)
+	case reconcile.FullCommand():
+		err = handleReconcile(*reconcileNrcActivitiesDir, *reconcileStravaActivitiesDir, *reconcileFormat, reconcileFlags)
+	case personalRecords.FullCommand():
+		err = handleRecords(*personalRecordsActivitiesDir, *personalRecordsFormat, personalRecordsFlags)
 	default:
 		kingpin.Usage()
 	}
+
+	if err != nil {
+		logger.Error(err)
+		runReport.Error = err.Error()
+	}
+
+	if len(*reportFile) > 0 {
+		if err := runReport.WriteFile(*reportFile); err != nil {
+			logger.Error(err)
+		}
+	}
+
+	stop()
+	os.Exit(exitCode(err, runReport))
+}
+
+// Exit codes, so that scheduled runs can tell the failures apart
+const (
+	exitOK          = 0
+	exitFailure     = 1   // the command failed or no activity could be processed
+	exitPartial     = 2   // some activities failed
+	exitAuth        = 3   // a token is missing, invalid or expired
+	exitRateLimited = 4   // the API rate limit was reached, retry later
+	exitInterrupted = 130 // interrupted by SIGINT or SIGTERM
+)
+
+// writesToStdout reports whether the command prints its result on the standard output
+func writesToStdout(command string) bool {
+	switch command {
+	case inspect.FullCommand(), reconcile.FullCommand(), personalRecords.FullCommand():
+		return true
+	}
+	return false
 }
 
-func handleMigrate(downloadToken, strava4Session, outputDir string) {
+// exitCode returns the exit code of the command error and the activities outcome
+func exitCode(err error, runReport *report.Report) int {
+	switch {
+	case errors.Is(err, utils.ErrUnauthorized):
+		return exitAuth
+	case errors.Is(err, utils.ErrRateLimited):
+		return exitRateLimited
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case err != nil:
+		return exitFailure
+	case runReport.Failed > 0 && runReport.Processed == 0:
+		return exitFailure
+	case runReport.Failed > 0:
+		return exitPartial
+	}
+
+	return exitOK
+}
+
+func handleMigrate(ctx context.Context, nrcToken, nrcTokenFile, nrcApiURL, stravaToken, stravaTokenFile, stravaURL, outputDir string, gearMapping map[string]string, flags *conversionFlags) error {
+	downloadToken, err := resolveToken(nrcToken, nrcTokenFile)
+	if err != nil {
+		return err
+	}
+
+	strava4Session, err := resolveToken(stravaToken, stravaTokenFile)
+	if err != nil {
+		return err
+	}
+
+	activitiesConverter, err := newActivitiesConverter(flags, "")
+	if err != nil {
+		return err
+	}
+
 	nikeApi := nrc.NewNikeApi(downloadToken)
+	nikeApi.HTTPClient = httpClient
+	nikeApi.SetBaseURL(nrcApiURL)
 	stravaWeb := strava.NewStravaWeb(strava4Session)
+	stravaWeb.HTTPClient = httpClient
+	stravaWeb.SetBaseURL(stravaURL)
 	migrate := migrator.NewMigrator(nikeApi, stravaWeb, outputDir)
-	migrate.MigrateActivities()
+	migrate.GearMapping = gearMapping
+	migrate.ActivitiesConverter = activitiesConverter
+	migrate.Report = runReport
+	return migrate.MigrateActivities(ctx)
 }
 
-func handleDownload(downloadActivitiesDir, accessToken string) {
+func handleDownload(ctx context.Context, downloadActivitiesDir, token, tokenFile, nrcApiURL string) error {
 	if len(downloadActivitiesDir) == 0 {
-		logger.Error("Please provide a directory to save the downloaded activities.")
-		return
+		return errors.New("please provide a directory to save the downloaded activities")
+	}
+
+	accessToken, err := resolveToken(token, tokenFile)
+	if err != nil {
+		return err
 	}
 
 	nikeApi := nrc.NewNikeApi(accessToken)
+	nikeApi.HTTPClient = httpClient
+	nikeApi.SetBaseURL(nrcApiURL)
 	nikeDownloader := nrc.NewNikeDownloader(nikeApi, downloadActivitiesDir)
-	nikeDownloader.DownloadActivities()
+	nikeDownloader.Report = runReport
+	return nikeDownloader.DownloadActivities(ctx)
 }
 
-func handleStravaDownload(stravaDownloadActivitiesDir, stravaDownloadToken string) {
+func handleStravaDownload(ctx context.Context, stravaDownloadActivitiesDir, token, tokenFile, stravaURL string) error {
 	if len(stravaDownloadActivitiesDir) == 0 {
-		logger.Error("Please provide a directory to save the downloaded activities.")
-		return
+		return errors.New("please provide a directory to save the downloaded activities")
+	}
+
+	stravaDownloadToken, err := resolveToken(token, tokenFile)
+	if err != nil {
+		return err
 	}
 
 	stravaWeb := strava.NewStravaWeb(stravaDownloadToken)
+	stravaWeb.HTTPClient = httpClient
+	stravaWeb.SetBaseURL(stravaURL)
 	stravaDownloader := strava.NewStravaDownloader(stravaWeb, stravaDownloadActivitiesDir)
-	stravaDownloader.DownloadActivities()
+	stravaDownloader.Report = runReport
+	return stravaDownloader.DownloadActivities(ctx)
 }
 
-func handleUpload(fitActivityDir, fitActivityFile, strava4Session string) {
+func handleUpload(ctx context.Context, fitActivityDir, fitActivityFile, token, tokenFile, stravaURL string, gearMapping map[string]string) error {
 	if len(fitActivityDir) == 0 && len(fitActivityFile) == 0 {
-		logger.Error("Please provide either a FIT activity file or a directory of FIT activities.")
-		return
+		return errors.New("please provide either a FIT activity file or a directory of FIT activities")
+	}
+
+	strava4Session, err := resolveToken(token, tokenFile)
+	if err != nil {
+		return err
 	}
 
 	stravaWeb := strava.NewStravaWeb(strava4Session)
+	stravaWeb.HTTPClient = httpClient
+	stravaWeb.SetBaseURL(stravaURL)
 	stravaUploader := strava.NewStravaUploader(fitActivityFile, stravaWeb)
+	stravaUploader.GearMapping = gearMapping
+	stravaUploader.Report = runReport
 
 	if len(fitActivityFile) > 0 {
 		logger.Infof("Processing file: %s\n", fitActivityFile)
-		stravaUploader.UploadActivity(fitActivityFile)
+		if err := stravaUploader.UploadActivity(ctx, fitActivityFile); err != nil {
+			return err
+		}
 	}
 
 	if len(fitActivityDir) > 0 {
 		files, err := os.ReadDir(fitActivityDir)
 		if err != nil {
-			logger.Errorf("Error reading directory: %v\n", err)
-			return
+			return fmt.Errorf("error reading directory: %w", err)
 		}
 
 		// Count .fit files
@@ -133,65 +500,265 @@ func handleUpload(fitActivityDir, fitActivityFile, strava4Session string) {
 		total := len(fitFiles)
 		if total == 0 {
 			logger.Error("No .fit files to upload")
-			return
+			return nil
 		}
 
 		logger.Infof("Uploading %d activities...\n", total)
 
 		successCount := 0
 		for _, file := range fitFiles {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
 			filePath := filepath.Join(fitActivityDir, file.Name())
 			logger.Debugf("Uploading file: %s\n", filePath)
 
-			success := stravaUploader.UploadActivity(filePath)
-			if !success {
-				return
+			if err := stravaUploader.UploadActivity(ctx, filePath); err != nil {
+				if utils.ShouldAbort(err) || ctx.Err() != nil {
+					return err
+				}
+
+				logger.Errorf("Error uploading %s: %v\n", filePath, err)
+				continue
 			}
 
 			// move the file to a different directory if upload is successful
 			destinationDir := filepath.Join(fitActivityDir, "uploaded")
-			fit.InitActivityMover(destinationDir).MoveFIT(filePath, file.Name())
+			if err := fit.InitActivityMover(destinationDir).MoveFIT(filePath, file.Name()); err != nil {
+				return err
+			}
 
 			successCount++
 			logger.Infof("✓ Uploaded %d/%d activities\n", successCount, total)
-			time.Sleep(100 * time.Millisecond)
+			if err := utils.Sleep(ctx, 100*time.Millisecond); err != nil {
+				return err
+			}
 		}
 
 		logger.Infof("✓ Finished uploading %d activities\n", successCount)
 	}
+
+	return nil
 }
 
-func handleConvert(activitiesDir, activityFile, outputDir string) {
+func handleConvert(ctx context.Context, activitiesDir, activityFile, outputDir string, flags *conversionFlags) error {
 	if len(activitiesDir) == 0 && len(activityFile) == 0 {
-		logger.Error("Please provide either an activity file or a directory of activities.")
-		return
+		return errors.New("please provide either an activity file or a directory of activities")
 	}
 
 	activitiesParser := parser.InitActivitiesParser(activitiesDir, activityFile)
-	activitiesConverter := converter.InitActivitiesConverter()
+	activitiesParser.Report = runReport
 	activityWriter := fit.InitActivityWriter(outputDir)
 
 	if len(activityFile) > 0 {
-		nikeActivity := activitiesParser.LoadActivity()
-		run := activitiesConverter.ConvertRun(nikeActivity)
-		activityWriter.WriteFIT(run)
+		// Sidecar override files are next to the activity file
+		activitiesConverter, err := newActivitiesConverter(flags, filepath.Dir(activityFile))
+		if err != nil {
+			return err
+		}
+
+		nikeActivity, err := activitiesParser.LoadActivity()
+		if err != nil {
+			return err
+		}
+
+		if activitiesConverter.IsExcluded(nikeActivity) {
+			logger.Infof("Skipping excluded activity ID: %s\n", nikeActivity.ID)
+			runReport.AddSkipped(nikeActivity.ID, activityFile, "excluded by override")
+		} else {
+			run := activitiesConverter.ConvertRun(nikeActivity)
+			outputFilename, err := activityWriter.WriteFIT(run)
+			if err != nil {
+				return err
+			}
+			runReport.AddProcessed(nikeActivity.ID, outputFilename)
+		}
 	}
 
 	if len(activitiesDir) > 0 {
-		nikeActivities := activitiesParser.LoadActivities()
+		nikeActivities, err := activitiesParser.LoadActivities()
+		if err != nil {
+			return err
+		}
 
 		if len(nikeActivities) == 0 {
 			logger.Error("No activities to convert")
-			return
+			return nil
+		}
+
+		activitiesConverter, err := newActivitiesConverter(flags, activitiesDir)
+		if err != nil {
+			return err
 		}
 
 		logger.Infof("Converting %d activities...\n", len(nikeActivities))
 
+		convertedCount := 0
 		for _, nikeActivity := range nikeActivities {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if activitiesConverter.IsExcluded(nikeActivity) {
+				logger.Infof("Skipping excluded activity ID: %s\n", nikeActivity.ID)
+				runReport.AddSkipped(nikeActivity.ID, "", "excluded by override")
+				continue
+			}
+
 			run := activitiesConverter.ConvertRun(nikeActivity)
-			activityWriter.WriteFIT(run)
+			outputFilename, err := activityWriter.WriteFIT(run)
+			if err != nil {
+				logger.Errorf("Error writing activity ID %s: %v\n", nikeActivity.ID, err)
+				runReport.AddFailed(nikeActivity.ID, "", err)
+				continue
+			}
+
+			runReport.AddProcessed(nikeActivity.ID, outputFilename)
+			convertedCount++
+		}
+
+		logger.Infof("✓ Finished converting %d activities\n", convertedCount)
+	}
+
+	return nil
+}
+
+func handleValidate(fitActivityDir, fitActivityFile string) error {
+	if len(fitActivityDir) == 0 && len(fitActivityFile) == 0 {
+		return errors.New("please provide either a FIT activity file or a directory of FIT activities")
+	}
+
+	// The invalid files are recorded as failed in the report
+	activityValidator := fit.InitActivityValidator(fitActivityDir)
+	activityValidator.Report = runReport
+
+	if len(fitActivityFile) > 0 {
+		activityValidator.ValidateFIT(fitActivityFile)
+	}
+
+	if len(fitActivityDir) > 0 {
+		if _, err := activityValidator.ValidateActivities(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func handleInspect(fitActivityDir, fitActivityFile, format string) error {
+	if len(fitActivityDir) == 0 && len(fitActivityFile) == 0 {
+		return errors.New("please provide either a FIT activity file or a directory of FIT activities")
+	}
+
+	fitFiles := []string{}
+
+	if len(fitActivityFile) > 0 {
+		fitFiles = append(fitFiles, fitActivityFile)
+	}
+
+	if len(fitActivityDir) > 0 {
+		files, err := os.ReadDir(fitActivityDir)
+		if err != nil {
+			return fmt.Errorf("error reading directory: %w", err)
+		}
+
+		for _, file := range files {
+			if filepath.Ext(file.Name()) == ".fit" {
+				fitFiles = append(fitFiles, filepath.Join(fitActivityDir, file.Name()))
+			}
 		}
+	}
+
+	for _, filePath := range fitFiles {
+		fitActivity, err := strava.NewFitActivity(filePath)
+		if err != nil {
+			logger.Error(err)
+			runReport.AddFailed("", filePath, err)
+			continue
+		}
+
+		summary := fitActivity.Summarize(filePath)
+		if format == "json" {
+			err = summary.WriteJSON(os.Stdout)
+		} else {
+			err = summary.WriteText(os.Stdout)
+			fmt.Println()
+		}
+
+		if err != nil {
+			logger.Errorf("Error writing summary of %s: %v\n", filePath, err)
+			runReport.AddFailed("", filePath, err)
+			continue
+		}
+
+		runReport.AddProcessed("", filePath)
+	}
+
+	return nil
+}
+
+func handleReconcile(nrcActivitiesDir, stravaActivitiesDir, format string, flags *conversionFlags) error {
+	if len(nrcActivitiesDir) == 0 || len(stravaActivitiesDir) == 0 {
+		return errors.New("please provide both the NRC and the Strava activities directories")
+	}
+
+	// The runs are converted as they were migrated, with the same corrections
+	activitiesConverter, err := newActivitiesConverter(flags, nrcActivitiesDir)
+	if err != nil {
+		return err
+	}
+
+	runReconciler := reconciler.NewReconciler(nrcActivitiesDir, stravaActivitiesDir)
+	runReconciler.Converter = activitiesConverter
+	runReconciler.Report = runReport
+
+	report, err := runReconciler.Reconcile()
+	if err != nil {
+		return fmt.Errorf("reconciliation error: %w", err)
+	}
+
+	if format == "json" {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+
+	if err != nil {
+		return fmt.Errorf("error writing report: %w", err)
+	}
 
-		logger.Infof("✓ Finished converting %d activities\n", len(nikeActivities))
+	return nil
+}
+
+func handleRecords(activitiesDir, format string, flags *conversionFlags) error {
+	if len(activitiesDir) == 0 {
+		return errors.New("please provide the NRC activities directory")
+	}
+
+	activitiesConverter, err := newActivitiesConverter(flags, activitiesDir)
+	if err != nil {
+		return err
+	}
+
+	finder := records.NewFinder(activitiesDir)
+	finder.Converter = activitiesConverter
+	finder.Report = runReport
+
+	report, err := finder.Find()
+	if err != nil {
+		return fmt.Errorf("error finding the records: %w", err)
+	}
+
+	if format == "json" {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteText(os.Stdout)
 	}
+
+	if err != nil {
+		return fmt.Errorf("error writing report: %w", err)
+	}
+
+	return nil
 }
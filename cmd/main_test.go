@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mxdc/nrc2strava/converter"
+)
+
+// newTestFlags returns conversion flags of an athlete of the heart rates
+func newTestFlags(age, maxHeartRate, restingHeartRate uint8) *conversionFlags {
+	weight, height, sex := 70.0, 180.0, converter.SexMale
+	return &conversionFlags{
+		athleteWeight:           &weight,
+		athleteHeight:           &height,
+		athleteAge:              &age,
+		athleteSex:              &sex,
+		athleteMaxHeartRate:     &maxHeartRate,
+		athleteRestingHeartRate: &restingHeartRate,
+	}
+}
+
+func TestNewAthlete(t *testing.T) {
+	tests := []struct {
+		name                           string
+		age, maxHeartRate, restingRate uint8
+		valid                          bool
+	}{
+		{"unknown heart rates", 30, 0, 0, true},
+		{"heart rates", 30, 190, 50, true},
+		{"resting heart rate only", 30, 0, 50, true},
+		{"invalid max heart rate", 30, 255, 50, false},
+		{"invalid resting heart rate", 30, 0, 255, false},
+		{"resting above max", 30, 150, 160, false},
+		{"resting equal to max", 30, 150, 150, false},
+		{"invalid age", 255, 190, 50, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			athlete, err := newAthlete(newTestFlags(tt.age, tt.maxHeartRate, tt.restingRate))
+			if (err == nil) != tt.valid {
+				t.Errorf("newAthlete() error = %v, want valid %t", err, tt.valid)
+			}
+			if err == nil && (athlete.MaxHeartRate != tt.maxHeartRate || athlete.RestingHeartRate != tt.restingRate || athlete.Height != 1.8) {
+				t.Errorf("newAthlete() = %+v", athlete)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mxdc/nrc2strava/converter"
+)
+
+// newZones returns the zones of the comma separated lower bounds of the zones 1 to N,
+// in bpm for the heart rate and in min/km (m:ss) for the pace
+func newZones(heartRates, paces string) (converter.Zones, error) {
+	zones := converter.Zones{}
+
+	for _, value := range splitList(heartRates) {
+		heartRate, err := strconv.ParseUint(value, 10, 8)
+		if err != nil || heartRate == 0 || heartRate == 255 {
+			return converter.Zones{}, fmt.Errorf("invalid heart rate zone %q, expected bpm", value)
+		}
+		zones.HeartRate = append(zones.HeartRate, uint8(heartRate))
+	}
+
+	for _, value := range splitList(paces) {
+		pace, err := parsePace(value)
+		if err != nil {
+			return converter.Zones{}, err
+		}
+		zones.Speed = append(zones.Speed, 1000/pace.Seconds())
+	}
+
+	return zones, nil
+}
+
+// parsePace parses a m:ss pace per km
+func parsePace(value string) (time.Duration, error) {
+	minutes, seconds, found := strings.Cut(value, ":")
+	if !found {
+		seconds = "0"
+	}
+
+	m, err := strconv.Atoi(minutes)
+	if err != nil || m < 0 {
+		return 0, fmt.Errorf("invalid pace zone %q, expected m:ss per km", value)
+	}
+	s, err := strconv.Atoi(seconds)
+	if err != nil || s < 0 || s >= 60 {
+		return 0, fmt.Errorf("invalid pace zone %q, expected m:ss per km", value)
+	}
+
+	pace := time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+	if pace <= 0 {
+		return 0, fmt.Errorf("invalid pace zone %q, expected m:ss per km", value)
+	}
+
+	return pace, nil
+}
+
+// splitList splits a comma separated list, ignoring the blank values
+func splitList(list string) []string {
+	values := []string{}
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); len(value) > 0 {
+			values = append(values, value)
+		}
+	}
+	return values
+}
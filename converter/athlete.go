@@ -0,0 +1,78 @@
+package converter
+
+import (
+	"github.com/muktihari/fit/profile/mesgdef"
+	"github.com/muktihari/fit/profile/typedef"
+)
+
+// DefaultAthleteWeight is the weight in kg used by the estimations when none is configured
+const DefaultAthleteWeight = 70.0
+
+// Sex of the athlete
+const (
+	SexMale   = "male"
+	SexFemale = "female"
+)
+
+// Athlete is the profile of the runner, used by the estimations and written in the FIT user profile.
+// The zero values are unknown.
+type Athlete struct {
+	// Weight in kg, DefaultAthleteWeight for the estimations when 0
+	Weight float64
+
+	// Height in meters
+	Height float64
+
+	// Age in years
+	Age uint8
+
+	// Sex is SexMale, SexFemale or empty
+	Sex string
+
+	// Heart rates in bpm
+	MaxHeartRate     uint8
+	RestingHeartRate uint8
+}
+
+// weight returns the configured weight or the default one
+func (a Athlete) weight() float64 {
+	if a.Weight > 0 {
+		return a.Weight
+	}
+	return DefaultAthleteWeight
+}
+
+// known reports whether any field of the profile is set
+func (a Athlete) known() bool {
+	return a != Athlete{}
+}
+
+// UserProfile returns the FIT user profile of the athlete, the unknown fields stay invalid
+func (a Athlete) UserProfile() *mesgdef.UserProfile {
+	userProfile := mesgdef.NewUserProfile(nil)
+
+	if a.Weight > 0 {
+		userProfile.SetWeightScaled(a.Weight)
+	}
+	if a.Height > 0 {
+		userProfile.SetHeightScaled(a.Height)
+	}
+	if a.Age > 0 {
+		userProfile.SetAge(a.Age)
+	}
+	switch a.Sex {
+	case SexMale:
+		userProfile.SetGender(typedef.GenderMale)
+	case SexFemale:
+		userProfile.SetGender(typedef.GenderFemale)
+	}
+	if a.MaxHeartRate > 0 {
+		userProfile.SetDefaultMaxHeartRate(a.MaxHeartRate)
+		userProfile.SetDefaultMaxRunningHeartRate(a.MaxHeartRate)
+	}
+	if a.RestingHeartRate > 0 {
+		userProfile.SetRestingHeartRate(a.RestingHeartRate)
+	}
+
+	return userProfile
+}
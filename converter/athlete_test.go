@@ -0,0 +1,52 @@
+package converter
+
+import (
+	"os"
+	"testing"
+
+	"github.com/muktihari/fit/profile/basetype"
+	"github.com/muktihari/fit/profile/typedef"
+)
+
+func TestAthleteUserProfile(t *testing.T) {
+	athlete := Athlete{Weight: 68.5, Height: 1.78, Age: 40, Sex: SexFemale, MaxHeartRate: 185, RestingHeartRate: 52}
+	userProfile := athlete.UserProfile()
+
+	if userProfile.WeightScaled() != 68.5 || userProfile.HeightScaled() != 1.78 || userProfile.Age != 40 {
+		t.Errorf("user profile weight %.1f, height %.2f, age %d", userProfile.WeightScaled(), userProfile.HeightScaled(), userProfile.Age)
+	}
+	if userProfile.Gender != typedef.GenderFemale {
+		t.Errorf("user profile gender = %s, want female", userProfile.Gender)
+	}
+	if userProfile.DefaultMaxHeartRate != 185 || userProfile.DefaultMaxRunningHeartRate != 185 || userProfile.RestingHeartRate != 52 {
+		t.Errorf("user profile heart rates max %d, running max %d, resting %d", userProfile.DefaultMaxHeartRate, userProfile.DefaultMaxRunningHeartRate, userProfile.RestingHeartRate)
+	}
+
+	// The unknown fields stay invalid
+	userProfile = Athlete{Age: 30}.UserProfile()
+	if userProfile.Weight != basetype.Uint16Invalid || userProfile.Gender != typedef.GenderInvalid || userProfile.RestingHeartRate != basetype.Uint8Invalid {
+		t.Errorf("user profile of an unknown athlete has weight %d, gender %s, resting heart rate %d", userProfile.Weight, userProfile.Gender, userProfile.RestingHeartRate)
+	}
+}
+
+// TestConvertUserProfile checks the user profile is only written when the athlete is known
+func TestConvertUserProfile(t *testing.T) {
+	for _, athlete := range []Athlete{{}, {Weight: 70, MaxHeartRate: 190}} {
+		jsonFile, err := os.Open("testdata/corpus/heart_rate.json")
+		if err != nil {
+			t.Fatalf("error opening activity: %v", err)
+		}
+		defer jsonFile.Close()
+
+		activitiesConverter := InitActivitiesConverter()
+		activitiesConverter.Athlete = athlete
+		activity, err := activitiesConverter.Convert(jsonFile)
+		if err != nil {
+			t.Fatalf("Convert() error = %v", err)
+		}
+
+		if written := activity.UserProfile != nil; written != athlete.known() {
+			t.Errorf("athlete %+v: user profile written %t, want %t", athlete, written, athlete.known())
+		}
+	}
+}
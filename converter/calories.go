@@ -0,0 +1,70 @@
+package converter
+
+import (
+	"github.com/muktihari/fit/profile/basetype"
+	"github.com/muktihari/fit/profile/mesgdef"
+)
+
+// Sources of the session calories
+const (
+	// CaloriesSourceNRC uses the NRC calories summary, estimated when the activity has none
+	CaloriesSourceNRC = "nrc"
+	// CaloriesSourceEstimate always estimates the calories from the athlete profile
+	CaloriesSourceEstimate = "estimate"
+)
+
+const (
+	// joulesPerKilocalorie converts the energy into kcal
+	joulesPerKilocalorie = 4184.0
+
+	// restingOxygenCost is the oxygen consumed at rest, in ml/kg/min
+	restingOxygenCost = 3.5
+)
+
+// estimateCalories returns the calories burned in kcal, from the heart rate when the age and sex
+// of the athlete are known and the records have a heart rate, otherwise from the distance and the climb
+func estimateCalories(records []*mesgdef.Record, athlete Athlete, distance, ascent float64, activeDurationMs int64) float64 {
+	if calories, ok := heartRateCalories(records, athlete); ok {
+		return calories
+	}
+
+	// ACSM running equation: 0.2 ml/kg per meter run, 0.9 ml/kg per meter climbed, plus the resting cost
+	activeMinutes := float64(max(activeDurationMs, 0)) / (1000 * 60)
+	oxygenCost := 0.2*distance + 0.9*ascent + restingOxygenCost*activeMinutes // ml/kg
+	return oxygenCost * athlete.weight() * oxygenEnergy / joulesPerKilocalorie
+}
+
+// heartRateCalories sums the calories of each record from its heart rate with the Keytel et al. (2005) equations,
+// it returns false when the age, the sex or the heart rate is unknown
+func heartRateCalories(records []*mesgdef.Record, athlete Athlete) (float64, bool) {
+	if athlete.Age == 0 || (athlete.Sex != SexMale && athlete.Sex != SexFemale) {
+		return 0, false
+	}
+
+	weight := athlete.weight()
+	age := float64(athlete.Age)
+
+	calories := 0.0
+	found := false
+	for i := 1; i < len(records); i++ {
+		if records[i].HeartRate == basetype.Uint8Invalid {
+			continue
+		}
+		found = true
+
+		heartRate := float64(records[i].HeartRate)
+		minutes := records[i].Timestamp.Sub(records[i-1].Timestamp).Minutes()
+
+		// kJ per minute
+		var energy float64
+		if athlete.Sex == SexMale {
+			energy = -55.0969 + 0.6309*heartRate + 0.1988*weight + 0.2017*age
+		} else {
+			energy = -20.4022 + 0.4472*heartRate - 0.1263*weight + 0.074*age
+		}
+
+		calories += max(energy, 0) * 1000 / joulesPerKilocalorie * minutes
+	}
+
+	return calories, found
+}
@@ -0,0 +1,95 @@
+package converter
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mxdc/nrc2strava/types"
+)
+
+func TestEstimateCalories(t *testing.T) {
+	// 10km with 100m of climb in 50 minutes, about 1kcal/kg/km
+	records := newTestRecords(fuzzStartSeconds, 10)
+	calories := estimateCalories(records, Athlete{Weight: 70}, 10000, 100, 50*60*1000)
+	if calories < 650 || calories > 850 {
+		t.Errorf("estimateCalories() = %.0fkcal, want between 650 and 850kcal", calories)
+	}
+
+	if heavier := estimateCalories(records, Athlete{Weight: 80}, 10000, 100, 50*60*1000); heavier <= calories {
+		t.Errorf("calories of a heavier athlete %.0fkcal not above %.0fkcal", heavier, calories)
+	}
+
+	// Without weight, the default weight is used
+	if defaultWeight := estimateCalories(records, Athlete{}, 10000, 100, 50*60*1000); defaultWeight != calories {
+		t.Errorf("calories with the default weight = %.0fkcal, want %.0fkcal", defaultWeight, calories)
+	}
+}
+
+func TestHeartRateCalories(t *testing.T) {
+	// 10 minutes at 150bpm
+	records := newTestRecords(fuzzStartSeconds, 601)
+	for _, record := range records {
+		record.SetHeartRate(150)
+	}
+
+	athlete := Athlete{Weight: 70, Age: 35, Sex: SexMale}
+	calories, ok := heartRateCalories(records, athlete)
+	want := (-55.0969 + 0.6309*150 + 0.1988*70 + 0.2017*35) / 4.184 * 10
+	if !ok || math.Abs(calories-want) > 0.01 {
+		t.Errorf("heartRateCalories() = %.2f, %t, want %.2f, true", calories, ok, want)
+	}
+
+	// The heart rate is preferred to the distance
+	if estimated := estimateCalories(records, athlete, 2000, 0, 600000); estimated != calories {
+		t.Errorf("estimateCalories() = %.2f, want the heart rate calories %.2f", estimated, calories)
+	}
+
+	for _, athlete := range []Athlete{{Weight: 70, Sex: SexFemale}, {Weight: 70, Age: 35}} {
+		if _, ok := heartRateCalories(records, athlete); ok {
+			t.Errorf("heartRateCalories() of %+v returned true without age or sex", athlete)
+		}
+	}
+
+	if _, ok := heartRateCalories(newTestRecords(fuzzStartSeconds, 10), athlete); ok {
+		t.Errorf("heartRateCalories() of records without heart rate returned true")
+	}
+}
+
+// TestParseSessionCalories checks the NRC calories are kept unless missing or estimated
+func TestParseSessionCalories(t *testing.T) {
+	startMs := int64(fuzzStartSeconds * 1000)
+	metrics := []types.Metric{{
+		Type:   "distance",
+		Values: []types.MetricValue{{StartEpochMs: startMs, EndEpochMs: startMs + 600000, Value: 2}},
+	}}
+	summaries := []types.Summary{{Metric: "distance", Summary: "total", Value: 2}}
+	withCalories := append([]types.Summary{{Metric: "calories", Summary: "total", Value: 123}}, summaries...)
+
+	tests := []struct {
+		name      string
+		summaries []types.Summary
+		source    string
+		estimated bool
+	}{
+		{"NRC calories", withCalories, "", false},
+		{"missing calories", summaries, CaloriesSourceNRC, true},
+		{"estimated calories", withCalories, CaloriesSourceEstimate, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metricsConverter := InitMetricsConverter(startMs, startMs+600000, 600000, metrics, tt.summaries, nil, nil)
+			metricsConverter.CaloriesSource = tt.source
+			metricsConverter.Athlete = Athlete{Weight: 60}
+			session := metricsConverter.ParseSession(metricsConverter.ParseRecords())
+
+			want := uint16(123)
+			if tt.estimated {
+				want = uint16(math.Round(estimateCalories(nil, Athlete{Weight: 60}, 2000, 0, 600000)))
+			}
+			if session.TotalCalories != want {
+				t.Errorf("session calories = %d, want %d", session.TotalCalories, want)
+			}
+		})
+	}
+}
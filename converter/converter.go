@@ -1,12 +1,16 @@
 package converter
 
 import (
-	"github.com/muktihari/fit/profile"
-	"github.com/muktihari/fit/profile/basetype"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
 	"github.com/muktihari/fit/profile/filedef"
 	"github.com/muktihari/fit/profile/mesgdef"
 	"github.com/muktihari/fit/profile/typedef"
-	"github.com/muktihari/fit/proto"
+	"github.com/mxdc/nrc2strava/fit"
+	"github.com/mxdc/nrc2strava/parser"
 	"github.com/mxdc/nrc2strava/types"
 	"github.com/mxdc/nrc2strava/utils"
 	"github.com/sirupsen/logrus"
@@ -14,6 +18,37 @@ import (
 
 // ActivitiesConverter converts the activities into the FIT Activity format
 type ActivitiesConverter struct {
+	// GPS track cleaning, disabled by default
+	GPSFilter GPSFilter
+
+	// Speed derivation, the NRC speed series is used by default
+	SpeedStrategy SpeedStrategy
+
+	// Interval between two records, DefaultRecordInterval when 0, RecordIntervalNative for the NRC sample times
+	RecordInterval time.Duration
+
+	// Running power estimation, disabled by default
+	PowerModel string
+
+	// Athlete profile used by the estimations, written in the FIT user profile when known
+	Athlete Athlete
+
+	// Source of the session calories, the NRC summary is used by default
+	CaloriesSource string
+
+	// Zones of the time in zone analysis, the heart rate zones derive from the athlete max heart rate by default
+	Zones Zones
+
+	// Treadmill distance correction
+	TreadmillCalibration TreadmillCalibration
+
+	// Overrides are the user corrections by NRC activity ID
+	Overrides map[string]types.Override
+
+	// Elevation correction from a digital elevation model, disabled when nil
+	ElevationModel      ElevationModel
+	ElevationHysteresis float64
+
 	// logger
 	logger *logrus.Logger
 }
@@ -22,16 +57,50 @@ type ActivitiesConverter struct {
 func InitActivitiesConverter() *ActivitiesConverter {
 	var parser ActivitiesConverter
 
-	parser.logger = logrus.New()
-	parser.logger.SetFormatter(utils.LogFormat)
+	parser.logger = utils.Logger
 
 	return &parser
 }
 
-// LoadActivities load JSON files into memory
+// ErrExcluded is returned by Convert when an override excludes the activity
+var ErrExcluded = errors.New("activity excluded by override")
+
+// Convert converts a NRC activity JSON into a FIT activity with the default options
+func Convert(r io.Reader) (*filedef.Activity, error) {
+	return InitActivitiesConverter().Convert(r)
+}
+
+// Convert converts a NRC activity JSON into a FIT activity
+func (c *ActivitiesConverter) Convert(r io.Reader) (*filedef.Activity, error) {
+	nikeActivity, err := parser.ParseActivity(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.IsExcluded(nikeActivity) {
+		return nil, ErrExcluded
+	}
+
+	return c.ConvertRun(nikeActivity).Activity, nil
+}
+
+// ConvertRun converts a parsed NRC activity into a FIT activity
 func (c *ActivitiesConverter) ConvertRun(nikeActivity *types.Activity) types.Run {
 	activity := filedef.NewActivity()
 
+	// Apply the user corrections to a copy of the activity
+	override, hasOverride := c.Overrides[nikeActivity.ID]
+	if hasOverride {
+		overridden, err := applyOverride(nikeActivity, override)
+		if err != nil {
+			// The distance, sport, description and gear of the override are dropped too
+			c.logger.Errorf("Error applying override of activity %s, converting without it: %v\n", nikeActivity.ID, err)
+			override = types.Override{}
+		} else {
+			nikeActivity = overridden
+		}
+	}
+
 	// FileId
 	activity.FileId = *mesgdef.NewFileId(nil).
 		SetType(typedef.FileActivity).
@@ -39,30 +108,14 @@ func (c *ActivitiesConverter) ConvertRun(nikeActivity *types.Activity) types.Run
 		SetManufacturer(typedef.ManufacturerNike).
 		SetSerialNumber(12345)
 
-	// Activity Title
-	activityTitle := getRunName(nikeActivity.Tags, nikeActivity.StartEpochMs)
-	fieldBase := &proto.FieldBase{
-		Num:        99,
-		Name:       "Title",
-		Type:       profile.String,
-		BaseType:   basetype.String,
-		Array:      false,
-		Accumulate: false,
-		Scale:      1,
-		Offset:     0,
-		Units:      "",
+	// The athlete profile lets the platforms interpret the heart rates
+	if c.Athlete.known() {
+		activity.UserProfile = c.Athlete.UserProfile()
 	}
 
-	customField := proto.Field{FieldBase: fieldBase, Value: proto.String(activityTitle)}
-	activity.FileId.SetUnknownFields(customField)
-
-	// DeveloperDataIds
-	activity.DeveloperDataIds = append(
-		activity.DeveloperDataIds,
-		mesgdef.NewDeveloperDataId(nil).
-			SetApplicationId([]byte{99}).
-			SetDeveloperDataIndex(0),
-	)
+	// Developer data describing the NRC fields embedded in the session
+	activity.DeveloperDataIds = append(activity.DeveloperDataIds, fit.NewDeveloperDataId())
+	activity.FieldDescriptions = append(activity.FieldDescriptions, fit.NewFieldDescriptions()...)
 
 	// events
 	events := convertMomentsToEvents(nikeActivity)
@@ -78,28 +131,69 @@ func (c *ActivitiesConverter) ConvertRun(nikeActivity *types.Activity) types.Run
 		nikeActivity.Moments,
 		nikeActivity.Tags,
 	)
+	metricsConverter.GPSFilter = c.GPSFilter
+	metricsConverter.SpeedStrategy = c.SpeedStrategy
+	metricsConverter.RecordInterval = c.RecordInterval
+	metricsConverter.PowerModel = c.PowerModel
+	metricsConverter.Athlete = c.Athlete
+	metricsConverter.CaloriesSource = c.CaloriesSource
+	metricsConverter.ElevationModel = c.ElevationModel
+	metricsConverter.ElevationHysteresis = c.ElevationHysteresis
+
+	// Correct the distance before filling the records
+	if override.Distance > 0 && metricsConverter.DistanceSummary.Value > 0 {
+		metricsConverter.Calibrate(override.Distance / metricsConverter.DistanceSummary.Value)
+	} else if metricsConverter.Indoor {
+		factor := c.TreadmillCalibration.factorFor(nikeActivity.ID, metricsConverter.DistanceSummary.Value*1000)
+		metricsConverter.Calibrate(factor)
+	}
 
 	records := metricsConverter.ParseRecords()
 	// printRecordLines(records)
 	activity.Records = records
 
 	// lap
-	activity.Laps = append(
-		activity.Laps,
-		mesgdef.NewLap(nil).
-			SetStartTime(utils.ParseTimeInMs(nikeActivity.StartEpochMs)).
-			SetTimestamp(utils.ParseTimeInMs(nikeActivity.EndEpochMs)).
-			SetTotalElapsedTime(uint32(nikeActivity.EndEpochMs-nikeActivity.StartEpochMs)).
-			SetTotalTimerTime(uint32(nikeActivity.ActiveDuration)),
-	)
+	lap := mesgdef.NewLap(nil).
+		SetStartTime(utils.ParseTimeInMs(nikeActivity.StartEpochMs)).
+		SetTimestamp(utils.ParseTimeInMs(nikeActivity.EndEpochMs)).
+		SetTotalElapsedTime(uint32(nikeActivity.EndEpochMs - nikeActivity.StartEpochMs)).
+		SetTotalTimerTime(uint32(nikeActivity.ActiveDuration))
+	activity.Laps = append(activity.Laps, lap)
 
 	// session
 	session := metricsConverter.ParseSession(records)
+	if sport, ok := overrideSport(override); ok && sport != typedef.SportRunning {
+		session.SetSport(sport)
+		if !metricsConverter.Indoor {
+			session.SetSubSport(typedef.SubSportGeneric)
+		}
+	}
+	developerValues := fit.MetadataFields(ExtractMetadata(nikeActivity.Tags))
+	developerValues[fit.FieldTitle] = getRunName(nikeActivity.Tags, nikeActivity.StartEpochMs)
+	developerValues[fit.FieldNRCActivityID] = nikeActivity.ID
+	developerValues[fit.FieldNRCAppID] = nikeActivity.AppID
+	developerValues[fit.FieldNRCSources] = strings.Join(nikeActivity.Sources, ",")
+	developerValues[fit.FieldDescription] = override.Description
+	developerValues[fit.FieldGearID] = override.Gear
+	session.SetDeveloperFields(fit.NewDeveloperFields(developerValues)...)
 	activity.Sessions = append(
 		activity.Sessions,
 		session,
 	)
 
+	// Time spent in each heart rate and pace zone
+	if timeInZone := c.Zones.TimeInZone(records, session, c.Athlete); timeInZone != nil {
+		activity.TimeInZones = append(activity.TimeInZones, timeInZone)
+	}
+
+	// The single lap covers the whole session
+	lap.TotalDistance = session.TotalDistance
+	lap.AvgSpeed = session.AvgSpeed
+	lap.MaxSpeed = session.MaxSpeed
+	lap.TotalCalories = session.TotalCalories
+	lap.AvgHeartRate = session.AvgHeartRate
+	lap.MaxHeartRate = session.MaxHeartRate
+
 	activity.Activity = mesgdef.NewActivity(nil).
 		SetType(typedef.Activity(typedef.ActivityTypeRunning)).
 		SetTimestamp(utils.ParseTimeInMs(nikeActivity.EndEpochMs)).
@@ -0,0 +1,66 @@
+package converter
+
+import (
+	"math"
+
+	"github.com/muktihari/fit/profile/basetype"
+	"github.com/muktihari/fit/profile/mesgdef"
+)
+
+// ElevationModel provides the ground altitude of a position, such as a digital elevation model
+type ElevationModel interface {
+	Elevation(latitude, longitude float64) (float64, bool)
+}
+
+// fillElevationFromModel replaces the altitude of the records having a position covered by the model
+func fillElevationFromModel(records []*mesgdef.Record, model ElevationModel) int {
+	corrected := 0
+
+	for _, record := range records {
+		if record.PositionLat == basetype.Sint32Invalid || record.PositionLong == basetype.Sint32Invalid {
+			continue
+		}
+
+		altitude, ok := model.Elevation(record.PositionLatDegrees(), record.PositionLongDegrees())
+		if !ok {
+			continue
+		}
+
+		record.SetAltitudeScaled(altitude)
+		record.SetEnhancedAltitudeScaled(altitude)
+		corrected++
+	}
+
+	return corrected
+}
+
+// computeAscentDescent sums the altitude changes larger than the hysteresis threshold,
+// it returns false when the records have no altitude
+func computeAscentDescent(records []*mesgdef.Record, threshold float64) (float64, float64, bool) {
+	ascent := 0.0
+	descent := 0.0
+	reference := math.NaN()
+
+	for _, record := range records {
+		altitude := record.EnhancedAltitudeScaled()
+		if math.IsNaN(altitude) {
+			continue
+		}
+
+		if math.IsNaN(reference) {
+			reference = altitude
+			continue
+		}
+
+		// Only count the changes above the threshold to ignore the noise
+		if altitude-reference >= threshold {
+			ascent += altitude - reference
+			reference = altitude
+		} else if reference-altitude >= threshold {
+			descent += reference - altitude
+			reference = altitude
+		}
+	}
+
+	return ascent, descent, !math.IsNaN(reference)
+}
@@ -0,0 +1,77 @@
+package converter
+
+import (
+	"math"
+	"testing"
+)
+
+// slopeModel is a ground rising 1m per 0.001° of latitude from 100m at the equator, north of it only
+type slopeModel struct{}
+
+func (slopeModel) Elevation(latitude, longitude float64) (float64, bool) {
+	if latitude < 0 {
+		return 0, false
+	}
+	return 100 + latitude*1000, true
+}
+
+func TestFillElevationFromModel(t *testing.T) {
+	records := newTestRecords(fuzzStartSeconds, 4)
+	for _, record := range records {
+		record.SetEnhancedAltitudeScaled(50)
+	}
+	records[0].SetPositionLatDegrees(0.01).SetPositionLongDegrees(0)
+	// records[1] has no position
+	records[2].SetPositionLatDegrees(-0.01).SetPositionLongDegrees(0)
+	records[3].SetPositionLatDegrees(0.02).SetPositionLongDegrees(0)
+
+	if corrected := fillElevationFromModel(records, slopeModel{}); corrected != 2 {
+		t.Errorf("fillElevationFromModel() corrected %d records, want 2", corrected)
+	}
+
+	// The records without position or outside the model keep their altitude
+	for i, want := range []float64{110, 50, 50, 120} {
+		if got := records[i].EnhancedAltitudeScaled(); math.Abs(got-want) > 0.5 {
+			t.Errorf("record %d altitude = %.1f, want %.1f", i, got, want)
+		}
+	}
+	if got := records[3].AltitudeScaled(); math.Abs(got-120) > 0.5 {
+		t.Errorf("record 3 altitude = %.1f, want the enhanced altitude 120", got)
+	}
+}
+
+func TestComputeAscentDescent(t *testing.T) {
+	noise := []float64{100, 101, 100, 103, math.NaN(), 102, 98, 99}
+
+	tests := []struct {
+		name      string
+		altitudes []float64
+		threshold float64
+		ascent    float64
+		descent   float64
+		ok        bool
+	}{
+		{"every change", noise, 0, 5, 6, true},
+		{"above the hysteresis", noise, 2, 3, 5, true},
+		{"hysteresis above every change", noise, 10, 0, 0, true},
+		{"flat", []float64{100, 100, 100}, 2, 0, 0, true},
+		{"no altitude", []float64{math.NaN(), math.NaN()}, 2, 0, 0, false},
+		{"no record", []float64{}, 2, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := newTestRecords(fuzzStartSeconds, len(tt.altitudes))
+			for i, altitude := range tt.altitudes {
+				if !math.IsNaN(altitude) {
+					records[i].SetEnhancedAltitudeScaled(altitude)
+				}
+			}
+
+			ascent, descent, ok := computeAscentDescent(records, tt.threshold)
+			if ok != tt.ok || math.Abs(ascent-tt.ascent) > 1e-6 || math.Abs(descent-tt.descent) > 1e-6 {
+				t.Errorf("computeAscentDescent() = %.1f, %.1f, %t, want %.1f, %.1f, %t", ascent, descent, ok, tt.ascent, tt.descent, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package converter_test
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/tabwriter"
+	"time"
+
+	"github.com/muktihari/fit/profile/basetype"
+	"github.com/muktihari/fit/profile/filedef"
+	"github.com/muktihari/fit/profile/mesgdef"
+	"github.com/mxdc/nrc2strava/converter"
+	"github.com/mxdc/nrc2strava/fit"
+	"github.com/mxdc/nrc2strava/strava"
+	"github.com/mxdc/nrc2strava/types"
+)
+
+// update regenerates the golden files: go test ./converter -run TestGolden -update
+var update = flag.Bool("update", false, "update the golden files")
+
+const (
+	corpusDir = "testdata/corpus"
+	goldenDir = "testdata/golden"
+)
+
+// TestGolden converts each NRC activity of the corpus and compares the decoded FIT file with its golden file
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join(corpusDir, "*.json"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no activities found in %s: %v", corpusDir, err)
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+
+		t.Run(name, func(t *testing.T) {
+			got := convertAndDump(t, file)
+			goldenPath := filepath.Join(goldenDir, name+".golden")
+
+			if *update {
+				if err := os.MkdirAll(goldenDir, 0755); err != nil {
+					t.Fatalf("error creating golden directory: %v", err)
+				}
+				if err := os.WriteFile(goldenPath, got, 0644); err != nil {
+					t.Fatalf("error writing golden file: %v", err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("error reading golden file, run with -update to create it: %v", err)
+			}
+
+			if diff := firstDifference(string(want), string(got)); len(diff) > 0 {
+				t.Errorf("%s differs from the conversion, run with -update if the change is expected\n%s", goldenPath, diff)
+			}
+		})
+	}
+}
+
+// convertAndDump converts the NRC activity with the default options, encodes and decodes the FIT file, and dumps its content
+func convertAndDump(t *testing.T, file string) []byte {
+	t.Helper()
+
+	fitActivity := convertAndDecode(t, file, converter.InitActivitiesConverter())
+
+	var dump bytes.Buffer
+	runID := strings.TrimSuffix(filepath.Base(file), ".json")
+	if err := fitActivity.Summarize(runID + ".fit").WriteJSON(&dump); err != nil {
+		t.Fatalf("error writing the summary: %v", err)
+	}
+
+	fmt.Fprintln(&dump, "\nRecords:")
+	writeRecords(&dump, filedef.NewActivity(fitActivity.Fit.Messages...).Records)
+
+	return dump.Bytes()
+}
+
+// convertAndDecode converts the NRC activity, then encodes and decodes the FIT file.
+// The FIT encoding rounds the values to their scale, the tests check the decoded values.
+func convertAndDecode(t *testing.T, file string, activitiesConverter *converter.ActivitiesConverter) *strava.FitActivity {
+	t.Helper()
+
+	jsonFile, err := os.Open(file)
+	if err != nil {
+		t.Fatalf("error opening activity: %v", err)
+	}
+	defer jsonFile.Close()
+
+	activity, err := activitiesConverter.Convert(jsonFile)
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+
+	var encoded bytes.Buffer
+	runID := strings.TrimSuffix(filepath.Base(file), ".json")
+	if err := fit.WriteFIT(&encoded, types.Run{Id: runID, Activity: activity}); err != nil {
+		t.Fatalf("WriteFIT() error = %v", err)
+	}
+
+	fitActivity, err := strava.ReadFitActivity(&encoded)
+	if err != nil {
+		t.Fatalf("error decoding the FIT file: %v", err)
+	}
+
+	return fitActivity
+}
+
+// writeRecords writes a line per record, "-" standing for an invalid value
+func writeRecords(w io.Writer, records []*mesgdef.Record) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "TIME\tDISTANCE\tSPEED\tALTITUDE\tLATITUDE\tLONGITUDE\tCADENCE\tHR\t")
+
+	for _, record := range records {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n",
+			record.Timestamp.UTC().Format(time.TimeOnly),
+			formatInvalid(record.Distance == basetype.Uint32Invalid, "%.2f", record.DistanceScaled()),
+			formatInvalid(record.Speed == basetype.Uint16Invalid, "%.3f", record.SpeedScaled()),
+			formatInvalid(record.Altitude == basetype.Uint16Invalid, "%.1f", record.AltitudeScaled()),
+			formatInvalid(record.PositionLat == basetype.Sint32Invalid, "%.6f", record.PositionLatDegrees()),
+			formatInvalid(record.PositionLong == basetype.Sint32Invalid, "%.6f", record.PositionLongDegrees()),
+			formatInvalid(record.Cadence == basetype.Uint8Invalid, "%d", record.Cadence),
+			formatInvalid(record.HeartRate == basetype.Uint8Invalid, "%d", record.HeartRate),
+		)
+	}
+	tw.Flush()
+}
+
+func formatInvalid(invalid bool, format string, value any) string {
+	if invalid {
+		return "-"
+	}
+	return fmt.Sprintf(format, value)
+}
+
+// firstDifference describes the first line which differs, or returns an empty string
+func firstDifference(want, got string) string {
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+
+	for i := 0; i < max(len(wantLines), len(gotLines)); i++ {
+		var wantLine, gotLine string
+		if i < len(wantLines) {
+			wantLine = wantLines[i]
+		}
+		if i < len(gotLines) {
+			gotLine = gotLines[i]
+		}
+
+		if wantLine != gotLine {
+			return fmt.Sprintf("line %d:\n  want: %s\n   got: %s", i+1, wantLine, gotLine)
+		}
+	}
+
+	return ""
+}
+
+// TestSummaryTimeInZones converts a run with zones and checks the time in zones of the decoded FIT file
+func TestSummaryTimeInZones(t *testing.T) {
+	activitiesConverter := converter.InitActivitiesConverter()
+	activitiesConverter.Athlete = converter.Athlete{MaxHeartRate: 190}
+	activitiesConverter.Zones = converter.Zones{Speed: []float64{2.5, 3}}
+	fitActivity := convertAndDecode(t, filepath.Join(corpusDir, "heart_rate.json"), activitiesConverter)
+
+	summary := fitActivity.Summarize("heart_rate.fit")
+	if len(summary.TimeInZones) != 1 {
+		t.Fatalf("summary has %d time in zones, want 1", len(summary.TimeInZones))
+	}
+
+	timeInZones := summary.TimeInZones[0]
+	if timeInZones.Reference != "session" || len(timeInZones.HeartRate) != 6 || len(timeInZones.Speed) != 3 {
+		t.Fatalf("time in zones of %s with %d heart rate and %d pace zones, want session with 6 and 3",
+			timeInZones.Reference, len(timeInZones.HeartRate), len(timeInZones.Speed))
+	}
+
+	// The run lasts 240s, the last record ends the speed series and stands still
+	for _, tt := range []struct {
+		name  string
+		zones []strava.ZoneSummary
+		want  float64
+	}{
+		{"heart rate", timeInZones.HeartRate, 240},
+		{"pace", timeInZones.Speed, 239},
+	} {
+		total := 0.0
+		for _, zone := range tt.zones {
+			total += zone.Time
+		}
+		if total != tt.want {
+			t.Errorf("time in %s zones = %.0fs, want %.0fs", tt.name, total, tt.want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package converter
+
+import (
+	"math"
+
+	"github.com/muktihari/fit/profile/mesgdef"
+	"github.com/mxdc/nrc2strava/types"
+)
+
+const (
+	// earthRadius is the mean Earth radius in meters
+	earthRadius = 6371000.0
+
+	// maxConsecutiveOutliers is the number of rejected points after which the position is trusted again
+	maxConsecutiveOutliers = 5
+
+	// gpsAccuracy is the assumed accuracy in meters of the NRC positions, NRC doesn't record it
+	gpsAccuracy = 10.0
+)
+
+// Smoothing methods of the GPS track
+const (
+	SmoothingNone   = "none"
+	SmoothingKalman = "kalman"
+)
+
+// GPSFilter configures the cleaning of the GPS track before filling the records
+type GPSFilter struct {
+	// MaxSpeed rejects the positions reached faster than this speed in m/s, 0 disables the filter
+	MaxSpeed float64
+
+	// Smoothing is the smoothing method applied after the outlier rejection
+	Smoothing string
+
+	// KalmanNoise is the process noise of the Kalman filter in m/s, the higher the less smoothing
+	KalmanNoise float64
+}
+
+// Enabled reports whether the filter changes the track
+func (f GPSFilter) Enabled() bool {
+	return f.MaxSpeed > 0 || f.Smoothing == SmoothingKalman
+}
+
+type gpsPoint struct {
+	StartEpochMs int64
+	EndEpochMs   int64
+	Latitude     float64
+	Longitude    float64
+}
+
+// filterGPS removes the outliers and smooths the latitude and longitude metrics
+func filterGPS(latitudeMetric, longitudeMetric types.Metric, filter GPSFilter) (types.Metric, types.Metric) {
+	if !filter.Enabled() || latitudeMetric.Type != "latitude" || longitudeMetric.Type != "longitude" {
+		return latitudeMetric, longitudeMetric
+	}
+
+	points := pairGPS(latitudeMetric, longitudeMetric)
+
+	if filter.MaxSpeed > 0 {
+		points = rejectOutliers(points, filter.MaxSpeed)
+	}
+
+	if filter.Smoothing == SmoothingKalman {
+		points = smoothKalman(points, filter.KalmanNoise)
+	}
+
+	filteredLatitude := latitudeMetric
+	filteredLongitude := longitudeMetric
+	filteredLatitude.Values = make([]types.MetricValue, 0, len(points))
+	filteredLongitude.Values = make([]types.MetricValue, 0, len(points))
+
+	for _, point := range points {
+		filteredLatitude.Values = append(filteredLatitude.Values, types.MetricValue{
+			StartEpochMs: point.StartEpochMs,
+			EndEpochMs:   point.EndEpochMs,
+			Value:        point.Latitude,
+		})
+		filteredLongitude.Values = append(filteredLongitude.Values, types.MetricValue{
+			StartEpochMs: point.StartEpochMs,
+			EndEpochMs:   point.EndEpochMs,
+			Value:        point.Longitude,
+		})
+	}
+
+	return filteredLatitude, filteredLongitude
+}
+
+// pairGPS joins the latitude and longitude values sampled at the same time
+func pairGPS(latitudeMetric, longitudeMetric types.Metric) []gpsPoint {
+	longitudes := make(map[int64]float64, len(longitudeMetric.Values))
+	for _, value := range longitudeMetric.Values {
+		longitudes[value.StartEpochMs] = value.Value
+	}
+
+	points := make([]gpsPoint, 0, len(latitudeMetric.Values))
+	for _, value := range latitudeMetric.Values {
+		longitude, ok := longitudes[value.StartEpochMs]
+		if !ok {
+			continue
+		}
+
+		points = append(points, gpsPoint{
+			StartEpochMs: value.StartEpochMs,
+			EndEpochMs:   value.EndEpochMs,
+			Latitude:     value.Value,
+			Longitude:    longitude,
+		})
+	}
+
+	return points
+}
+
+// rejectOutliers drops the points reached from the previous kept point faster than maxSpeed
+func rejectOutliers(points []gpsPoint, maxSpeed float64) []gpsPoint {
+	if len(points) == 0 {
+		return points
+	}
+
+	kept := []gpsPoint{points[0]}
+	consecutiveOutliers := 0
+
+	for _, point := range points[1:] {
+		previous := kept[len(kept)-1]
+
+		timeDelta := float64(point.StartEpochMs-previous.StartEpochMs) / 1000
+		distance := haversineDistance(previous.Latitude, previous.Longitude, point.Latitude, point.Longitude)
+
+		// Keep the point if it's reachable, or if the track really moved there
+		if timeDelta > 0 && distance/timeDelta <= maxSpeed || consecutiveOutliers >= maxConsecutiveOutliers {
+			kept = append(kept, point)
+			consecutiveOutliers = 0
+			continue
+		}
+
+		consecutiveOutliers++
+	}
+
+	return kept
+}
+
+// smoothKalman applies a constant position Kalman filter whose uncertainty grows with time
+func smoothKalman(points []gpsPoint, processNoise float64) []gpsPoint {
+	if len(points) == 0 || processNoise <= 0 {
+		return points
+	}
+
+	smoothed := make([]gpsPoint, len(points))
+	latitude := points[0].Latitude
+	longitude := points[0].Longitude
+	variance := gpsAccuracy * gpsAccuracy
+
+	for i, point := range points {
+		if i > 0 {
+			timeDelta := float64(point.StartEpochMs-points[i-1].StartEpochMs) / 1000
+			if timeDelta > 0 {
+				variance += timeDelta * processNoise * processNoise
+			}
+
+			gain := variance / (variance + gpsAccuracy*gpsAccuracy)
+			latitude += gain * (point.Latitude - latitude)
+			longitude += gain * (point.Longitude - longitude)
+			variance = (1 - gain) * variance
+		}
+
+		smoothed[i] = point
+		smoothed[i].Latitude = latitude
+		smoothed[i].Longitude = longitude
+	}
+
+	return smoothed
+}
+
+// capSpeed replaces the record speeds above maxSpeed by the previous valid speed
+func capSpeed(records []*mesgdef.Record, maxSpeed float64) {
+	if maxSpeed <= 0 {
+		return
+	}
+
+	previousSpeed := 0.0
+	for _, record := range records {
+		speed := record.SpeedScaled()
+		if math.IsNaN(speed) {
+			continue
+		}
+
+		if speed > maxSpeed {
+			record.SetSpeedScaled(previousSpeed)
+			record.SetEnhancedSpeedScaled(previousSpeed)
+			continue
+		}
+
+		previousSpeed = speed
+	}
+}
+
+// haversineDistance returns the distance in meters between two positions in degrees
+func haversineDistance(latitude1, longitude1, latitude2, longitude2 float64) float64 {
+	phi1 := latitude1 * math.Pi / 180
+	phi2 := latitude2 * math.Pi / 180
+	deltaPhi := (latitude2 - latitude1) * math.Pi / 180
+	deltaLambda := (longitude2 - longitude1) * math.Pi / 180
+
+	a := math.Sin(deltaPhi/2)*math.Sin(deltaPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(deltaLambda/2)*math.Sin(deltaLambda/2)
+
+	return 2 * earthRadius * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
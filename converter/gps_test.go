@@ -0,0 +1,136 @@
+package converter
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// metersPerDegree is the length of a degree of latitude
+const metersPerDegree = earthRadius * math.Pi / 180
+
+// newGPSLine returns a point per second running north at the speed in m/s
+func newGPSLine(count int, speed float64) []gpsPoint {
+	points := make([]gpsPoint, count)
+	for i := range points {
+		startMs := int64(fuzzStartSeconds+i) * 1000
+		points[i] = gpsPoint{
+			StartEpochMs: startMs,
+			EndEpochMs:   startMs,
+			Latitude:     48.85 + float64(i)*speed/metersPerDegree,
+			Longitude:    2.35,
+		}
+	}
+	return points
+}
+
+// withSpike moves the point at the index 1km east
+func withSpike(points []gpsPoint, index int) []gpsPoint {
+	spiked := slices.Clone(points)
+	spiked[index].Longitude += 1000 / (metersPerDegree * math.Cos(spiked[index].Latitude*math.Pi/180))
+	return spiked
+}
+
+func TestHaversineDistance(t *testing.T) {
+	tests := []struct {
+		name                  string
+		latitude1, longitude1 float64
+		latitude2, longitude2 float64
+		want                  float64
+	}{
+		{"same point", 48.85, 2.35, 48.85, 2.35, 0},
+		{"a degree of latitude", 48, 2.35, 49, 2.35, metersPerDegree},
+		{"a degree of longitude at the equator", 0, 2, 0, 3, metersPerDegree},
+		{"a degree of longitude at 60°", 60, 2, 60, 3, metersPerDegree / 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := haversineDistance(tt.latitude1, tt.longitude1, tt.latitude2, tt.longitude2)
+			if math.Abs(got-tt.want) > 1 {
+				t.Errorf("haversineDistance() = %.1fm, want %.1fm", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRejectOutliers(t *testing.T) {
+	line := newGPSLine(10, 3)
+
+	// The track jumps 1km east for longer than the outliers are rejected
+	moved := slices.Clone(line)
+	for i := 3; i < len(moved); i++ {
+		moved = withSpike(moved, i)
+	}
+
+	tests := []struct {
+		name   string
+		points []gpsPoint
+		want   []gpsPoint
+	}{
+		{"straight line", line, line},
+		{"single spike", withSpike(line, 4), slices.Delete(slices.Clone(line), 4, 5)},
+		{"moved track", moved, append(slices.Clone(line[:3]), moved[3+maxConsecutiveOutliers:]...)},
+		{"empty", []gpsPoint{}, []gpsPoint{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rejectOutliers(tt.points, 25/3.6); !slices.Equal(got, tt.want) {
+				t.Errorf("rejectOutliers() kept %d points %v, want %d points %v", len(got), got, len(tt.want), tt.want)
+			}
+		})
+	}
+}
+
+func TestSmoothKalman(t *testing.T) {
+	still := newGPSLine(10, 0)
+	if got := smoothKalman(still, 3); !slices.Equal(got, still) {
+		t.Errorf("smoothKalman() of a still track = %v, want it unchanged", got)
+	}
+
+	// A straight line stays on the line and keeps its direction
+	line := newGPSLine(10, 3)
+	smoothed := smoothKalman(line, 3)
+	for i, point := range smoothed {
+		if point.Longitude != line[i].Longitude || point.StartEpochMs != line[i].StartEpochMs {
+			t.Errorf("smoothed point %d = %+v, left the line %+v", i, point, line[i])
+		}
+		if i > 0 && point.Latitude < smoothed[i-1].Latitude {
+			t.Errorf("smoothed point %d goes backwards: %f < %f", i, point.Latitude, smoothed[i-1].Latitude)
+		}
+	}
+
+	// A single spike is damped
+	spiked := withSpike(line, 4)
+	smoothed = smoothKalman(spiked, 3)
+	raw := haversineDistance(line[4].Latitude, line[4].Longitude, spiked[4].Latitude, spiked[4].Longitude)
+	damped := haversineDistance(line[4].Latitude, line[4].Longitude, smoothed[4].Latitude, smoothed[4].Longitude)
+	if damped >= raw {
+		t.Errorf("smoothed spike is %.0fm off the line, want less than the raw %.0fm", damped, raw)
+	}
+
+	if got := smoothKalman(line, 0); !slices.Equal(got, line) {
+		t.Errorf("smoothKalman() without process noise changed the track")
+	}
+}
+
+func TestCapSpeed(t *testing.T) {
+	speeds := []float64{2, 3, 50, 3, math.NaN(), 60}
+	records := newTestRecords(fuzzStartSeconds, len(speeds))
+	for i, record := range records {
+		if !math.IsNaN(speeds[i]) {
+			record.SetSpeedScaled(speeds[i])
+		}
+	}
+
+	capSpeed(records, 10)
+
+	// The speeds above the max take the previous valid speed, the missing speeds stay missing
+	want := []float64{2, 3, 3, 3, math.NaN(), 3}
+	for i, record := range records {
+		if got := record.SpeedScaled(); got != want[i] && !(math.IsNaN(got) && math.IsNaN(want[i])) {
+			t.Errorf("record %d speed = %.1f, want %.1f", i, got, want[i])
+		}
+	}
+}
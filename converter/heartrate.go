@@ -0,0 +1,60 @@
+package converter
+
+import (
+	"math"
+
+	"github.com/muktihari/fit/profile/basetype"
+	"github.com/muktihari/fit/profile/mesgdef"
+	"github.com/mxdc/nrc2strava/types"
+)
+
+// fillHeartRate fills the heart rate of each record from the NRC samples.
+// The records before the first sample, while the sensor was not connected yet, have no heart rate.
+func fillHeartRate(records []*mesgdef.Record, heartRateMetric types.Metric) {
+	if heartRateMetric.Type != "heart_rate" {
+		return
+	}
+
+	heartRates := newTimeSeries(heartRateMetric, linearInterpolation)
+	if heartRates.empty() {
+		return
+	}
+
+	firstSampleMs := heartRates.samples[0].start
+	for _, record := range records {
+		if record.Timestamp.UnixMilli() < firstSampleMs {
+			continue
+		}
+
+		heartRate, _ := heartRates.valueAt(record.Timestamp)
+		if heartRate <= 0 || heartRate >= float64(basetype.Uint8Invalid) {
+			continue
+		}
+
+		record.SetHeartRate(uint8(math.Round(heartRate)))
+	}
+}
+
+// computeHeartRate returns the average and max heart rate of the records, weighted by their duration.
+// It returns false when the records have no heart rate.
+func computeHeartRate(records []*mesgdef.Record) (float64, uint8, bool) {
+	var total, duration float64
+	var maxHeartRate uint8
+
+	for i := 1; i < len(records); i++ {
+		if records[i].HeartRate == basetype.Uint8Invalid {
+			continue
+		}
+
+		seconds := records[i].Timestamp.Sub(records[i-1].Timestamp).Seconds()
+		total += float64(records[i].HeartRate) * seconds
+		duration += seconds
+		maxHeartRate = max(maxHeartRate, records[i].HeartRate)
+	}
+
+	if duration <= 0 {
+		return 0, 0, false
+	}
+
+	return total / duration, maxHeartRate, true
+}
@@ -0,0 +1,59 @@
+package converter
+
+import (
+	"maps"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/muktihari/fit/profile/basetype"
+	"github.com/mxdc/nrc2strava/types"
+)
+
+// newHeartRateMetric returns instant heart rate samples at the offsets in seconds
+func newHeartRateMetric(samples map[int64]float64) types.Metric {
+	metric := types.Metric{Type: "heart_rate"}
+	for _, offset := range slices.Sorted(maps.Keys(samples)) {
+		timestampMs := (fuzzStartSeconds + offset) * 1000
+		metric.Values = append(metric.Values, types.MetricValue{StartEpochMs: timestampMs, EndEpochMs: timestampMs, Value: samples[offset]})
+	}
+	return metric
+}
+
+func TestFillHeartRate(t *testing.T) {
+	records := newTestRecords(fuzzStartSeconds, 10)
+	fillHeartRate(records, newHeartRateMetric(map[int64]float64{2: 120, 6: 160, 7: 0}))
+
+	// No heart rate before the first sample, interpolated between the samples, invalid samples skipped
+	want := []uint8{0xFF, 0xFF, 120, 130, 140, 150, 160, 0xFF, 0xFF, 0xFF}
+	got := make([]uint8, len(records))
+	for i, record := range records {
+		got[i] = record.HeartRate
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("fillHeartRate() = %v, want %v", got, want)
+	}
+
+	// The other metrics are ignored
+	records = newTestRecords(fuzzStartSeconds, 3)
+	metric := newHeartRateMetric(map[int64]float64{0: 120})
+	metric.Type = "speed"
+	fillHeartRate(records, metric)
+	if records[1].HeartRate != basetype.Uint8Invalid {
+		t.Errorf("fillHeartRate() of a speed metric set the heart rate %d", records[1].HeartRate)
+	}
+}
+
+func TestComputeHeartRate(t *testing.T) {
+	// The first record has no duration
+	records := newHeartRateRecords(200, 100, 120, 0xFF, 140)
+
+	avgHeartRate, maxHeartRate, ok := computeHeartRate(records)
+	if !ok || math.Abs(avgHeartRate-120) > 1e-9 || maxHeartRate != 140 {
+		t.Errorf("computeHeartRate() = %.1f, %d, %t, want 120, 140, true", avgHeartRate, maxHeartRate, ok)
+	}
+
+	if _, _, ok := computeHeartRate(newTestRecords(fuzzStartSeconds, 5)); ok {
+		t.Errorf("computeHeartRate() of records without heart rate returned true")
+	}
+}
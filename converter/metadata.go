@@ -0,0 +1,44 @@
+package converter
+
+import (
+	"strings"
+
+	"github.com/mxdc/nrc2strava/types"
+)
+
+// NRC tags holding user data, a field may be stored under several keys depending on the app version
+var (
+	shoeIDTags          = []string{"shoe_id", "com.nike.running.shoe_id"}
+	shoeNameTags        = []string{"shoe_name", "com.nike.running.shoe_name"}
+	noteTags            = []string{"note", "com.nike.running.note"}
+	weatherTags         = []string{"com.nike.weather", "weather"}
+	temperatureTags     = []string{"com.nike.temperature", "temperature"}
+	terrainTags         = []string{"terrain", "com.nike.running.terrain"}
+	perceivedEffortTags = []string{"rpe", "com.nike.running.rpe"}
+	moodTags            = []string{"emoji", "com.nike.running.emoji"}
+)
+
+// ExtractMetadata maps the known NRC tags into a RunMetadata
+func ExtractMetadata(tags map[string]string) types.RunMetadata {
+	return types.RunMetadata{
+		ShoeID:          findTag(tags, shoeIDTags),
+		ShoeName:        findTag(tags, shoeNameTags),
+		Note:            findTag(tags, noteTags),
+		Weather:         findTag(tags, weatherTags),
+		Temperature:     findTag(tags, temperatureTags),
+		Terrain:         findTag(tags, terrainTags),
+		PerceivedEffort: findTag(tags, perceivedEffortTags),
+		Mood:            findTag(tags, moodTags),
+	}
+}
+
+// findTag returns the value of the first tag found
+func findTag(tags map[string]string, keys []string) string {
+	for _, key := range keys {
+		if value, ok := tags[key]; ok {
+			return strings.TrimSpace(value)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,64 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/mxdc/nrc2strava/types"
+)
+
+func TestExtractMetadata(t *testing.T) {
+	tests := []struct {
+		name string
+		tags map[string]string
+		want types.RunMetadata
+	}{
+		{
+			"short tags",
+			map[string]string{
+				"shoe_id": "abc-123", "shoe_name": "Pegasus 40", "note": "Felt great", "weather": "sunny",
+				"temperature": "18", "terrain": "road", "rpe": "6", "emoji": "amped",
+			},
+			types.RunMetadata{
+				ShoeID: "abc-123", ShoeName: "Pegasus 40", Note: "Felt great", Weather: "sunny",
+				Temperature: "18", Terrain: "road", PerceivedEffort: "6", Mood: "amped",
+			},
+		},
+		{
+			"namespaced tags",
+			map[string]string{
+				"com.nike.running.shoe_id": "abc-123", "com.nike.running.shoe_name": "Pegasus 40", "com.nike.running.note": "Felt great",
+				"com.nike.weather": "sunny", "com.nike.temperature": "18", "com.nike.running.terrain": "road",
+				"com.nike.running.rpe": "6", "com.nike.running.emoji": "amped",
+			},
+			types.RunMetadata{
+				ShoeID: "abc-123", ShoeName: "Pegasus 40", Note: "Felt great", Weather: "sunny",
+				Temperature: "18", Terrain: "road", PerceivedEffort: "6", Mood: "amped",
+			},
+		},
+		// The first key of the list wins when a field is stored under several keys
+		{
+			"both keys",
+			map[string]string{"note": "short", "com.nike.running.note": "namespaced", "weather": "short", "com.nike.weather": "namespaced"},
+			types.RunMetadata{Note: "short", Weather: "namespaced"},
+		},
+		{
+			"trimmed values",
+			map[string]string{"note": "  Felt great\n", "shoe_name": " Pegasus 40 "},
+			types.RunMetadata{Note: "Felt great", ShoeName: "Pegasus 40"},
+		},
+		{
+			"missing tags",
+			map[string]string{"com.nike.name": "Morning run", "location": "outdoors"},
+			types.RunMetadata{},
+		},
+		{"no tags", nil, types.RunMetadata{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExtractMetadata(tt.tags); got != tt.want {
+				t.Errorf("ExtractMetadata() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
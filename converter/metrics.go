@@ -1,9 +1,11 @@
 package converter
 
 import (
+	"math"
 	"strings"
 	"time"
 
+	"github.com/muktihari/fit/profile/basetype"
 	"github.com/muktihari/fit/profile/mesgdef"
 	"github.com/muktihari/fit/profile/typedef"
 	"github.com/mxdc/nrc2strava/types"
@@ -20,6 +22,29 @@ type MetricsConverter struct {
 	// Outdoor or Treadmill
 	Indoor bool
 
+	// GPS track cleaning
+	GPSFilter GPSFilter
+
+	// Speed derivation
+	SpeedStrategy SpeedStrategy
+	speedSource   string
+
+	// Interval between two records, DefaultRecordInterval when 0
+	RecordInterval time.Duration
+
+	// Running power estimation, disabled when empty or PowerModelNone
+	PowerModel string
+
+	// Athlete profile used by the estimations
+	Athlete Athlete
+
+	// Source of the session calories, CaloriesSourceNRC when empty
+	CaloriesSource string
+
+	// Elevation correction, the NRC elevation is kept when nil
+	ElevationModel      ElevationModel
+	ElevationHysteresis float64
+
 	// Raw data
 	Moments   []types.Moment
 	Metrics   []types.Metric
@@ -35,6 +60,7 @@ type MetricsConverter struct {
 	StepsMetric     types.Metric
 	SpeedMetric     types.Metric
 	PaceMetric      types.Metric
+	HeartRateMetric types.Metric
 
 	// Summaries
 	SpeedSummary    types.Summary
@@ -70,8 +96,7 @@ func InitMetricsConverter(
 ) *MetricsConverter {
 	var parser MetricsConverter
 
-	parser.logger = logrus.New()
-	parser.logger.SetFormatter(utils.LogFormat)
+	parser.logger = utils.Logger
 
 	parser.StartEpochMs = StartEpochMs
 	parser.EndEpochMs = EndEpochMs
@@ -136,82 +161,11 @@ func InitMetricsConverter(
 		if metric.Type == "pace" {
 			parser.PaceMetric = metric
 		}
-	}
-	return &parser
-}
-
-func interpolateLatitude(timestamp int64, latitudeMetric types.Metric) float64 {
-	// Handle timestamps before the first interval
-	if len(latitudeMetric.Values) > 0 {
-		first := latitudeMetric.Values[0]
-		firstStartSeconds := first.StartEpochMs / 1000
-		if timestamp < firstStartSeconds {
-			return first.Value
-		}
-	}
-
-	// Iterate through latitude intervals
-	for i := 0; i < len(latitudeMetric.Values)-1; i++ {
-		current := latitudeMetric.Values[i]
-		next := latitudeMetric.Values[i+1]
-
-		// Convert start and end times to seconds
-		currentStartSeconds := current.StartEpochMs / 1000
-		nextStartSeconds := next.StartEpochMs / 1000
-
-		// Check if the timestamp falls within the current interval
-		if timestamp >= currentStartSeconds && timestamp < nextStartSeconds {
-			intervalDuration := float64(nextStartSeconds - currentStartSeconds)
-			timeElapsed := float64(timestamp - currentStartSeconds)
-			latitudeDelta := next.Value - current.Value
-			return current.Value + (latitudeDelta * (timeElapsed / intervalDuration))
-		}
-	}
-
-	// Handle timestamps after the last interval
-	last := latitudeMetric.Values[len(latitudeMetric.Values)-1]
-	if timestamp >= last.StartEpochMs/1000 {
-		return last.Value
-	}
-
-	return 0 // Default value if no match is found
-}
-
-func interpolateLongitude(timestamp int64, longitudeMetric types.Metric) float64 {
-	// Handle timestamps before the first interval
-	if len(longitudeMetric.Values) > 0 {
-		first := longitudeMetric.Values[0]
-		firstStartSeconds := first.StartEpochMs / 1000
-		if timestamp < firstStartSeconds {
-			return first.Value
-		}
-	}
-
-	// Iterate through longitude intervals
-	for i := 0; i < len(longitudeMetric.Values)-1; i++ {
-		current := longitudeMetric.Values[i]
-		next := longitudeMetric.Values[i+1]
-
-		// Convert start and end times to seconds
-		currentStartSeconds := current.StartEpochMs / 1000
-		nextStartSeconds := next.StartEpochMs / 1000
-
-		// Check if the timestamp falls within the current interval
-		if timestamp >= currentStartSeconds && timestamp < nextStartSeconds {
-			intervalDuration := float64(nextStartSeconds - currentStartSeconds)
-			timeElapsed := float64(timestamp - currentStartSeconds)
-			longitudeDelta := next.Value - current.Value
-			return current.Value + (longitudeDelta * (timeElapsed / intervalDuration))
+		if metric.Type == "heart_rate" {
+			parser.HeartRateMetric = metric
 		}
 	}
-
-	// Handle timestamps after the last interval
-	last := longitudeMetric.Values[len(longitudeMetric.Values)-1]
-	if timestamp >= last.StartEpochMs/1000 {
-		return last.Value
-	}
-
-	return 0 // Default value if no match is found
+	return &parser
 }
 
 func fillPositionFromGPS(records []*mesgdef.Record, latitudeMetric, longitudeMetric types.Metric) {
@@ -219,12 +173,15 @@ func fillPositionFromGPS(records []*mesgdef.Record, latitudeMetric, longitudeMet
 		return
 	}
 
-	for _, record := range records {
-		timestamp := record.Timestamp.Unix() // Timestamp in seconds
+	latitudes := newTimeSeries(latitudeMetric, linearInterpolation)
+	longitudes := newTimeSeries(longitudeMetric, linearInterpolation)
+	if latitudes.empty() || longitudes.empty() {
+		return
+	}
 
-		// Interpolate latitude and longitude
-		latitude := interpolateLatitude(timestamp, latitudeMetric)
-		longitude := interpolateLongitude(timestamp, longitudeMetric)
+	for _, record := range records {
+		latitude, _ := latitudes.valueAt(record.Timestamp)
+		longitude, _ := longitudes.valueAt(record.Timestamp)
 
 		// Use the library's methods to set latitude and longitude in degrees
 		record.SetPositionLatDegrees(latitude)
@@ -273,7 +230,6 @@ func convertStepsToCadence(stepsMetric types.Metric) types.Metric {
 }
 
 // fillCadenceFromSteps fills cadence for each record
-// Interpolation is not really needed here
 func fillCadenceFromSteps(records []*mesgdef.Record, stepsMetric types.Metric) {
 	if stepsMetric.Type != "steps" || len(stepsMetric.Values) == 0 {
 		return
@@ -284,184 +240,63 @@ func fillCadenceFromSteps(records []*mesgdef.Record, stepsMetric types.Metric) {
 		return
 	}
 
-	cadence := convertStepsToCadence(stepsMetric)
-
-	// Fill cadence for each record
-	for _, record := range records {
-		timestamp := record.Timestamp.Unix() // Timestamp in seconds
-
-		for i, interval := range cadence.Values {
-			// Convert start and end times to seconds
-			currentStartSeconds := interval.StartEpochMs / 1000
-			currentEndSeconds := interval.EndEpochMs / 1000
-
-			// Special case: Handle the very first interval
-			if i == 0 && timestamp >= currentStartSeconds && timestamp < currentEndSeconds {
-				// Interpolate cadence within the first interval
-				intervalDuration := float64(currentEndSeconds - currentStartSeconds)
-				timeElapsed := float64(timestamp - currentStartSeconds)
-				interpolatedCadence := interval.Value * (timeElapsed / intervalDuration)
-
-				// Set the interpolated cadence value for the record
-				record.Cadence = uint8(interpolatedCadence)
-				break
-			}
-
-			// Handle timestamps within other intervals
-			if timestamp >= currentStartSeconds && timestamp < currentEndSeconds {
-				record.Cadence = uint8(interval.Value)
-				break
-			}
-		}
-	}
-}
-
-// fillDistance fills cumulated distance for each record
-func fillDistance(records []*mesgdef.Record, distanceMetric types.Metric) {
-	if distanceMetric.Type != "distance" {
+	cadences := newTimeSeries(convertStepsToCadence(stepsMetric), stepInterpolation)
+	if cadences.empty() {
 		return
 	}
+	first := cadences.samples[0]
 
-	// Calculate cumulative distances
-	cumulativeDistanceMetric := calculateCumulativeDistanceMetric(distanceMetric)
-	first := cumulativeDistanceMetric.Values[0]
-	last := cumulativeDistanceMetric.Values[len(cumulativeDistanceMetric.Values)-1]
-
-	// Iterate through the records
 	for _, record := range records {
-		timestamp := record.Timestamp.Unix() // Timestamp in seconds
-
-		// Handle timestamps before the first interval ends
-		firstEndSeconds := first.EndEpochMs / 1000
-		if timestamp < firstEndSeconds {
-			// Calculate the proportion of time elapsed before the first interval ends
-			totalIntervalDuration := float64(firstEndSeconds - records[0].Timestamp.Unix())
-			timeElapsed := float64(timestamp - records[0].Timestamp.Unix())
-
-			// Extrapolate the distance proportionally
-			if totalIntervalDuration > 0 {
-				extrapolatedDistanceMeters := (first.Value * 1000) * (timeElapsed / totalIntervalDuration)
-
-				// Ensure the extrapolated distance is not negative
-				if extrapolatedDistanceMeters < 0 {
-					extrapolatedDistanceMeters = 0
-				}
-
-				record.SetDistanceScaled(extrapolatedDistanceMeters)
-			} else {
-				// If the interval duration is zero, set distance to 0
-				record.SetDistanceScaled(0)
-			}
+		cadence, ok := cadences.valueAt(record.Timestamp)
+		if !ok {
 			continue
 		}
 
-		// Iterate through the intervals
-		for i := 0; i < len(cumulativeDistanceMetric.Values)-1; i++ {
-			current := cumulativeDistanceMetric.Values[i]
-			next := cumulativeDistanceMetric.Values[i+1]
-
-			// Convert start and end times to seconds
-			currentEndSeconds := current.EndEpochMs / 1000
-			nextEndSeconds := next.EndEpochMs / 1000
-
-			// Handle timestamps between intervals
-			if timestamp >= currentEndSeconds && timestamp < nextEndSeconds {
-				// Calculate interval duration and time elapsed in seconds
-				intervalDuration := float64(nextEndSeconds - currentEndSeconds)
-				timeElapsed := float64(timestamp - currentEndSeconds)
-
-				distanceDeltaMeters := (next.Value - current.Value) * 1000 // Convert delta to meters
-				interpolatedDistanceMeters := (current.Value * 1000) + (distanceDeltaMeters * (timeElapsed / intervalDuration))
-
-				record.SetDistanceScaled(interpolatedDistanceMeters)
-				break
-			}
+		// The cadence ramps up during the first interval
+		if timestamp := record.Timestamp.UnixMilli(); timestamp < first.end {
+			cadence *= float64(timestamp-first.start) / float64(first.end-first.start)
 		}
 
-		// Handle timestamps after the last interval
-		lastEndSeconds := last.EndEpochMs / 1000
-		if timestamp >= lastEndSeconds {
-			// Set the last distance value using SetDistanceScaled (convert to meters)
-			record.SetDistanceScaled(last.Value * 1000)
-		}
+		record.Cadence = uint8(cadence)
 	}
 }
 
-func calculateCumulativeDistanceMetric(distanceMetric types.Metric) types.Metric {
-	cumulativeDistanceMetric := types.Metric{
-		Type:   "cumulative_distance",
-		Unit:   "KM",
-		Values: []types.MetricValue{},
+// fillDistance fills cumulated distance for each record
+func fillDistance(records []*mesgdef.Record, distanceMetric types.Metric) {
+	if distanceMetric.Type != "distance" {
+		return
 	}
 
-	// Calculate cumulative distances
-	cumulativeDistance := 0.0
-	for _, value := range distanceMetric.Values {
-		cumulativeDistance += value.Value
-		cumulativeDistanceMetric.Values = append(cumulativeDistanceMetric.Values, types.MetricValue{
-			StartEpochMs: value.StartEpochMs,
-			EndEpochMs:   value.EndEpochMs,
-			Value:        cumulativeDistance,
-		})
+	// Cumulate the distances in kilometers, converted to meters
+	distances := newTimeSeries(distanceMetric, cumulativeInterpolation)
+	if distances.empty() {
+		return
 	}
+	distances.factor = 1000
 
-	return cumulativeDistanceMetric
+	for _, record := range records {
+		distance, _ := distances.valueAt(record.Timestamp)
+		record.SetDistanceScaled(distance)
+	}
 }
 
 // fillElevation fills altitude for each record
 func fillElevation(records []*mesgdef.Record, elevationMetric types.Metric) {
-	if elevationMetric.Type != "elevation" || len(elevationMetric.Values) == 0 {
+	if elevationMetric.Type != "elevation" {
 		return
 	}
 
-	for _, record := range records {
-		timestamp := record.Timestamp.Unix() // Timestamp in seconds
-
-		// Handle timestamps before the first interval
-		first := elevationMetric.Values[0]
-		firstStartSeconds := first.StartEpochMs / 1000
-		if timestamp < firstStartSeconds {
-			// Set the altitude to the first interval's start value
-			record.SetAltitudeScaled(first.Value)
-			record.SetEnhancedAltitudeScaled(first.Value)
-			continue
-		}
+	elevations := newTimeSeries(elevationMetric, linearInterpolation)
+	if elevations.empty() {
+		return
+	}
 
-		// Iterate through elevation intervals
-		for i := 0; i < len(elevationMetric.Values)-1; i++ {
-			current := elevationMetric.Values[i]
-			next := elevationMetric.Values[i+1]
-
-			// Convert start and end times to seconds
-			currentStartSeconds := current.StartEpochMs / 1000
-			nextStartSeconds := next.StartEpochMs / 1000
-
-			// Check if the record's timestamp falls within the current interval
-			if timestamp >= currentStartSeconds && timestamp < nextStartSeconds {
-				// Calculate interval duration and time elapsed in seconds
-				intervalDuration := float64(nextStartSeconds - currentStartSeconds)
-				timeElapsed := float64(timestamp - currentStartSeconds)
-
-				// Interpolate the elevation value
-				elevationDelta := next.Value - current.Value
-				interpolatedElevation := current.Value + (elevationDelta * (timeElapsed / intervalDuration))
-
-				// Use the library's methods to set scaled altitude values
-				record.SetAltitudeScaled(interpolatedElevation)
-				record.SetEnhancedAltitudeScaled(interpolatedElevation)
-				break
-			}
-		}
+	for _, record := range records {
+		elevation, _ := elevations.valueAt(record.Timestamp)
 
-		// Handle timestamps after the last interval
-		if len(elevationMetric.Values) > 0 {
-			last := elevationMetric.Values[len(elevationMetric.Values)-1]
-			if timestamp >= last.StartEpochMs/1000 {
-				// Use the library's methods to set the last altitude value
-				record.SetAltitudeScaled(last.Value)
-				record.SetEnhancedAltitudeScaled(last.Value)
-			}
-		}
+		// Use the library's methods to set scaled altitude values
+		record.SetAltitudeScaled(elevation)
+		record.SetEnhancedAltitudeScaled(elevation)
 	}
 }
 
@@ -510,20 +345,46 @@ func (m *MetricsConverter) ParseSession(records []*mesgdef.Record) *mesgdef.Sess
 		session.SetTotalDistanceScaled(m.DistanceSummary.Value * 1000)
 	}
 
-	if m.AscentSummary.Metric == "ascent" {
-		session.SetTotalAscent(uint16(m.AscentSummary.Value))
+	// Recompute the ascent and descent from the corrected altitude
+	ascent, descent, ok := computeAscentDescent(records, m.ElevationHysteresis)
+	if m.ElevationModel != nil && ok {
+		session.SetTotalAscent(uint16(math.Round(ascent)))
+		session.SetTotalDescent(uint16(math.Round(descent)))
+	} else {
+		if m.AscentSummary.Metric == "ascent" {
+			session.SetTotalAscent(uint16(m.AscentSummary.Value))
+		}
+
+		if m.DescentSummary.Metric == "descent" {
+			session.SetTotalDescent(uint16(m.DescentSummary.Value))
+		}
 	}
 
-	if m.DescentSummary.Metric == "descent" {
-		session.SetTotalDescent(uint16(m.DescentSummary.Value))
+	if avgHeartRate, maxHeartRate, ok := computeHeartRate(records); ok {
+		session.SetAvgHeartRate(uint8(math.Round(avgHeartRate)))
+		session.SetMaxHeartRate(maxHeartRate)
 	}
 
-	if m.CaloriesSummary.Metric == "calories" {
+	// Estimate the calories when NRC has none, or when configured
+	if m.CaloriesSource != CaloriesSourceEstimate && m.CaloriesSummary.Metric == "calories" {
 		session.SetTotalCalories(uint16(m.CaloriesSummary.Value))
+	} else {
+		ascent := 0.0
+		if session.TotalAscent != basetype.Uint16Invalid {
+			ascent = float64(session.TotalAscent)
+		}
+		calories := estimateCalories(records, m.Athlete, m.DistanceSummary.Value*1000, ascent, m.ActiveDurationMs)
+		session.SetTotalCalories(uint16(math.Round(min(calories, float64(basetype.Uint16Invalid-1)))))
 	}
 
-	if m.SpeedSummary.Metric == "speed" {
+	// Average speed from the same source as the record speeds
+	derivedSpeed := m.speedSource == SpeedSourceRolling || m.speedSource == SpeedSourceDistance
+	if derivedSpeed && m.DistanceSummary.Metric == "distance" && m.ActiveDurationMs > 0 {
+		session.SetAvgSpeedScaled(m.DistanceSummary.Value * 1000 / (float64(m.ActiveDurationMs) / 1000))
+	} else if m.SpeedSummary.Metric == "speed" {
 		session.SetAvgSpeedScaled(m.SpeedSummary.Value / 3.6)
+	} else if avgSpeed := computeAvgSpeed(records); avgSpeed > 0 {
+		session.SetAvgSpeedScaled(avgSpeed)
 	}
 
 	if m.StepsSummary.Metric == "steps" && m.StepsSummary.Value > 0 {
@@ -536,6 +397,12 @@ func (m *MetricsConverter) ParseSession(records []*mesgdef.Record) *mesgdef.Sess
 		}
 	}
 
+	if avgPower, maxPower, normalizedPower, ok := computePower(records); ok {
+		session.SetAvgPower(uint16(math.Round(avgPower)))
+		session.SetMaxPower(uint16(maxPower))
+		session.SetNormalizedPower(uint16(math.Round(normalizedPower)))
+	}
+
 	// Set sport and subsport
 	session.SetSport(typedef.SportRunning)
 	if m.Indoor {
@@ -554,24 +421,29 @@ func (m *MetricsConverter) ParseSession(records []*mesgdef.Record) *mesgdef.Sess
 }
 
 func (m *MetricsConverter) ParseRecords() []*mesgdef.Record {
-	// Convert milliseconds to seconds
-	StartEpochSeconds := m.StartEpochMs / 1000
-	EndEpochSeconds := m.EndEpochMs / 1000
-	totalRecords := EndEpochSeconds - StartEpochSeconds + 1
-	m.logger.Debugf("Number of records: %d\n", totalRecords)
-
-	records := make([]*mesgdef.Record, totalRecords)
-	for i := range totalRecords {
-		timestamp := time.Unix(StartEpochSeconds+i, 0).UTC()
+	times := recordTimes(m.StartEpochMs, m.EndEpochMs, m.RecordInterval, m.Metrics)
+	m.logger.Debugf("Number of records: %d\n", len(times))
+
+	records := make([]*mesgdef.Record, len(times))
+	for i, timestamp := range times {
 		records[i] = mesgdef.NewRecord(nil)
-		records[i].SetTimestamp(timestamp)
+		records[i].SetTimestamp(utils.ParseTimeInMs(timestamp))
 	}
 
 	fillCadenceFromSteps(records, m.StepsMetric)
 	fillDistance(records, m.DistanceMetric)
-	fillPositionFromGPS(records, m.LatitudeMetric, m.LongitudeMetric)
+	latitudeMetric, longitudeMetric := filterGPS(m.LatitudeMetric, m.LongitudeMetric, m.GPSFilter)
+	fillPositionFromGPS(records, latitudeMetric, longitudeMetric)
 	fillElevation(records, m.ElevationMetric)
-	fillSpeedFromDistance(records)
+	fillHeartRate(records, m.HeartRateMetric)
+	if m.ElevationModel != nil {
+		corrected := fillElevationFromModel(records, m.ElevationModel)
+		m.logger.Debugf("Corrected altitude of %d/%d records\n", corrected, len(records))
+	}
+	m.speedSource = m.fillSpeed(records)
+	m.logger.Debugf("Speed source: %s\n", m.speedSource)
+	capSpeed(records, m.GPSFilter.MaxSpeed)
+	fillPower(records, m.PowerModel, m.Athlete.weight(), m.Indoor)
 
 	return records
 }
@@ -0,0 +1,311 @@
+package converter
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/muktihari/fit/profile/basetype"
+	"github.com/muktihari/fit/profile/mesgdef"
+	"github.com/mxdc/nrc2strava/types"
+)
+
+// fuzzStartSeconds is the start of the metrics built from the fuzz inputs
+const fuzzStartSeconds = 1704096000
+
+// newTestRecords returns a record per second from the start, without any value
+func newTestRecords(startSeconds int64, count int) []*mesgdef.Record {
+	records := make([]*mesgdef.Record, count)
+	for i := range records {
+		records[i] = mesgdef.NewRecord(nil).SetTimestamp(time.Unix(startSeconds+int64(i), 0).UTC())
+	}
+	return records
+}
+
+// metricFromBytes builds a metric of sorted values from the fuzz input, 4 bytes per value:
+// the gap and the length of the interval in seconds (0 for a zero-length interval), then the value.
+// The values of instant metrics like the GPS have the same start and end.
+func metricFromBytes(metricType string, data []byte, instant bool, scale func(uint16) float64) types.Metric {
+	metric := types.Metric{Type: metricType, Values: []types.MetricValue{}}
+
+	startMs := int64(fuzzStartSeconds * 1000)
+	for i := 0; i+4 <= len(data); i += 4 {
+		startMs += int64(data[i]%30) * 1000
+		endMs := startMs + int64(data[i+1]%30)*1000
+		if instant {
+			endMs = startMs
+		}
+
+		metric.Values = append(metric.Values, types.MetricValue{
+			StartEpochMs: startMs,
+			EndEpochMs:   endMs,
+			Value:        scale(uint16(data[i+2])<<8 | uint16(data[i+3])),
+		})
+		startMs = endMs
+	}
+
+	return metric
+}
+
+// recordsAround returns records covering the metric, from a few seconds before to a few seconds after
+func recordsAround(metric types.Metric) []*mesgdef.Record {
+	count := 10
+	if len(metric.Values) > 0 {
+		last := metric.Values[len(metric.Values)-1]
+		count += int(last.EndEpochMs/1000-fuzzStartSeconds) + 5
+	}
+	return newTestRecords(fuzzStartSeconds-5, count)
+}
+
+func valueRange(metric types.Metric) (float64, float64) {
+	minValue, maxValue := math.Inf(1), math.Inf(-1)
+	for _, value := range metric.Values {
+		minValue = math.Min(minValue, value.Value)
+		maxValue = math.Max(maxValue, value.Value)
+	}
+	return minValue, maxValue
+}
+
+// edgeCases are the seeds of the fuzz tests
+var edgeCases = [][]byte{
+	// empty metric
+	{},
+	// single value
+	{0, 10, 0, 100},
+	// zero-length intervals
+	{0, 0, 0, 100, 0, 0, 0, 200, 5, 0, 1, 0},
+	// regular intervals
+	{0, 10, 0, 30, 0, 10, 0, 32, 0, 10, 0, 28, 0, 10, 0, 31},
+	// gaps between the intervals, like a pause
+	{0, 10, 0, 30, 20, 10, 0, 30, 0, 1, 0, 3},
+	// large values
+	{0, 29, 255, 255, 29, 29, 255, 255},
+}
+
+func FuzzFillDistance(f *testing.F) {
+	for _, seed := range edgeCases {
+		f.Add(seed)
+	}
+
+	f.Fuzz(checkFillDistance)
+}
+
+func checkFillDistance(t *testing.T, data []byte) {
+	// Distances of NRC intervals, in km
+	distanceMetric := metricFromBytes("distance", data, false, func(v uint16) float64 { return float64(v) / 10000 })
+	records := recordsAround(distanceMetric)
+
+	fillDistance(records, distanceMetric)
+
+	total := 0.0
+	for _, value := range distanceMetric.Values {
+		total += value.Value * 1000
+	}
+
+	previous := 0.0
+	for _, record := range records {
+		if record.Distance == basetype.Uint32Invalid {
+			continue
+		}
+
+		distance := record.DistanceScaled()
+		if distance < previous-0.01 {
+			t.Fatalf("distance decreases at %s: %.2f after %.2f", record.Timestamp, distance, previous)
+		}
+		if distance < 0 || distance > total+0.01 {
+			t.Fatalf("distance %.2f at %s out of [0, %.2f]", distance, record.Timestamp, total)
+		}
+		previous = distance
+	}
+}
+
+// TestFillDistanceDuringPause checks the distance does not grow while the run is paused
+func TestFillDistanceDuringPause(t *testing.T) {
+	startMs := int64(fuzzStartSeconds * 1000)
+	distanceMetric := types.Metric{Type: "distance", Values: []types.MetricValue{
+		{StartEpochMs: startMs, EndEpochMs: startMs + 10000, Value: 0.03},
+		// paused from 10s to 70s
+		{StartEpochMs: startMs + 70000, EndEpochMs: startMs + 80000, Value: 0.03},
+	}}
+	records := newTestRecords(fuzzStartSeconds, 81)
+
+	fillDistance(records, distanceMetric)
+
+	for _, record := range records[10:71] {
+		if distance := record.DistanceScaled(); distance != 30 {
+			t.Errorf("distance at %s = %.2f during the pause, want 30", record.Timestamp, distance)
+		}
+	}
+	if distance := records[75].DistanceScaled(); distance != 45 {
+		t.Errorf("distance at %s = %.2f after the pause, want 45", records[75].Timestamp, distance)
+	}
+	if distance := records[80].DistanceScaled(); distance != 60 {
+		t.Errorf("distance at the end = %.2f, want 60", distance)
+	}
+}
+
+func FuzzFillPositionFromGPS(f *testing.F) {
+	for _, seed := range edgeCases {
+		f.Add(seed, seed)
+	}
+
+	f.Fuzz(checkFillPositionFromGPS)
+}
+
+func checkFillPositionFromGPS(t *testing.T, latitudeData, longitudeData []byte) {
+	latitudeMetric := metricFromBytes("latitude", latitudeData, true, func(v uint16) float64 { return float64(v)/65535*180 - 90 })
+	// 180° is the same semicircle as -180°, the longitudes stay below
+	longitudeMetric := metricFromBytes("longitude", longitudeData, true, func(v uint16) float64 { return float64(v)/65536*360 - 180 })
+	records := recordsAround(latitudeMetric)
+
+	fillPositionFromGPS(records, latitudeMetric, longitudeMetric)
+
+	minLatitude, maxLatitude := valueRange(latitudeMetric)
+	minLongitude, maxLongitude := valueRange(longitudeMetric)
+
+	// The semicircles round the degrees to about 1e-7
+	const tolerance = 1e-6
+	for _, record := range records {
+		if record.PositionLat == basetype.Sint32Invalid {
+			continue
+		}
+
+		latitude := record.PositionLatDegrees()
+		if latitude < minLatitude-tolerance || latitude > maxLatitude+tolerance {
+			t.Fatalf("latitude %f at %s out of [%f, %f]", latitude, record.Timestamp, minLatitude, maxLatitude)
+		}
+
+		longitude := record.PositionLongDegrees()
+		if longitude < minLongitude-tolerance || longitude > maxLongitude+tolerance {
+			t.Fatalf("longitude %f at %s out of [%f, %f]", longitude, record.Timestamp, minLongitude, maxLongitude)
+		}
+	}
+}
+
+func FuzzFillElevation(f *testing.F) {
+	for _, seed := range edgeCases {
+		f.Add(seed)
+	}
+
+	f.Fuzz(checkFillElevation)
+}
+
+func checkFillElevation(t *testing.T, data []byte) {
+	// Elevations from -100 to 6453m
+	elevationMetric := metricFromBytes("elevation", data, true, func(v uint16) float64 { return float64(v)/10 - 100 })
+	records := recordsAround(elevationMetric)
+
+	fillElevation(records, elevationMetric)
+
+	minElevation, maxElevation := valueRange(elevationMetric)
+
+	// The altitude is stored with a 0.2m resolution
+	const tolerance = 0.2
+	for _, record := range records {
+		if record.Altitude == basetype.Uint16Invalid {
+			continue
+		}
+
+		altitude := record.AltitudeScaled()
+		if altitude < minElevation-tolerance || altitude > maxElevation+tolerance {
+			t.Fatalf("altitude %.1f at %s out of [%.1f, %.1f]", altitude, record.Timestamp, minElevation, maxElevation)
+		}
+	}
+}
+
+func FuzzFillCadenceFromSteps(f *testing.F) {
+	for _, seed := range edgeCases {
+		f.Add(seed)
+	}
+
+	f.Fuzz(checkFillCadenceFromSteps)
+}
+
+func checkFillCadenceFromSteps(t *testing.T, data []byte) {
+	stepsMetric := metricFromBytes("steps", data, false, func(v uint16) float64 { return float64(v) / 100 })
+	records := recordsAround(stepsMetric)
+
+	fillCadenceFromSteps(records, stepsMetric)
+
+	for _, record := range records {
+		if record.Cadence != basetype.Uint8Invalid && record.Cadence > 180 {
+			t.Fatalf("cadence %d at %s above 180rpm", record.Cadence, record.Timestamp)
+		}
+	}
+}
+
+// TestParseRecordsWithoutValues converts an activity whose metrics have no values, or a single zero value
+func TestParseRecordsWithoutValues(t *testing.T) {
+	startMs := int64(fuzzStartSeconds * 1000)
+	for _, values := range [][]types.MetricValue{
+		{},
+		{{StartEpochMs: startMs, EndEpochMs: startMs + 60000, Value: 0}},
+	} {
+		metrics := []types.Metric{}
+		for _, metricType := range []string{"distance", "steps", "speed", "pace", "latitude", "longitude", "elevation"} {
+			metrics = append(metrics, types.Metric{Type: metricType, Values: values})
+		}
+
+		metricsConverter := InitMetricsConverter(startMs, startMs+60000, 60000, metrics, nil, nil, nil)
+		records := metricsConverter.ParseRecords()
+		if len(records) != 61 {
+			t.Fatalf("ParseRecords() returned %d records, want 61", len(records))
+		}
+
+		session := metricsConverter.ParseSession(records)
+		if session.TotalElapsedTimeScaled() != 60 {
+			t.Errorf("session elapsed time = %.0f, want 60", session.TotalElapsedTimeScaled())
+		}
+	}
+}
+
+// TestInterpolationProperties checks the invariants of the fuzz tests on random metrics
+func TestInterpolationProperties(t *testing.T) {
+	random := rand.New(rand.NewPCG(1, 2))
+	randomBytes := func() []byte {
+		data := make([]byte, random.IntN(400))
+		for i := range data {
+			data[i] = byte(random.UintN(256))
+		}
+		return data
+	}
+
+	for range 500 {
+		checkFillDistance(t, randomBytes())
+		checkFillPositionFromGPS(t, randomBytes(), randomBytes())
+		checkFillElevation(t, randomBytes())
+		checkFillCadenceFromSteps(t, randomBytes())
+	}
+}
+
+func TestFillPositionWithoutValues(t *testing.T) {
+	records := newTestRecords(fuzzStartSeconds, 10)
+	empty := types.Metric{Type: "latitude", Values: []types.MetricValue{}}
+	longitudeMetric := metricFromBytes("longitude", edgeCases[1], true, func(v uint16) float64 { return float64(v) / 100 })
+
+	fillPositionFromGPS(records, empty, longitudeMetric)
+
+	for _, record := range records {
+		if record.PositionLat != basetype.Sint32Invalid || record.PositionLong != basetype.Sint32Invalid {
+			t.Fatalf("position set at %s without latitudes", record.Timestamp)
+		}
+	}
+}
+
+// TestParseRecordsEndBeforeStart converts an activity whose end precedes its start
+func TestParseRecordsEndBeforeStart(t *testing.T) {
+	startMs := int64(fuzzStartSeconds * 1000)
+	metrics := []types.Metric{{
+		Type:   "distance",
+		Values: []types.MetricValue{{StartEpochMs: startMs, EndEpochMs: startMs + 10000, Value: 0.03}},
+	}}
+
+	metricsConverter := InitMetricsConverter(startMs, startMs-60000, 0, metrics, nil, nil, nil)
+	records := metricsConverter.ParseRecords()
+	if len(records) != 1 {
+		t.Fatalf("ParseRecords() returned %d records, want 1", len(records))
+	}
+
+	metricsConverter.ParseSession(records)
+}
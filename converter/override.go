@@ -0,0 +1,93 @@
+package converter
+
+import (
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/muktihari/fit/profile/typedef"
+	"github.com/mxdc/nrc2strava/types"
+)
+
+// IsExcluded reports whether an override excludes the activity from the conversion
+func (c *ActivitiesConverter) IsExcluded(nikeActivity *types.Activity) bool {
+	override, ok := c.Overrides[nikeActivity.ID]
+	return ok && override.Exclude
+}
+
+// applyOverride returns a copy of the activity with the title, location and start time overridden.
+// The override is checked before any change, so that an invalid override leaves nothing half applied.
+func applyOverride(nikeActivity *types.Activity, override types.Override) (*types.Activity, error) {
+	var shift time.Duration
+	if len(override.StartShift) > 0 {
+		var err error
+		if shift, err = time.ParseDuration(override.StartShift); err != nil {
+			return nil, fmt.Errorf("invalid start shift %q: %w", override.StartShift, err)
+		}
+	}
+
+	if _, ok := overrideSport(override); len(override.Sport) > 0 && !ok {
+		return nil, fmt.Errorf("unknown sport %q", override.Sport)
+	}
+
+	overridden := *nikeActivity
+	overridden.Tags = maps.Clone(nikeActivity.Tags)
+	if overridden.Tags == nil {
+		overridden.Tags = map[string]string{}
+	}
+
+	if len(override.Title) > 0 {
+		overridden.Tags["com.nike.name"] = override.Title
+	}
+
+	if override.Indoor != nil {
+		if *override.Indoor {
+			overridden.Tags["location"] = "indoors"
+		} else {
+			overridden.Tags["location"] = "outdoors"
+		}
+	}
+
+	if shift != 0 {
+		shiftActivity(&overridden, shift.Milliseconds())
+	}
+
+	return &overridden, nil
+}
+
+// shiftActivity moves every timestamp of the activity by shiftMs milliseconds
+func shiftActivity(nikeActivity *types.Activity, shiftMs int64) {
+	nikeActivity.StartEpochMs += shiftMs
+	nikeActivity.EndEpochMs += shiftMs
+
+	metrics := make([]types.Metric, len(nikeActivity.Metrics))
+	for i, metric := range nikeActivity.Metrics {
+		metrics[i] = metric
+		metrics[i].Values = make([]types.MetricValue, len(metric.Values))
+		for j, value := range metric.Values {
+			metrics[i].Values[j] = types.MetricValue{
+				StartEpochMs: value.StartEpochMs + shiftMs,
+				EndEpochMs:   value.EndEpochMs + shiftMs,
+				Value:        value.Value,
+			}
+		}
+	}
+	nikeActivity.Metrics = metrics
+
+	moments := make([]types.Moment, len(nikeActivity.Moments))
+	for i, moment := range nikeActivity.Moments {
+		moments[i] = moment
+		moments[i].Timestamp += shiftMs
+	}
+	nikeActivity.Moments = moments
+}
+
+// overrideSport returns the FIT sport of the override, or false if it's unknown or not set
+func overrideSport(override types.Override) (typedef.Sport, bool) {
+	if len(override.Sport) == 0 {
+		return typedef.SportInvalid, false
+	}
+
+	sport := typedef.SportFromString(override.Sport)
+	return sport, sport != typedef.SportInvalid
+}
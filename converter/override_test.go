@@ -0,0 +1,207 @@
+package converter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/muktihari/fit/profile/typedef"
+	"github.com/mxdc/nrc2strava/fit"
+	"github.com/mxdc/nrc2strava/parser"
+	"github.com/mxdc/nrc2strava/types"
+)
+
+const outdoorID = "c0a1b2c3-0001-4000-8000-000000000001"
+
+// parseCorpusRun parses the NRC activity of the corpus
+func parseCorpusRun(t *testing.T, name string) *types.Activity {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", "corpus", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	nikeActivity, err := parser.ParseActivity(f)
+	if err != nil {
+		t.Fatalf("ParseActivity() error = %v", err)
+	}
+	return nikeActivity
+}
+
+// newShiftActivity returns an activity with a metric and a moment
+func newShiftActivity() *types.Activity {
+	return &types.Activity{
+		ID:           "run",
+		StartEpochMs: 1000,
+		EndEpochMs:   5000,
+		Tags:         map[string]string{"com.nike.name": "Morning run", "location": "outdoors"},
+		Metrics: []types.Metric{{Type: "distance", Values: []types.MetricValue{
+			{StartEpochMs: 1000, EndEpochMs: 3000, Value: 0.5},
+			{StartEpochMs: 3000, EndEpochMs: 5000, Value: 0.5},
+		}}},
+		Moments: []types.Moment{{Key: "halt", Value: "pause", Timestamp: 2000}},
+	}
+}
+
+func TestShiftActivity(t *testing.T) {
+	original := newShiftActivity()
+	shifted := *original
+	shiftActivity(&shifted, -3600000)
+
+	if shifted.StartEpochMs != -3599000 || shifted.EndEpochMs != -3595000 {
+		t.Errorf("start and end = %d, %d, want -3599000, -3595000", shifted.StartEpochMs, shifted.EndEpochMs)
+	}
+	wantValues := []types.MetricValue{
+		{StartEpochMs: -3599000, EndEpochMs: -3597000, Value: 0.5},
+		{StartEpochMs: -3597000, EndEpochMs: -3595000, Value: 0.5},
+	}
+	if !reflect.DeepEqual(shifted.Metrics[0].Values, wantValues) || shifted.Metrics[0].Type != "distance" {
+		t.Errorf("metric = %+v, want the values %+v", shifted.Metrics[0], wantValues)
+	}
+	if moment := shifted.Moments[0]; moment.Timestamp != -3598000 || moment.Value != "pause" {
+		t.Errorf("moment = %+v, want the pause at -3598000", moment)
+	}
+
+	// The metrics and moments are copied, the original activity is left as is
+	if !reflect.DeepEqual(original, newShiftActivity()) {
+		t.Errorf("original activity changed to %+v", original)
+	}
+}
+
+func TestOverrideSport(t *testing.T) {
+	tests := []struct {
+		sport string
+		want  typedef.Sport
+		ok    bool
+	}{
+		{"running", typedef.SportRunning, true},
+		{"walking", typedef.SportWalking, true},
+		{"hiking", typedef.SportHiking, true},
+		{"jogging", typedef.SportInvalid, false},
+		{"", typedef.SportInvalid, false},
+	}
+
+	for _, tt := range tests {
+		if got, ok := overrideSport(types.Override{Sport: tt.sport}); got != tt.want || ok != tt.ok {
+			t.Errorf("overrideSport(%q) = %v, %t, want %v, %t", tt.sport, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestApplyOverride(t *testing.T) {
+	indoor, outdoor := true, false
+
+	tests := []struct {
+		name     string
+		override types.Override
+		title    string
+		location string
+		startMs  int64
+		wantErr  bool
+	}{
+		{"empty", types.Override{}, "Morning run", "outdoors", 1000, false},
+		{"title", types.Override{Title: "Race"}, "Race", "outdoors", 1000, false},
+		{"indoor", types.Override{Indoor: &indoor}, "Morning run", "indoors", 1000, false},
+		{"outdoor", types.Override{Indoor: &outdoor}, "Morning run", "outdoors", 1000, false},
+		{"start shift", types.Override{Title: "Race", StartShift: "30s"}, "Race", "outdoors", 31000, false},
+		{"invalid start shift", types.Override{Title: "Race", StartShift: "abc"}, "", "", 0, true},
+		{"unknown sport", types.Override{Title: "Race", Sport: "jogging"}, "", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := newShiftActivity()
+			overridden, err := applyOverride(original, tt.override)
+
+			// The original activity is never changed
+			if !reflect.DeepEqual(original, newShiftActivity()) {
+				t.Errorf("original activity changed to %+v", original)
+			}
+
+			if tt.wantErr {
+				if err == nil || overridden != nil {
+					t.Errorf("applyOverride() = %+v, %v, want an error", overridden, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyOverride() error = %v", err)
+			}
+			if title := overridden.Tags["com.nike.name"]; title != tt.title {
+				t.Errorf("title = %q, want %q", title, tt.title)
+			}
+			if location := overridden.Tags["location"]; location != tt.location {
+				t.Errorf("location = %q, want %q", location, tt.location)
+			}
+			if overridden.StartEpochMs != tt.startMs || overridden.Moments[0].Timestamp != tt.startMs+1000 {
+				t.Errorf("start = %d, moment at %d, want %d, %d", overridden.StartEpochMs, overridden.Moments[0].Timestamp, tt.startMs, tt.startMs+1000)
+			}
+		})
+	}
+}
+
+// TestConvertRunOverride checks a valid override is applied as a whole, and an invalid one not at all
+func TestConvertRunOverride(t *testing.T) {
+	convert := func(override *types.Override) types.Run {
+		activitiesConverter := InitActivitiesConverter()
+		if override != nil {
+			activitiesConverter.Overrides = map[string]types.Override{outdoorID: *override}
+		}
+		return activitiesConverter.ConvertRun(parseCorpusRun(t, "outdoor"))
+	}
+	raw := convert(nil).Activity
+
+	override := types.Override{Title: "Race", Description: "Race day", Gear: "g1", Sport: "walking", Distance: 10, StartShift: "-1h"}
+	tests := []struct {
+		name     string
+		override types.Override
+		applied  bool
+	}{
+		{"valid", override, true},
+		{"invalid start shift", func() types.Override { o := override; o.StartShift = "abc"; return o }(), false},
+		{"unknown sport", func() types.Override { o := override; o.Sport = "jogging"; return o }(), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			activity := convert(&tt.override).Activity
+			session := activity.Sessions[0]
+
+			want := struct {
+				title, description, gear string
+				sport                    typedef.Sport
+				distance                 uint32
+				startTime                int64
+			}{
+				fit.DeveloperFieldValue(raw.Sessions[0].DeveloperFields, fit.FieldTitle), "", "",
+				raw.Sessions[0].Sport, raw.Sessions[0].TotalDistance, raw.Sessions[0].StartTime.Unix(),
+			}
+			if tt.applied {
+				want.title, want.description, want.gear = "Race", "Race day", "g1"
+				want.sport, want.distance, want.startTime = typedef.SportWalking, 1000000, want.startTime-3600
+			}
+
+			if got := fit.DeveloperFieldValue(session.DeveloperFields, fit.FieldTitle); got != want.title {
+				t.Errorf("title = %q, want %q", got, want.title)
+			}
+			if got := fit.DeveloperFieldValue(session.DeveloperFields, fit.FieldDescription); got != want.description {
+				t.Errorf("description = %q, want %q", got, want.description)
+			}
+			if got := fit.DeveloperFieldValue(session.DeveloperFields, fit.FieldGearID); got != want.gear {
+				t.Errorf("gear = %q, want %q", got, want.gear)
+			}
+			if session.Sport != want.sport {
+				t.Errorf("sport = %v, want %v", session.Sport, want.sport)
+			}
+			if session.TotalDistance != want.distance {
+				t.Errorf("distance = %d, want %d", session.TotalDistance, want.distance)
+			}
+			if got := session.StartTime.Unix(); got != want.startTime {
+				t.Errorf("start time = %d, want %d", got, want.startTime)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package converter
+
+import (
+	"math"
+	"time"
+
+	"github.com/muktihari/fit/profile/basetype"
+	"github.com/muktihari/fit/profile/mesgdef"
+)
+
+// Running power models
+const (
+	// PowerModelNone doesn't estimate the power
+	PowerModelNone = "none"
+	// PowerModelStryd estimates the mechanical power like a Stryd footpod: flat running cost, climbing and air resistance
+	PowerModelStryd = "stryd"
+	// PowerModelACSM converts the ACSM metabolic equation of running into mechanical power
+	PowerModelACSM = "acsm"
+)
+
+const (
+	// gravity in m/s²
+	gravity = 9.81
+
+	// flatRunningCost is the mechanical power of flat running in W/kg per m/s
+	flatRunningCost = 1.04
+
+	// airDragFactor is half the air density times the drag area of a runner, in kg/m
+	airDragFactor = 0.5 * 1.225 * 0.24
+
+	// oxygenEnergy is the energy released per ml of oxygen, in J
+	oxygenEnergy = 20.1
+
+	// muscularEfficiency converts the metabolic power into mechanical power
+	muscularEfficiency = 0.25
+
+	// gradeWindow is the time around each record over which the grade is computed
+	gradeWindow = 5 * time.Second
+
+	// minGradeDistance is the distance in meters below which the grade is considered flat
+	minGradeDistance = 10.0
+
+	// maxGrade caps the grade of the altitude glitches
+	maxGrade = 0.45
+
+	// normalizedPowerWindow is the rolling window of the normalized power
+	normalizedPowerWindow = 30 * time.Second
+)
+
+// fillPower estimates the power of each record from its speed and the grade of the altitude,
+// the treadmill runs are considered flat
+func fillPower(records []*mesgdef.Record, model string, weight float64, indoor bool) {
+	if model != PowerModelStryd && model != PowerModelACSM {
+		return
+	}
+
+	grades := make([]float64, len(records))
+	if !indoor {
+		grades = computeGrades(records)
+	}
+
+	for i, record := range records {
+		speed := record.SpeedScaled()
+		if math.IsNaN(speed) || speed <= 0 {
+			record.SetPower(0)
+			continue
+		}
+
+		var power float64
+		if model == PowerModelACSM {
+			power = acsmPower(speed, grades[i], weight)
+		} else {
+			power = strydPower(speed, grades[i], weight)
+		}
+
+		record.SetPower(uint16(math.Round(min(max(power, 0), float64(basetype.Uint16Invalid-1)))))
+	}
+}
+
+// strydPower returns the power of the horizontal running, the climbing and the air resistance
+func strydPower(speed, grade, weight float64) float64 {
+	return weight*flatRunningCost*speed + weight*gravity*speed*grade + airDragFactor*math.Pow(speed, 3)
+}
+
+// acsmPower converts the net oxygen cost of the ACSM running equation into mechanical power.
+// The equation only covers the uphill grades, the downhill ones count as flat.
+func acsmPower(speed, grade, weight float64) float64 {
+	metersPerMinute := speed * 60
+	oxygenCost := 0.2*metersPerMinute + 0.9*metersPerMinute*max(grade, 0) // ml/kg/min
+	return oxygenCost * oxygenEnergy / 60 * weight * muscularEfficiency
+}
+
+// computeGrades returns the grade of each record over a window centered on it, 0 without altitude or distance
+func computeGrades(records []*mesgdef.Record) []float64 {
+	grades := make([]float64, len(records))
+	halfWindow := gradeWindow / 2
+
+	first, last := 0, 0
+	for i, record := range records {
+		for records[first].Timestamp.Before(record.Timestamp.Add(-halfWindow)) {
+			first++
+		}
+		for last+1 < len(records) && !records[last+1].Timestamp.After(record.Timestamp.Add(halfWindow)) {
+			last++
+		}
+
+		altitudeDelta := records[last].EnhancedAltitudeScaled() - records[first].EnhancedAltitudeScaled()
+		distanceDelta := records[last].DistanceScaled() - records[first].DistanceScaled()
+		if math.IsNaN(altitudeDelta) || math.IsNaN(distanceDelta) || distanceDelta < minGradeDistance {
+			continue
+		}
+
+		grades[i] = max(min(altitudeDelta/distanceDelta, maxGrade), -maxGrade)
+	}
+
+	return grades
+}
+
+// computePower returns the average, max and normalized power of the records, weighted by their duration.
+// It returns false when the records have no power.
+func computePower(records []*mesgdef.Record) (float64, float64, float64, bool) {
+	var total, duration, maxPower float64
+	var totalFourth, durationFourth, rollingTotal, rollingDuration float64
+
+	first := 1
+	for i := 1; i < len(records); i++ {
+		if records[i].Power == basetype.Uint16Invalid {
+			continue
+		}
+
+		power := float64(records[i].Power)
+		seconds := records[i].Timestamp.Sub(records[i-1].Timestamp).Seconds()
+		total += power * seconds
+		duration += seconds
+		maxPower = max(maxPower, power)
+
+		// The normalized power is the fourth root of the mean of the 30s rolling average to the fourth power
+		rollingTotal += power * seconds
+		rollingDuration += seconds
+		for first < i && records[first].Timestamp.Before(records[i].Timestamp.Add(-normalizedPowerWindow)) {
+			if records[first].Power != basetype.Uint16Invalid {
+				firstSeconds := records[first].Timestamp.Sub(records[first-1].Timestamp).Seconds()
+				rollingTotal -= float64(records[first].Power) * firstSeconds
+				rollingDuration -= firstSeconds
+			}
+			first++
+		}
+		if rollingDuration > 0 {
+			totalFourth += math.Pow(rollingTotal/rollingDuration, 4) * seconds
+			durationFourth += seconds
+		}
+	}
+
+	if duration <= 0 {
+		return 0, 0, 0, false
+	}
+
+	return total / duration, maxPower, math.Pow(totalFourth/durationFourth, 0.25), true
+}
@@ -0,0 +1,121 @@
+package converter
+
+import (
+	"math"
+	"testing"
+
+	"github.com/muktihari/fit/profile/basetype"
+	"github.com/mxdc/nrc2strava/types"
+)
+
+func TestPowerModels(t *testing.T) {
+	for _, model := range []func(speed, grade, weight float64) float64{strydPower, acsmPower} {
+		flat := model(10.0/3.6, 0, 70)
+		// About 3W/kg at 10km/h for both models
+		if flat < 180 || flat > 250 {
+			t.Errorf("flat power at 10km/h = %.0fW, want between 180 and 250W", flat)
+		}
+
+		if uphill := model(10.0/3.6, 0.05, 70); uphill <= flat {
+			t.Errorf("uphill power %.0fW not above the flat power %.0fW", uphill, flat)
+		}
+
+		if heavier := model(10.0/3.6, 0, 80); heavier <= flat {
+			t.Errorf("power of a heavier athlete %.0fW not above %.0fW", heavier, flat)
+		}
+	}
+
+	if downhill, flat := acsmPower(3, -0.05, 70), acsmPower(3, 0, 70); downhill != flat {
+		t.Errorf("ACSM downhill power = %.0fW, want the flat power %.0fW", downhill, flat)
+	}
+}
+
+// TestFillPower climbs at 3m/s on a 5% grade, then stands still
+func TestFillPower(t *testing.T) {
+	records := newTestRecords(fuzzStartSeconds, 60)
+	for i, record := range records {
+		distance := 3 * float64(min(i, 40))
+		record.SetDistanceScaled(distance)
+		record.SetEnhancedAltitudeScaled(100 + distance*0.05)
+		if i > 0 && i <= 40 {
+			record.SetSpeedScaled(3)
+		} else {
+			record.SetSpeedScaled(0)
+		}
+	}
+
+	fillPower(records, PowerModelStryd, 70, false)
+
+	want := strydPower(3, 0.05, 70)
+	if power := float64(records[20].Power); math.Abs(power-want) > 1 {
+		t.Errorf("power on the climb = %.0fW, want %.0fW", power, want)
+	}
+	if records[50].Power != 0 {
+		t.Errorf("power standing still = %dW, want 0W", records[50].Power)
+	}
+
+	// The treadmill runs are flat
+	fillPower(records, PowerModelStryd, 70, true)
+
+	want = strydPower(3, 0, 70)
+	if power := float64(records[20].Power); math.Abs(power-want) > 1 {
+		t.Errorf("treadmill power = %.0fW, want %.0fW", power, want)
+	}
+}
+
+func TestComputePower(t *testing.T) {
+	records := newTestRecords(fuzzStartSeconds, 241)
+	for i, record := range records {
+		// 200W, then alternating 100W and 300W every minute
+		power := uint16(200)
+		if i > 120 {
+			power = 100
+			if (i/60)%2 == 1 {
+				power = 300
+			}
+		}
+		record.SetPower(power)
+	}
+
+	avgPower, maxPower, normalizedPower, ok := computePower(records[:121])
+	if !ok || math.Abs(avgPower-200) > 0.01 || maxPower != 200 || math.Abs(normalizedPower-200) > 0.01 {
+		t.Errorf("computePower() = %.1f, %.1f, %.1f, %t, want 200, 200, 200, true", avgPower, maxPower, normalizedPower, ok)
+	}
+
+	avgPower, maxPower, normalizedPower, _ = computePower(records)
+	if maxPower != 300 {
+		t.Errorf("max power = %.0fW, want 300W", maxPower)
+	}
+	// The variations weigh more in the normalized power
+	if normalizedPower <= avgPower {
+		t.Errorf("normalized power %.0fW not above the average power %.0fW", normalizedPower, avgPower)
+	}
+
+	if _, _, _, ok := computePower(newTestRecords(fuzzStartSeconds, 10)); ok {
+		t.Errorf("computePower() of records without power returned true")
+	}
+}
+
+// TestParseSessionPower checks the power is only estimated when a model is configured
+func TestParseSessionPower(t *testing.T) {
+	startMs := int64(fuzzStartSeconds * 1000)
+	metrics := []types.Metric{{
+		Type:   "distance",
+		Values: []types.MetricValue{{StartEpochMs: startMs, EndEpochMs: startMs + 60000, Value: 0.18}},
+	}}
+
+	for _, model := range []string{"", PowerModelNone, PowerModelStryd, PowerModelACSM} {
+		metricsConverter := InitMetricsConverter(startMs, startMs+60000, 60000, metrics, nil, nil, nil)
+		metricsConverter.PowerModel = model
+		records := metricsConverter.ParseRecords()
+		session := metricsConverter.ParseSession(records)
+
+		estimated := model == PowerModelStryd || model == PowerModelACSM
+		if hasPower := session.AvgPower != basetype.Uint16Invalid; hasPower != estimated {
+			t.Errorf("model %q: session avg power = %d, want estimated %t", model, session.AvgPower, estimated)
+		}
+		if estimated && (session.MaxPower < session.AvgPower || session.NormalizedPower == basetype.Uint16Invalid) {
+			t.Errorf("model %q: session power avg %d, max %d, normalized %d", model, session.AvgPower, session.MaxPower, session.NormalizedPower)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package converter
+
+import (
+	"slices"
+	"time"
+
+	"github.com/mxdc/nrc2strava/types"
+)
+
+const (
+	// DefaultRecordInterval is the interval between two records used when none is configured
+	DefaultRecordInterval = time.Second
+
+	// RecordIntervalNative emits a record at each NRC sample time instead of a fixed interval
+	RecordIntervalNative time.Duration = -1
+)
+
+// recordTimes returns the record timestamps in milliseconds, from the start to the end of the activity.
+// The FIT timestamps are in seconds, a single record is kept per second: the latest, so the end is always kept.
+func recordTimes(startMs, endMs int64, interval time.Duration, metrics []types.Metric) []int64 {
+	// A single record when the end precedes the start
+	if endMs <= startMs {
+		return []int64{startMs}
+	}
+
+	var times []int64
+	if interval == RecordIntervalNative {
+		times = sampleTimes(startMs, endMs, metrics)
+	} else {
+		if interval <= 0 {
+			interval = DefaultRecordInterval
+		}
+
+		step := max(interval.Milliseconds(), 1)
+		for timestamp := startMs; timestamp < endMs; timestamp += step {
+			times = append(times, timestamp)
+		}
+		times = append(times, endMs)
+	}
+
+	return lastPerSecond(times)
+}
+
+// sampleTimes returns the sorted start and end times of the metric values within the activity, with its start and end
+func sampleTimes(startMs, endMs int64, metrics []types.Metric) []int64 {
+	times := []int64{startMs, endMs}
+	for _, metric := range metrics {
+		for _, value := range metric.Values {
+			for _, timestamp := range []int64{value.StartEpochMs, value.EndEpochMs} {
+				if timestamp > startMs && timestamp < endMs {
+					times = append(times, timestamp)
+				}
+			}
+		}
+	}
+
+	slices.Sort(times)
+	return slices.Compact(times)
+}
+
+// lastPerSecond keeps the latest of the sorted times falling in the same second
+func lastPerSecond(times []int64) []int64 {
+	kept := times[:0]
+	for _, timestamp := range times {
+		if len(kept) > 0 && floorSecond(kept[len(kept)-1]) == floorSecond(timestamp) {
+			kept[len(kept)-1] = timestamp
+			continue
+		}
+		kept = append(kept, timestamp)
+	}
+
+	return kept
+}
+
+func floorSecond(timestampMs int64) int64 {
+	if timestampMs < 0 && timestampMs%1000 != 0 {
+		return timestampMs/1000 - 1
+	}
+	return timestampMs / 1000
+}
@@ -0,0 +1,78 @@
+package converter
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mxdc/nrc2strava/types"
+)
+
+func TestRecordTimes(t *testing.T) {
+	startMs := int64(fuzzStartSeconds*1000 + 450)
+	metrics := []types.Metric{
+		{Type: "distance", Values: []types.MetricValue{
+			{StartEpochMs: startMs, EndEpochMs: startMs + 3000},
+			{StartEpochMs: startMs + 3000, EndEpochMs: startMs + 7200},
+		}},
+		{Type: "latitude", Values: []types.MetricValue{
+			// Before the start, then twice in the same second
+			{StartEpochMs: startMs - 5000, EndEpochMs: startMs - 5000},
+			{StartEpochMs: startMs + 1100, EndEpochMs: startMs + 1100},
+			{StartEpochMs: startMs + 1400, EndEpochMs: startMs + 1400},
+		}},
+	}
+
+	tests := []struct {
+		name     string
+		endMs    int64
+		interval time.Duration
+		want     []int64
+	}{
+		{"default", startMs + 3000, 0, []int64{0, 1000, 2000, 3000}},
+		{"1s", startMs + 3000, time.Second, []int64{0, 1000, 2000, 3000}},
+		// The end shares its second with the last interval, it replaces it
+		{"end in the last second", startMs + 2300, time.Second, []int64{0, 1000, 2300}},
+		{"2s", startMs + 7000, 2 * time.Second, []int64{0, 2000, 4000, 6000, 7000}},
+		{"5s", startMs + 12000, 5 * time.Second, []int64{0, 5000, 10000, 12000}},
+		{"native", startMs + 8000, RecordIntervalNative, []int64{0, 1400, 3000, 7200, 8000}},
+		{"end before start", startMs - 1000, time.Second, []int64{0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			times := recordTimes(startMs, tt.endMs, tt.interval, metrics)
+
+			got := make([]int64, len(times))
+			for i, timestamp := range times {
+				got[i] = timestamp - startMs
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("recordTimes() offsets = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseRecordsInterval checks the distances interpolated at the millisecond of each record
+func TestParseRecordsInterval(t *testing.T) {
+	startMs := int64(fuzzStartSeconds*1000 + 450)
+	metrics := []types.Metric{{
+		Type:   "distance",
+		Values: []types.MetricValue{{StartEpochMs: startMs, EndEpochMs: startMs + 10000, Value: 0.03}},
+	}}
+
+	metricsConverter := InitMetricsConverter(startMs, startMs+10000, 10000, metrics, nil, nil, nil)
+	metricsConverter.RecordInterval = 5 * time.Second
+	records := metricsConverter.ParseRecords()
+
+	want := []float64{0, 15, 30}
+	if len(records) != len(want) {
+		t.Fatalf("ParseRecords() returned %d records, want %d", len(records), len(want))
+	}
+	for i, record := range records {
+		if distance := record.DistanceScaled(); distance != want[i] {
+			t.Errorf("record %d at %s: distance = %.2f, want %.2f", i, record.Timestamp, distance, want[i])
+		}
+	}
+}
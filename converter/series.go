@@ -0,0 +1,138 @@
+package converter
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mxdc/nrc2strava/types"
+)
+
+// interpolation is how a time series computes its value at a given time
+type interpolation int
+
+const (
+	// stepInterpolation returns the value of the interval containing the time, for rates like the speed or the cadence
+	stepInterpolation interpolation = iota
+
+	// linearInterpolation interpolates between two consecutive samples, for instant values like the GPS or the elevation.
+	// The first and last values are held before and after the series.
+	linearInterpolation
+
+	// cumulativeInterpolation sums the values of the intervals, for quantities like the distance.
+	// The total grows linearly within each interval and is held between the intervals.
+	cumulativeInterpolation
+)
+
+// sample is a value of a time series, in milliseconds
+type sample struct {
+	start int64
+	end   int64
+	value float64
+}
+
+// timeSeries is a NRC metric sorted by time, interpolated in O(log n) per lookup
+type timeSeries struct {
+	samples       []sample
+	interpolation interpolation
+
+	// factor converts the totals of a cumulative series, like the kilometers to meters
+	factor float64
+}
+
+// newTimeSeries builds the time series of the metric values, which NRC sorts by time.
+// The cumulative series holds the running total at the end of each interval.
+func newTimeSeries(metric types.Metric, interpolation interpolation) *timeSeries {
+	series := &timeSeries{
+		samples:       make([]sample, 0, len(metric.Values)),
+		interpolation: interpolation,
+		factor:        1,
+	}
+
+	total := 0.0
+	for _, value := range metric.Values {
+		s := sample{start: value.StartEpochMs, end: max(value.EndEpochMs, value.StartEpochMs), value: value.Value}
+		if interpolation == cumulativeInterpolation {
+			total += value.Value
+			s.value = total
+		}
+
+		series.samples = append(series.samples, s)
+	}
+
+	return series
+}
+
+// empty reports whether the series has no sample
+func (s *timeSeries) empty() bool {
+	return len(s.samples) == 0
+}
+
+// valueAt returns the interpolated value at the time, false when the series has no value there
+func (s *timeSeries) valueAt(t time.Time) (float64, bool) {
+	if len(s.samples) == 0 {
+		return 0, false
+	}
+
+	timestamp := t.UnixMilli()
+
+	switch s.interpolation {
+	case linearInterpolation:
+		return s.linearAt(timestamp), true
+	case cumulativeInterpolation:
+		return s.cumulativeAt(timestamp), true
+	default:
+		return s.stepAt(timestamp)
+	}
+}
+
+// search returns the index of the last sample starting at or before the timestamp, -1 if none
+func (s *timeSeries) search(timestamp int64) int {
+	return sort.Search(len(s.samples), func(i int) bool {
+		return s.samples[i].start > timestamp
+	}) - 1
+}
+
+func (s *timeSeries) stepAt(timestamp int64) (float64, bool) {
+	i := s.search(timestamp)
+	if i < 0 || timestamp >= s.samples[i].end {
+		return 0, false
+	}
+
+	return s.samples[i].value, true
+}
+
+func (s *timeSeries) linearAt(timestamp int64) float64 {
+	i := s.search(timestamp)
+	if i < 0 {
+		return s.samples[0].value
+	}
+	if i == len(s.samples)-1 {
+		return s.samples[i].value
+	}
+
+	current, next := s.samples[i], s.samples[i+1]
+	ratio := float64(timestamp-current.start) / float64(next.start-current.start)
+	return current.value + (next.value-current.value)*ratio
+}
+
+func (s *timeSeries) cumulativeAt(timestamp int64) float64 {
+	i := s.search(timestamp)
+	if i < 0 {
+		return 0
+	}
+
+	// The total is held after the interval, during a pause
+	current := s.samples[i]
+	if timestamp >= current.end {
+		return current.value * s.factor
+	}
+
+	// The total before the interval grows to the total at its end
+	previous := 0.0
+	if i > 0 {
+		previous = s.samples[i-1].value
+	}
+
+	ratio := float64(timestamp-current.start) / float64(current.end-current.start)
+	return previous*s.factor + (current.value-previous)*s.factor*ratio
+}
@@ -0,0 +1,77 @@
+package converter
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mxdc/nrc2strava/types"
+)
+
+func TestTimeSeriesValueAt(t *testing.T) {
+	const startMs = fuzzStartSeconds * 1000
+	intervals := types.Metric{Values: []types.MetricValue{
+		{StartEpochMs: startMs, EndEpochMs: startMs + 10000, Value: 10},
+		// a pause from 10s to 20s
+		{StartEpochMs: startMs + 20000, EndEpochMs: startMs + 30000, Value: 20},
+	}}
+	instants := types.Metric{Values: []types.MetricValue{
+		{StartEpochMs: startMs, EndEpochMs: startMs, Value: 100},
+		{StartEpochMs: startMs + 10000, EndEpochMs: startMs + 10000, Value: 200},
+		// two samples at the same time, the last one is used
+		{StartEpochMs: startMs + 20000, EndEpochMs: startMs + 20000, Value: 0},
+		{StartEpochMs: startMs + 20000, EndEpochMs: startMs + 20000, Value: 300},
+	}}
+
+	tests := []struct {
+		name          string
+		metric        types.Metric
+		interpolation interpolation
+		offsetMs      int64
+		value         float64
+		ok            bool
+	}{
+		{"step before", intervals, stepInterpolation, -1000, 0, false},
+		{"step start", intervals, stepInterpolation, 0, 10, true},
+		{"step end is excluded", intervals, stepInterpolation, 10000, 0, false},
+		{"step second interval", intervals, stepInterpolation, 25000, 20, true},
+		{"step after", intervals, stepInterpolation, 30000, 0, false},
+		{"linear before", instants, linearInterpolation, -5000, 100, true},
+		{"linear between", instants, linearInterpolation, 2500, 125, true},
+		{"linear sub-second", instants, linearInterpolation, 500, 105, true},
+		{"linear same time", instants, linearInterpolation, 20000, 300, true},
+		{"linear after", instants, linearInterpolation, 60000, 300, true},
+		{"cumulative before", intervals, cumulativeInterpolation, -1000, 0, true},
+		{"cumulative within", intervals, cumulativeInterpolation, 5000, 5, true},
+		{"cumulative held during the pause", intervals, cumulativeInterpolation, 15000, 10, true},
+		{"cumulative second interval", intervals, cumulativeInterpolation, 25000, 20, true},
+		{"cumulative after", intervals, cumulativeInterpolation, 60000, 30, true},
+		{"empty", types.Metric{}, linearInterpolation, 0, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			series := newTimeSeries(test.metric, test.interpolation)
+
+			value, ok := series.valueAt(time.UnixMilli(startMs + test.offsetMs))
+			if ok != test.ok || math.Abs(value-test.value) > 1e-9 {
+				t.Errorf("valueAt(%+dms) = %v, %t, want %v, %t", test.offsetMs, value, ok, test.value, test.ok)
+			}
+		})
+	}
+}
+
+func TestTimeSeriesZeroLengthInterval(t *testing.T) {
+	const startMs = fuzzStartSeconds * 1000
+	series := newTimeSeries(types.Metric{Values: []types.MetricValue{
+		{StartEpochMs: startMs, EndEpochMs: startMs, Value: 5},
+		{StartEpochMs: startMs, EndEpochMs: startMs + 1000, Value: 1},
+	}}, cumulativeInterpolation)
+
+	if value, _ := series.valueAt(time.UnixMilli(startMs)); value != 5 {
+		t.Errorf("valueAt(start) = %v, want 5", value)
+	}
+	if value, _ := series.valueAt(time.UnixMilli(startMs + 1000)); value != 6 {
+		t.Errorf("valueAt(end) = %v, want 6", value)
+	}
+}
@@ -0,0 +1,153 @@
+package converter
+
+import (
+	"math"
+	"time"
+
+	"github.com/muktihari/fit/profile/mesgdef"
+	"github.com/mxdc/nrc2strava/types"
+)
+
+// Sources of the record speeds
+const (
+	// SpeedSourceNRC uses the NRC speed series, then the pace series, then falls back to a rolling window
+	SpeedSourceNRC = "nrc"
+	// SpeedSourceRolling derives the speed from the distance over a rolling window
+	SpeedSourceRolling = "rolling"
+	// SpeedSourceDistance derives the speed from the distance delta between two records
+	SpeedSourceDistance = "distance"
+)
+
+// defaultSpeedWindow is the rolling window in seconds used when none is configured
+const defaultSpeedWindow = 10
+
+// SpeedStrategy configures how the record speeds are filled
+type SpeedStrategy struct {
+	// Source is one of the SpeedSource values, SpeedSourceNRC when empty
+	Source string
+
+	// Window is the rolling window in seconds
+	Window int
+}
+
+// fillSpeed fills the record speeds from the configured source and returns the source used
+func (m *MetricsConverter) fillSpeed(records []*mesgdef.Record) string {
+	source := m.SpeedStrategy.Source
+	if len(source) == 0 {
+		source = SpeedSourceNRC
+	}
+
+	window := m.SpeedStrategy.Window
+	if window <= 0 {
+		window = defaultSpeedWindow
+	}
+
+	if source == SpeedSourceNRC {
+		if fillSpeedFromMetric(records, m.SpeedMetric, "speed", kilometersPerHourToMetersPerSecond) {
+			return SpeedSourceNRC
+		}
+
+		if fillSpeedFromMetric(records, m.PaceMetric, "pace", minutesPerKilometerToMetersPerSecond) {
+			return SpeedSourceNRC
+		}
+
+		source = SpeedSourceRolling
+	}
+
+	if source == SpeedSourceRolling {
+		fillSpeedRolling(records, window)
+		return SpeedSourceRolling
+	}
+
+	fillSpeedFromDistance(records)
+	return SpeedSourceDistance
+}
+
+func kilometersPerHourToMetersPerSecond(speed float64) float64 {
+	return speed / 3.6
+}
+
+func minutesPerKilometerToMetersPerSecond(pace float64) float64 {
+	if pace <= 0 {
+		return 0
+	}
+	return 1000 / (pace * 60)
+}
+
+// fillSpeedFromMetric fills the record speeds from a NRC series, records outside the intervals get a zero speed
+func fillSpeedFromMetric(records []*mesgdef.Record, metric types.Metric, metricType string, toMetersPerSecond func(float64) float64) bool {
+	if metric.Type != metricType || len(metric.Values) == 0 {
+		return false
+	}
+
+	// Skip if it's a default empty value (only one value with value 0)
+	if len(metric.Values) == 1 && metric.Values[0].Value == 0 {
+		return false
+	}
+
+	series := newTimeSeries(metric, stepInterpolation)
+	for _, record := range records {
+		speed := 0.0
+		if value, ok := series.valueAt(record.Timestamp); ok {
+			speed = toMetersPerSecond(value)
+		}
+
+		if math.IsNaN(speed) || math.IsInf(speed, 0) || speed < 0 {
+			speed = 0
+		}
+
+		record.SetSpeedScaled(speed)
+		record.SetEnhancedSpeedScaled(speed)
+	}
+
+	return true
+}
+
+// fillSpeedRolling computes the speed from the distance covered over a window centered on each record,
+// the window is in seconds to stay the same whatever the record interval
+func fillSpeedRolling(records []*mesgdef.Record, window int) {
+	halfWindow := time.Duration(max(window/2, 1)) * time.Second
+
+	first, last := 0, 0
+	for _, record := range records {
+		for records[first].Timestamp.Before(record.Timestamp.Add(-halfWindow)) {
+			first++
+		}
+		for last+1 < len(records) && !records[last+1].Timestamp.After(record.Timestamp.Add(halfWindow)) {
+			last++
+		}
+
+		timeDelta := records[last].Timestamp.Sub(records[first].Timestamp).Seconds()
+		distanceDelta := records[last].DistanceScaled() - records[first].DistanceScaled()
+
+		speed := 0.0
+		if timeDelta > 0 && !math.IsNaN(distanceDelta) && distanceDelta > 0 {
+			speed = distanceDelta / timeDelta
+		}
+
+		record.SetSpeedScaled(speed)
+		record.SetEnhancedSpeedScaled(speed)
+	}
+}
+
+// computeAvgSpeed returns the mean speed of the moving records
+func computeAvgSpeed(records []*mesgdef.Record) float64 {
+	total := 0.0
+	count := 0
+
+	for _, record := range records {
+		speed := record.SpeedScaled()
+		if math.IsNaN(speed) || speed <= 0 {
+			continue
+		}
+
+		total += speed
+		count++
+	}
+
+	if count == 0 {
+		return 0
+	}
+
+	return total / float64(count)
+}
@@ -0,0 +1,175 @@
+package converter
+
+import (
+	"math"
+	"testing"
+
+	"github.com/muktihari/fit/profile/mesgdef"
+	"github.com/mxdc/nrc2strava/types"
+)
+
+// newMovingRecords returns a record per second at the speed in m/s, standing still during the pause between the seconds
+func newMovingRecords(count int, speed float64, pauseStart, pauseEnd int) []*mesgdef.Record {
+	records := newTestRecords(fuzzStartSeconds, count)
+
+	distance := 0.0
+	for i, record := range records {
+		if i > 0 && (i <= pauseStart || i > pauseEnd) {
+			distance += speed
+		}
+		record.SetDistanceScaled(distance)
+	}
+	return records
+}
+
+// newIntervalMetric returns a metric of 10 seconds intervals from the start, with the values
+func newIntervalMetric(metricType string, values ...float64) types.Metric {
+	metric := types.Metric{Type: metricType, Values: []types.MetricValue{}}
+
+	startMs := int64(fuzzStartSeconds * 1000)
+	for i, value := range values {
+		metric.Values = append(metric.Values, types.MetricValue{
+			StartEpochMs: startMs + int64(i)*10000,
+			EndEpochMs:   startMs + int64(i+1)*10000,
+			Value:        value,
+		})
+	}
+	return metric
+}
+
+// checkSpeeds compares the record speeds with the expected ones
+func checkSpeeds(t *testing.T, records []*mesgdef.Record, want func(i int) float64) {
+	t.Helper()
+
+	for i, record := range records {
+		if got := record.SpeedScaled(); math.Abs(got-want(i)) > 0.001 {
+			t.Errorf("record %d speed = %.3fm/s, want %.3fm/s", i, got, want(i))
+		}
+		if enhanced := record.EnhancedSpeedScaled(); math.Abs(enhanced-record.SpeedScaled()) > 0.001 {
+			t.Errorf("record %d enhanced speed %.3fm/s differs from the speed %.3fm/s", i, enhanced, record.SpeedScaled())
+		}
+	}
+}
+
+func TestMinutesPerKilometerToMetersPerSecond(t *testing.T) {
+	tests := []struct {
+		pace float64
+		want float64
+	}{
+		{5, 1000.0 / 300},
+		{4, 1000.0 / 240},
+		{0, 0},
+		{-5, 0},
+	}
+
+	for _, tt := range tests {
+		if got := minutesPerKilometerToMetersPerSecond(tt.pace); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("minutesPerKilometerToMetersPerSecond(%v) = %v, want %v", tt.pace, got, tt.want)
+		}
+	}
+}
+
+func TestFillSpeedFromMetric(t *testing.T) {
+	tests := []struct {
+		name   string
+		metric types.Metric
+		kind   string
+		filled bool
+		want   func(i int) float64
+	}{
+		{"speed", newIntervalMetric("speed", 10.8, 14.4), "speed", true, func(i int) float64 {
+			return []float64{3, 4, 0}[i/10]
+		}},
+		{"pace", newIntervalMetric("pace", 5, 4), "pace", true, func(i int) float64 {
+			return []float64{1000.0 / 300, 1000.0 / 240, 0}[i/10]
+		}},
+		{"zero pace", newIntervalMetric("pace", 5, 0), "pace", true, func(i int) float64 {
+			return []float64{1000.0 / 300, 0, 0}[i/10]
+		}},
+		{"negative pace", newIntervalMetric("pace", -5, 5), "pace", true, func(i int) float64 {
+			return []float64{0, 1000.0 / 300, 0}[i/10]
+		}},
+		{"single zero value", newIntervalMetric("pace", 0), "pace", false, nil},
+		{"other metric", newIntervalMetric("speed", 10.8), "pace", false, nil},
+		{"no value", newIntervalMetric("pace"), "pace", false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toMetersPerSecond := kilometersPerHourToMetersPerSecond
+			if tt.kind == "pace" {
+				toMetersPerSecond = minutesPerKilometerToMetersPerSecond
+			}
+
+			records := newTestRecords(fuzzStartSeconds, 25)
+			if filled := fillSpeedFromMetric(records, tt.metric, tt.kind, toMetersPerSecond); filled != tt.filled {
+				t.Fatalf("fillSpeedFromMetric() = %t, want %t", filled, tt.filled)
+			}
+			if tt.filled {
+				checkSpeeds(t, records, tt.want)
+			}
+		})
+	}
+}
+
+func TestFillSpeedRolling(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []*mesgdef.Record
+		window  int
+		want    func(i int) float64
+	}{
+		{"steady", newMovingRecords(20, 3, 0, 0), 4, func(int) float64 { return 3 }},
+		// 2 records before and after the pause see a part of it within the window
+		{"pause", newMovingRecords(20, 3, 8, 12), 4, func(i int) float64 {
+			return []float64{3, 3, 3, 3, 3, 3, 3, 2.25, 1.5, 0.75, 0, 0.75, 1.5, 2.25, 3, 3, 3, 3, 3, 3}[i]
+		}},
+		// The window is cut by the start and the end of the run
+		{"window larger than the run", newMovingRecords(10, 3, 0, 0), 60, func(int) float64 { return 3 }},
+		{"single record", newMovingRecords(1, 3, 0, 0), 4, func(int) float64 { return 0 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fillSpeedRolling(tt.records, tt.window)
+			checkSpeeds(t, tt.records, tt.want)
+		})
+	}
+}
+
+func TestFillSpeed(t *testing.T) {
+	speedMetric := newIntervalMetric("speed", 10.8, 10.8)
+	paceMetric := newIntervalMetric("pace", 4, 4)
+	empty := types.Metric{}
+
+	tests := []struct {
+		name        string
+		strategy    SpeedStrategy
+		speedMetric types.Metric
+		paceMetric  types.Metric
+		source      string
+		want        float64
+	}{
+		{"NRC speed", SpeedStrategy{}, speedMetric, paceMetric, SpeedSourceNRC, 3},
+		{"NRC pace without speed", SpeedStrategy{Source: SpeedSourceNRC}, empty, paceMetric, SpeedSourceNRC, 1000.0 / 240},
+		{"NRC without series", SpeedStrategy{Source: SpeedSourceNRC}, empty, empty, SpeedSourceRolling, 2},
+		{"rolling", SpeedStrategy{Source: SpeedSourceRolling, Window: 4}, speedMetric, paceMetric, SpeedSourceRolling, 2},
+		{"rolling default window", SpeedStrategy{Source: SpeedSourceRolling}, speedMetric, paceMetric, SpeedSourceRolling, 2},
+		{"distance", SpeedStrategy{Source: SpeedSourceDistance}, speedMetric, paceMetric, SpeedSourceDistance, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metricsConverter := &MetricsConverter{SpeedStrategy: tt.strategy, SpeedMetric: tt.speedMetric, PaceMetric: tt.paceMetric}
+
+			// The distance grows at 2m/s, unlike the NRC series
+			records := newMovingRecords(20, 2, 0, 0)
+			if source := metricsConverter.fillSpeed(records); source != tt.source {
+				t.Errorf("fillSpeed() source = %s, want %s", source, tt.source)
+			}
+
+			// The first record has no previous distance to derive its speed from
+			checkSpeeds(t, records[1:], func(int) float64 { return tt.want })
+		})
+	}
+}
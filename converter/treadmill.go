@@ -0,0 +1,55 @@
+package converter
+
+import "github.com/mxdc/nrc2strava/types"
+
+// TreadmillCalibration corrects the distance measured by the phone accelerometer on treadmill runs
+type TreadmillCalibration struct {
+	// Factor is applied to the distance of every treadmill run, 1 or 0 leaves it unchanged
+	Factor float64
+
+	// Distances are the true distances in meters by NRC activity ID, they take precedence over the factor
+	Distances map[string]float64
+}
+
+// factorFor returns the factor to apply to the run distance
+func (t TreadmillCalibration) factorFor(activityID string, distanceMeters float64) float64 {
+	if trueDistance, ok := t.Distances[activityID]; ok && trueDistance > 0 && distanceMeters > 0 {
+		return trueDistance / distanceMeters
+	}
+
+	if t.Factor > 0 {
+		return t.Factor
+	}
+
+	return 1
+}
+
+// Calibrate rescales the distance, speed and pace metrics and summaries by the factor
+func (m *MetricsConverter) Calibrate(factor float64) {
+	if factor <= 0 || factor == 1 {
+		return
+	}
+
+	m.logger.Debugf("Calibrating distance by a factor of %.3f\n", factor)
+
+	m.DistanceMetric = scaleMetric(m.DistanceMetric, factor)
+	m.SpeedMetric = scaleMetric(m.SpeedMetric, factor)
+	m.PaceMetric = scaleMetric(m.PaceMetric, 1/factor)
+
+	m.DistanceSummary.Value *= factor
+	m.SpeedSummary.Value *= factor
+	m.PaceSummary.Value /= factor
+}
+
+// scaleMetric returns a copy of the metric with every value multiplied by the factor
+func scaleMetric(metric types.Metric, factor float64) types.Metric {
+	scaled := metric
+	scaled.Values = make([]types.MetricValue, len(metric.Values))
+
+	for i, value := range metric.Values {
+		scaled.Values[i] = value
+		scaled.Values[i].Value = value.Value * factor
+	}
+
+	return scaled
+}
@@ -0,0 +1,106 @@
+package converter
+
+import (
+	"math"
+	"os"
+	"testing"
+
+	"github.com/mxdc/nrc2strava/parser"
+	"github.com/mxdc/nrc2strava/types"
+)
+
+const treadmillID = "c0a1b2c3-0002-4000-8000-000000000002"
+
+func TestFactorFor(t *testing.T) {
+	tests := []struct {
+		name        string
+		calibration TreadmillCalibration
+		activityID  string
+		distance    float64
+		want        float64
+	}{
+		{"no calibration", TreadmillCalibration{}, "run", 5000, 1},
+		{"global factor", TreadmillCalibration{Factor: 1.05}, "run", 5000, 1.05},
+		{"negative global factor", TreadmillCalibration{Factor: -1}, "run", 5000, 1},
+		{"target distance", TreadmillCalibration{Distances: map[string]float64{"run": 5500}}, "run", 5000, 1.1},
+		{"target distance over the global factor", TreadmillCalibration{Factor: 1.05, Distances: map[string]float64{"run": 4000}}, "run", 5000, 0.8},
+		{"target distance of another run", TreadmillCalibration{Factor: 1.05, Distances: map[string]float64{"other": 4000}}, "run", 5000, 1.05},
+		{"zero target distance", TreadmillCalibration{Factor: 1.05, Distances: map[string]float64{"run": 0}}, "run", 5000, 1.05},
+		{"run without distance", TreadmillCalibration{Distances: map[string]float64{"run": 5500}}, "run", 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.calibration.factorFor(tt.activityID, tt.distance); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("factorFor() = %f, want %f", got, tt.want)
+			}
+		})
+	}
+}
+
+// convertTreadmillRun converts the treadmill run of the corpus with the calibration
+func convertTreadmillRun(t *testing.T, calibration TreadmillCalibration) types.Run {
+	t.Helper()
+
+	f, err := os.Open("testdata/corpus/treadmill.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	nikeActivity, err := parser.ParseActivity(f)
+	if err != nil {
+		t.Fatalf("ParseActivity() error = %v", err)
+	}
+
+	activitiesConverter := InitActivitiesConverter()
+	activitiesConverter.TreadmillCalibration = calibration
+	return activitiesConverter.ConvertRun(nikeActivity)
+}
+
+// TestConvertRunCalibrated checks the records, speeds, session and lap totals are rescaled together
+func TestConvertRunCalibrated(t *testing.T) {
+	raw := convertTreadmillRun(t, TreadmillCalibration{}).Activity
+
+	tests := []struct {
+		name        string
+		calibration TreadmillCalibration
+		distance    float64
+	}{
+		{"target distance", TreadmillCalibration{Distances: map[string]float64{treadmillID: 800}}, 800},
+		{"global factor", TreadmillCalibration{Factor: 1.1}, raw.Sessions[0].TotalDistanceScaled() * 1.1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			activity := convertTreadmillRun(t, tt.calibration).Activity
+			session, lap := activity.Sessions[0], activity.Laps[0]
+			factor := tt.distance / raw.Sessions[0].TotalDistanceScaled()
+
+			if got := session.TotalDistanceScaled(); math.Abs(got-tt.distance) > 0.01 {
+				t.Errorf("session distance = %.2fm, want %.2fm", got, tt.distance)
+			}
+			if lap.TotalDistance != session.TotalDistance || lap.AvgSpeed != session.AvgSpeed || lap.MaxSpeed != session.MaxSpeed {
+				t.Errorf("lap distance %d, speeds %d %d, want the session %d, %d %d",
+					lap.TotalDistance, lap.AvgSpeed, lap.MaxSpeed, session.TotalDistance, session.AvgSpeed, session.MaxSpeed)
+			}
+
+			// The records and the speeds are scaled by the same factor as the distance
+			last, rawLast := activity.Records[len(activity.Records)-1], raw.Records[len(raw.Records)-1]
+			if got, want := last.DistanceScaled(), rawLast.DistanceScaled()*factor; math.Abs(got-want) > 0.05 {
+				t.Errorf("last record distance = %.2fm, want %.2fm", got, want)
+			}
+			for i, record := range activity.Records {
+				if got, want := record.SpeedScaled(), raw.Records[i].SpeedScaled()*factor; math.Abs(got-want) > 0.002 {
+					t.Fatalf("record %d speed = %.3fm/s, want %.3fm/s", i, got, want)
+				}
+			}
+			if got, want := session.AvgSpeedScaled(), raw.Sessions[0].AvgSpeedScaled()*factor; math.Abs(got-want) > 0.002 {
+				t.Errorf("session average speed = %.3fm/s, want %.3fm/s", got, want)
+			}
+			if got, want := session.MaxSpeedScaled(), raw.Sessions[0].MaxSpeedScaled()*factor; math.Abs(got-want) > 0.002 {
+				t.Errorf("session max speed = %.3fm/s, want %.3fm/s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package converter
+
+import (
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/muktihari/fit/profile/basetype"
+	"github.com/muktihari/fit/profile/mesgdef"
+	"github.com/muktihari/fit/profile/typedef"
+)
+
+// defaultHeartRateZones are the lower bounds of the zones 1 to 5, in percent of the max heart rate or of the reserve
+var defaultHeartRateZones = []float64{0.5, 0.6, 0.7, 0.8, 0.9}
+
+// Zones configures the zones of the time in zone analysis. Like the Garmin devices, the zone 0 is below the zone 1.
+type Zones struct {
+	// HeartRate are the lower bounds in bpm of the heart rate zones 1 to N, derived from the athlete max heart rate when empty
+	HeartRate []uint8
+
+	// Speed are the lower bounds in m/s of the pace zones 1 to N, from the slowest, disabled when empty
+	Speed []float64
+}
+
+// heartRateBoundaries returns the high boundaries of the heart rate zones 0 to N and how they were computed,
+// nil without configured zones nor athlete max heart rate
+func (z Zones) heartRateBoundaries(athlete Athlete) ([]uint8, typedef.HrZoneCalc) {
+	if len(z.HeartRate) > 0 {
+		boundaries := slices.Sorted(slices.Values(z.HeartRate))
+
+		// The highest valid heart rate tops the last zone when the max heart rate is unknown
+		top := basetype.Uint8Invalid - 1
+		if athlete.MaxHeartRate > 0 {
+			top = max(athlete.MaxHeartRate, boundaries[len(boundaries)-1])
+		}
+		return append(boundaries, top), typedef.HrZoneCalcCustom
+	}
+
+	if athlete.MaxHeartRate == 0 {
+		return nil, typedef.HrZoneCalcInvalid
+	}
+
+	// Karvonen formula when the resting heart rate is known
+	calcType := typedef.HrZoneCalcPercentMaxHr
+	reference, reserve := 0.0, float64(athlete.MaxHeartRate)
+	if athlete.RestingHeartRate > 0 && athlete.RestingHeartRate < athlete.MaxHeartRate {
+		calcType = typedef.HrZoneCalcPercentHrr
+		reference = float64(athlete.RestingHeartRate)
+		reserve -= reference
+	}
+
+	boundaries := make([]uint8, 0, len(defaultHeartRateZones)+1)
+	for _, percent := range defaultHeartRateZones {
+		boundaries = append(boundaries, uint8(math.Round(reference+percent*reserve)))
+	}
+
+	return append(boundaries, athlete.MaxHeartRate), calcType
+}
+
+// speedBoundaries returns the high boundaries in m/s of the pace zones 0 to N, the last one is the max speed
+func (z Zones) speedBoundaries(maxSpeed float64) []float64 {
+	if len(z.Speed) == 0 {
+		return nil
+	}
+
+	boundaries := slices.Sorted(slices.Values(z.Speed))
+	return append(boundaries, max(maxSpeed, boundaries[len(boundaries)-1]))
+}
+
+// timeInZones returns the seconds spent in each zone, a value equal to a boundary belongs to the zone above
+// and the values above the last boundary count in the last zone.
+// Each record accounts for the time since the previous one, the records without value are skipped.
+func timeInZones(records []*mesgdef.Record, boundaries []float64, value func(*mesgdef.Record) (float64, bool)) []float64 {
+	times := make([]float64, len(boundaries))
+
+	for i := 1; i < len(records); i++ {
+		v, ok := value(records[i])
+		if !ok {
+			continue
+		}
+
+		zone := sort.Search(len(boundaries), func(i int) bool { return boundaries[i] > v })
+		times[min(zone, len(times)-1)] += records[i].Timestamp.Sub(records[i-1].Timestamp).Seconds()
+	}
+
+	return times
+}
+
+func recordHeartRate(record *mesgdef.Record) (float64, bool) {
+	return float64(record.HeartRate), record.HeartRate != basetype.Uint8Invalid
+}
+
+// recordSpeed skips the records standing still, which have no pace
+func recordSpeed(record *mesgdef.Record) (float64, bool) {
+	speed := record.SpeedScaled()
+	return speed, !math.IsNaN(speed) && speed > 0
+}
+
+// TimeInZone returns the time in zone message of the session, nil without any zone or value
+func (z Zones) TimeInZone(records []*mesgdef.Record, session *mesgdef.Session, athlete Athlete) *mesgdef.TimeInZone {
+	timeInZone := mesgdef.NewTimeInZone(nil).
+		SetTimestamp(session.Timestamp).
+		SetReferenceMesg(typedef.MesgNumSession).
+		SetReferenceIndex(0)
+	found := false
+
+	_, maxHeartRate, hasHeartRate := computeHeartRate(records)
+	if boundaries, calcType := z.heartRateBoundaries(athlete); len(boundaries) > 0 && hasHeartRate {
+		floatBoundaries := make([]float64, len(boundaries))
+		for i, boundary := range boundaries {
+			floatBoundaries[i] = float64(boundary)
+		}
+
+		timeInZone.SetTimeInHrZoneScaled(timeInZones(records, floatBoundaries, recordHeartRate))
+		timeInZone.SetHrZoneHighBoundary(boundaries)
+		timeInZone.SetHrCalcType(calcType)
+		timeInZone.SetMaxHeartRate(max(athlete.MaxHeartRate, maxHeartRate))
+		if athlete.RestingHeartRate > 0 {
+			timeInZone.SetRestingHeartRate(athlete.RestingHeartRate)
+		}
+		found = true
+	}
+
+	maxSpeed := computeMaxSpeed(records)
+	if boundaries := z.speedBoundaries(maxSpeed); len(boundaries) > 0 && maxSpeed > 0 {
+		timeInZone.SetTimeInSpeedZoneScaled(timeInZones(records, boundaries, recordSpeed))
+		timeInZone.SetSpeedZoneHighBoundaryScaled(boundaries)
+		found = true
+	}
+
+	if !found {
+		return nil
+	}
+
+	return timeInZone
+}
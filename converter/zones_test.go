@@ -0,0 +1,94 @@
+package converter
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/muktihari/fit/profile/mesgdef"
+	"github.com/muktihari/fit/profile/typedef"
+)
+
+func TestHeartRateBoundaries(t *testing.T) {
+	tests := []struct {
+		name     string
+		zones    Zones
+		athlete  Athlete
+		want     []uint8
+		calcType typedef.HrZoneCalc
+	}{
+		{"none", Zones{}, Athlete{}, nil, typedef.HrZoneCalcInvalid},
+		{"max heart rate", Zones{}, Athlete{MaxHeartRate: 200}, []uint8{100, 120, 140, 160, 180, 200}, typedef.HrZoneCalcPercentMaxHr},
+		{"heart rate reserve", Zones{}, Athlete{MaxHeartRate: 190, RestingHeartRate: 50}, []uint8{120, 134, 148, 162, 176, 190}, typedef.HrZoneCalcPercentHrr},
+		{"custom", Zones{HeartRate: []uint8{150, 130}}, Athlete{MaxHeartRate: 190}, []uint8{130, 150, 190}, typedef.HrZoneCalcCustom},
+		{"custom without max", Zones{HeartRate: []uint8{130, 150}}, Athlete{}, []uint8{130, 150, 254}, typedef.HrZoneCalcCustom},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, calcType := tt.zones.heartRateBoundaries(tt.athlete)
+			if !slices.Equal(got, tt.want) || calcType != tt.calcType {
+				t.Errorf("heartRateBoundaries() = %v, %s, want %v, %s", got, calcType, tt.want, tt.calcType)
+			}
+		})
+	}
+}
+
+// newHeartRateRecords returns a record per second with the heart rates
+func newHeartRateRecords(heartRates ...uint8) []*mesgdef.Record {
+	records := newTestRecords(fuzzStartSeconds, len(heartRates))
+	for i, record := range records {
+		record.SetHeartRate(heartRates[i])
+	}
+	return records
+}
+
+func TestTimeInZones(t *testing.T) {
+	// The first record has no duration, a boundary belongs to the zone above, the last zone takes the values above it
+	records := newHeartRateRecords(100, 100, 129, 130, 149, 150, 200)
+	records[3].HeartRate = 0xFF
+
+	got := timeInZones(records, []float64{130, 150, 190}, recordHeartRate)
+	if want := []float64{2, 1, 2}; !slices.Equal(got, want) {
+		t.Errorf("timeInZones() = %v, want %v", got, want)
+	}
+}
+
+func TestTimeInZone(t *testing.T) {
+	records := newHeartRateRecords(120, 140, 160, 180)
+	for i, record := range records {
+		record.SetSpeedScaled(2.5 + float64(i)*0.5)
+	}
+	session := mesgdef.NewSession(nil).SetTimestamp(records[3].Timestamp)
+
+	if timeInZone := (Zones{}).TimeInZone(records, session, Athlete{}); timeInZone != nil {
+		t.Errorf("TimeInZone() without zones = %+v, want nil", timeInZone)
+	}
+
+	// 6:00, 5:00 and 4:00 per km
+	zones := Zones{Speed: []float64{1000.0 / 360, 1000.0 / 300, 1000.0 / 240}}
+	timeInZone := zones.TimeInZone(records, session, Athlete{MaxHeartRate: 200})
+	if timeInZone == nil {
+		t.Fatalf("TimeInZone() = nil")
+	}
+
+	if timeInZone.ReferenceMesg != typedef.MesgNumSession || timeInZone.ReferenceIndex != 0 {
+		t.Errorf("TimeInZone() references %s %d, want the session 0", timeInZone.ReferenceMesg, timeInZone.ReferenceIndex)
+	}
+	if got, want := timeInZone.TimeInHrZoneScaled(), []float64{0, 0, 0, 1, 1, 1}; !slices.Equal(got, want) {
+		t.Errorf("time in heart rate zones = %v, want %v", got, want)
+	}
+	if got, want := timeInZone.TimeInSpeedZoneScaled(), []float64{0, 1, 2, 0}; !slices.Equal(got, want) {
+		t.Errorf("time in pace zones = %v, want %v", got, want)
+	}
+	if timeInZone.MaxHeartRate != 200 || timeInZone.HrCalcType != typedef.HrZoneCalcPercentMaxHr {
+		t.Errorf("TimeInZone() max heart rate %d, calc type %s", timeInZone.MaxHeartRate, timeInZone.HrCalcType)
+	}
+
+	// The heart rate zones need heart rates
+	for _, record := range records {
+		record.HeartRate = 0xFF
+	}
+	if timeInZone := (Zones{HeartRate: []uint8{130}}).TimeInZone(records, session, Athlete{}); timeInZone != nil {
+		t.Errorf("TimeInZone() without heart rates = %+v, want nil", timeInZone)
+	}
+}
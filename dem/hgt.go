@@ -0,0 +1,144 @@
+package dem
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/mxdc/nrc2strava/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// voidValue marks the samples without data in the SRTM tiles
+const voidValue = -32768
+
+// tile is a one degree square of elevation samples, stored from north-west to south-east
+type tile struct {
+	size    int // samples per row: 1201 for SRTM3, 3601 for SRTM1
+	samples []int16
+}
+
+// HGTReader reads the elevation from SRTM .hgt tiles stored in a directory
+type HGTReader struct {
+	TilesDir string
+
+	// tiles caches the loaded tiles, a nil tile is a missing one
+	tiles map[string]*tile
+	mutex sync.Mutex
+
+	// logger
+	logger *logrus.Logger
+}
+
+// NewHGTReader initializes a new HGTReader instance
+func NewHGTReader(tilesDir string) *HGTReader {
+	logger := utils.Logger
+
+	return &HGTReader{
+		TilesDir: tilesDir,
+		tiles:    map[string]*tile{},
+		logger:   logger,
+	}
+}
+
+// Elevation returns the ground altitude in meters at the position, or false if no tile covers it
+func (r *HGTReader) Elevation(latitude, longitude float64) (float64, bool) {
+	if math.IsNaN(latitude) || math.IsNaN(longitude) {
+		return 0, false
+	}
+
+	tileLatitude := math.Floor(latitude)
+	tileLongitude := math.Floor(longitude)
+
+	t := r.loadTile(tileName(int(tileLatitude), int(tileLongitude)))
+	if t == nil {
+		return 0, false
+	}
+
+	// Position of the point in the tile, rows go from north to south
+	x := (longitude - tileLongitude) * float64(t.size-1)
+	y := (1 - (latitude - tileLatitude)) * float64(t.size-1)
+
+	return t.interpolate(x, y)
+}
+
+// tileName returns the name of the tile whose south-west corner is at the given position, e.g. N48E002
+func tileName(latitude, longitude int) string {
+	latitudePrefix := "N"
+	if latitude < 0 {
+		latitudePrefix = "S"
+		latitude = -latitude
+	}
+
+	longitudePrefix := "E"
+	if longitude < 0 {
+		longitudePrefix = "W"
+		longitude = -longitude
+	}
+
+	return fmt.Sprintf("%s%02d%s%03d", latitudePrefix, latitude, longitudePrefix, longitude)
+}
+
+func (r *HGTReader) loadTile(name string) *tile {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if t, ok := r.tiles[name]; ok {
+		return t
+	}
+
+	t, err := readTile(filepath.Join(r.TilesDir, name+".hgt"))
+	if err != nil {
+		r.logger.Warnf("Elevation tile %s unavailable: %v\n", name, err)
+	} else {
+		r.logger.Debugf("Loaded elevation tile %s (%dx%d)\n", name, t.size, t.size)
+	}
+
+	r.tiles[name] = t
+	return t
+}
+
+func readTile(filePath string) (*tile, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	count := len(data) / 2
+	size := int(math.Sqrt(float64(count)))
+	if size*size != count || size < 2 {
+		return nil, fmt.Errorf("unexpected tile size: %d bytes", len(data))
+	}
+
+	samples := make([]int16, count)
+	for i := range samples {
+		samples[i] = int16(binary.BigEndian.Uint16(data[i*2:]))
+	}
+
+	return &tile{size: size, samples: samples}, nil
+}
+
+// interpolate returns the bilinear interpolation of the four samples around the position
+func (t *tile) interpolate(x, y float64) (float64, bool) {
+	column := min(int(x), t.size-2)
+	row := min(int(y), t.size-2)
+	dx := x - float64(column)
+	dy := y - float64(row)
+
+	topLeft := t.samples[row*t.size+column]
+	topRight := t.samples[row*t.size+column+1]
+	bottomLeft := t.samples[(row+1)*t.size+column]
+	bottomRight := t.samples[(row+1)*t.size+column+1]
+
+	if topLeft == voidValue || topRight == voidValue || bottomLeft == voidValue || bottomRight == voidValue {
+		return 0, false
+	}
+
+	top := float64(topLeft)*(1-dx) + float64(topRight)*dx
+	bottom := float64(bottomLeft)*(1-dx) + float64(bottomRight)*dx
+
+	return top*(1-dy) + bottom*dy, true
+}
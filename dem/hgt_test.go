@@ -0,0 +1,71 @@
+package dem
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTileName(t *testing.T) {
+	tests := []struct {
+		latitude, longitude int
+		want                string
+	}{
+		{48, 2, "N48E002"},
+		{0, 0, "N00E000"},
+		{-1, -1, "S01W001"},
+		{-34, -71, "S34W071"},
+		{45, -180, "N45W180"},
+		{-90, 179, "S90E179"},
+	}
+
+	for _, tt := range tests {
+		if got := tileName(tt.latitude, tt.longitude); got != tt.want {
+			t.Errorf("tileName(%d, %d) = %s, want %s", tt.latitude, tt.longitude, got, tt.want)
+		}
+	}
+}
+
+// TestElevation reads the synthetic tiles of testdata.
+// N45E005 has 3x3 samples from north-west to south-east, with a void sample in the middle of the east edge:
+//
+//	100  200  300
+//	100  150 void
+//	  0   50  200
+//
+// S01W001 has 2x2 samples: 10 20 / 30 40. N46E005 is truncated.
+func TestElevation(t *testing.T) {
+	tests := []struct {
+		name                string
+		latitude, longitude float64
+		want                float64
+		ok                  bool
+	}{
+		{"west post", 45.5, 5, 100, true},
+		{"post next to a void sample", 45.5, 5.5, 0, false},
+		{"south-west corner", 45, 5, 0, true},
+		{"between two posts", 45.5, 5.25, 125, true},
+		{"between four posts", 45.25, 5.25, 75, true},
+		{"north between four posts", 45.75, 5.25, 137.5, true},
+		{"void sample", 45.75, 5.75, 0, false},
+		{"void sample in the south-east", 45.25, 5.75, 0, false},
+		{"south-west tile", -0.5, -0.5, 25, true},
+		{"missing tile", 10.5, 10.5, 0, false},
+		{"truncated tile", 46.5, 5.5, 0, false},
+		{"no position", math.NaN(), 5.5, 0, false},
+	}
+
+	reader := NewHGTReader("testdata")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := reader.Elevation(tt.latitude, tt.longitude)
+			if ok != tt.ok || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Elevation(%f, %f) = %f, %t, want %f, %t", tt.latitude, tt.longitude, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+
+	// The missing tiles are cached as nil, not read again
+	if tile, ok := reader.tiles["N10E010"]; !ok || tile != nil {
+		t.Errorf("missing tile cached as %v, %t, want nil", tile, ok)
+	}
+}
@@ -0,0 +1,197 @@
+package fit
+
+import (
+	"slices"
+	"unicode/utf8"
+
+	"github.com/muktihari/fit/profile/basetype"
+	"github.com/muktihari/fit/profile/mesgdef"
+	"github.com/muktihari/fit/profile/typedef"
+	"github.com/muktihari/fit/proto"
+	"github.com/mxdc/nrc2strava/types"
+)
+
+// DeveloperDataIndex is the index of the nrc2strava DeveloperDataId
+const DeveloperDataIndex = 0
+
+// Developer field names, the readers resolve the fields by name
+const (
+	FieldTitle         = "title"
+	FieldNRCActivityID = "nrc_activity_id"
+	FieldNRCAppID      = "nrc_app_id"
+	FieldNRCSources    = "nrc_sources"
+
+	FieldShoeID          = "shoe_id"
+	FieldShoeName        = "shoe_name"
+	FieldNote            = "note"
+	FieldWeather         = "weather"
+	FieldTemperature     = "temperature"
+	FieldTerrain         = "terrain"
+	FieldPerceivedEffort = "perceived_effort"
+	FieldMood            = "mood"
+
+	FieldDescription = "description"
+	FieldGearID      = "gear_id"
+)
+
+// developerFields lists the string fields written on the Session message, the position is the field number.
+// New fields must be appended to keep the numbers of the files already written.
+var developerFields = []string{
+	FieldTitle,
+	FieldNRCActivityID,
+	FieldNRCAppID,
+	FieldNRCSources,
+	FieldShoeID,
+	FieldShoeName,
+	FieldNote,
+	FieldWeather,
+	FieldTemperature,
+	FieldTerrain,
+	FieldPerceivedEffort,
+	FieldMood,
+	FieldDescription,
+	FieldGearID,
+}
+
+// maxStringSize is the size of the longest string value a FIT field can hold, including the null terminator
+const maxStringSize = 255
+
+// NewDeveloperDataId returns the DeveloperDataId referenced by the FieldDescriptions
+func NewDeveloperDataId() *mesgdef.DeveloperDataId {
+	return mesgdef.NewDeveloperDataId(nil).
+		SetApplicationId([]byte{99}).
+		SetDeveloperDataIndex(DeveloperDataIndex)
+}
+
+// NewFieldDescriptions returns the FieldDescriptions of the developer fields
+func NewFieldDescriptions() []*mesgdef.FieldDescription {
+	fieldDescriptions := make([]*mesgdef.FieldDescription, 0, len(developerFields))
+
+	for num, name := range developerFields {
+		fieldDescriptions = append(fieldDescriptions, mesgdef.NewFieldDescription(nil).
+			SetDeveloperDataIndex(DeveloperDataIndex).
+			SetFieldDefinitionNumber(uint8(num)).
+			SetFitBaseTypeId(basetype.String).
+			SetFieldName([]string{name}).
+			SetNativeMesgNum(typedef.MesgNumSession),
+		)
+	}
+
+	return fieldDescriptions
+}
+
+// NewDeveloperFields returns the developer fields having a value, ready to be set on the Session
+func NewDeveloperFields(values map[string]string) []proto.DeveloperField {
+	fields := []proto.DeveloperField{}
+
+	for num, name := range developerFields {
+		value, ok := values[name]
+		if !ok || len(value) == 0 {
+			continue
+		}
+
+		fields = append(fields, proto.DeveloperField{
+			Num:                uint8(num),
+			DeveloperDataIndex: DeveloperDataIndex,
+			Value:              proto.String(truncateString(value, maxStringSize-1)),
+		})
+	}
+
+	return fields
+}
+
+// DeveloperFieldValue returns the value of the field set by NewDeveloperFields, empty if the field is missing
+func DeveloperFieldValue(fields []proto.DeveloperField, name string) string {
+	num := slices.Index(developerFields, name)
+	for _, field := range fields {
+		if int(field.Num) == num && field.DeveloperDataIndex == DeveloperDataIndex && field.Value.Type() == proto.TypeString {
+			return field.Value.String()
+		}
+	}
+
+	return ""
+}
+
+// ResolveDeveloperFields returns the string developer fields of the message, by field name
+func ResolveDeveloperFields(fit *proto.FIT, mesgNum typedef.MesgNum) map[string]string {
+	values := map[string]string{}
+
+	// Map the field numbers to their names
+	type fieldKey struct {
+		developerDataIndex uint8
+		num                uint8
+	}
+	names := map[fieldKey]string{}
+
+	for i := range fit.Messages {
+		mesg := &fit.Messages[i]
+
+		if mesg.Num == typedef.MesgNumFieldDescription {
+			fieldDescription := mesgdef.NewFieldDescription(mesg)
+			if len(fieldDescription.FieldName) == 0 {
+				continue
+			}
+
+			key := fieldKey{fieldDescription.DeveloperDataIndex, fieldDescription.FieldDefinitionNumber}
+			names[key] = fieldDescription.FieldName[0]
+			continue
+		}
+
+		if mesg.Num != mesgNum {
+			continue
+		}
+
+		for _, field := range mesg.DeveloperFields {
+			name, ok := names[fieldKey{field.DeveloperDataIndex, field.Num}]
+			if !ok || field.Value.Type() != proto.TypeString {
+				continue
+			}
+
+			values[name] = field.Value.String()
+		}
+	}
+
+	return values
+}
+
+// MetadataFields returns the developer field values of the run metadata
+func MetadataFields(metadata types.RunMetadata) map[string]string {
+	return map[string]string{
+		FieldShoeID:          metadata.ShoeID,
+		FieldShoeName:        metadata.ShoeName,
+		FieldNote:            metadata.Note,
+		FieldWeather:         metadata.Weather,
+		FieldTemperature:     metadata.Temperature,
+		FieldTerrain:         metadata.Terrain,
+		FieldPerceivedEffort: metadata.PerceivedEffort,
+		FieldMood:            metadata.Mood,
+	}
+}
+
+// MetadataFromFields builds the run metadata from the resolved developer fields
+func MetadataFromFields(values map[string]string) types.RunMetadata {
+	return types.RunMetadata{
+		ShoeID:          values[FieldShoeID],
+		ShoeName:        values[FieldShoeName],
+		Note:            values[FieldNote],
+		Weather:         values[FieldWeather],
+		Temperature:     values[FieldTemperature],
+		Terrain:         values[FieldTerrain],
+		PerceivedEffort: values[FieldPerceivedEffort],
+		Mood:            values[FieldMood],
+	}
+}
+
+// truncateString cuts the string to at most size bytes without breaking a UTF-8 character
+func truncateString(value string, size int) string {
+	if len(value) <= size {
+		return value
+	}
+
+	value = value[:size]
+	for len(value) > 0 && !utf8.ValidString(value) {
+		value = value[:len(value)-1]
+	}
+
+	return value
+}
@@ -0,0 +1,70 @@
+package fit_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/muktihari/fit/decoder"
+	"github.com/muktihari/fit/profile/typedef"
+	"github.com/mxdc/nrc2strava/fit"
+)
+
+// TestDeveloperFieldsRoundTrip writes the developer fields into a FIT file and resolves them by name from the decoded file
+func TestDeveloperFieldsRoundTrip(t *testing.T) {
+	// The values hold at most 254 bytes, 'é' takes 2 bytes
+	atLimit := strings.Repeat("a", 252) + "é"
+	overLimit := strings.Repeat("a", 253) + "é"
+
+	values := map[string]string{
+		fit.FieldTitle:         "Course du matin à Montréal 🏃",
+		fit.FieldNRCActivityID: "c0a1b2c3-0001-4000-8000-000000000001",
+		fit.FieldNote:          atLimit,
+		fit.FieldDescription:   overLimit,
+		fit.FieldGearID:        "",
+		"unknown":              "ignored",
+	}
+	want := map[string]string{
+		fit.FieldTitle:         values[fit.FieldTitle],
+		fit.FieldNRCActivityID: values[fit.FieldNRCActivityID],
+		fit.FieldNote:          atLimit,
+		fit.FieldDescription:   strings.Repeat("a", 253),
+	}
+
+	run := convertCorpusRun(t, "outdoor")
+	session := run.Activity.Sessions[0]
+	session.SetDeveloperFields(fit.NewDeveloperFields(values)...)
+
+	var encoded bytes.Buffer
+	if err := fit.WriteFIT(&encoded, run); err != nil {
+		t.Fatalf("WriteFIT() error = %v", err)
+	}
+	decoded, err := decoder.New(&encoded).Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	resolved := fit.ResolveDeveloperFields(decoded, typedef.MesgNumSession)
+	if len(resolved) != len(want) {
+		t.Errorf("ResolveDeveloperFields() = %d fields %v, want %d", len(resolved), resolved, len(want))
+	}
+	for name, value := range want {
+		if resolved[name] != value {
+			t.Errorf("field %s = %q, want %q", name, resolved[name], value)
+		}
+		if !utf8.ValidString(resolved[name]) {
+			t.Errorf("field %s is not valid UTF-8: %q", name, resolved[name])
+		}
+
+		// The fields set on the session are read back the same
+		if got := fit.DeveloperFieldValue(session.DeveloperFields, name); got != value {
+			t.Errorf("DeveloperFieldValue(%s) = %q, want %q", name, got, value)
+		}
+	}
+
+	// The fields of another message are not resolved
+	if records := fit.ResolveDeveloperFields(decoded, typedef.MesgNumRecord); len(records) > 0 {
+		t.Errorf("ResolveDeveloperFields() of the records = %v, want none", records)
+	}
+}
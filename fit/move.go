@@ -1,6 +1,7 @@
 package fit
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -21,22 +22,22 @@ func InitActivityMover(outputDir string) *ActivityMover {
 	var mover ActivityMover
 
 	mover.destinationDir = outputDir
-	mover.logger = logrus.New()
-	mover.logger.SetFormatter(utils.LogFormat)
+	mover.logger = utils.Logger
 
 	return &mover
 }
 
 // MoveFIT moves FIT files
-func (m *ActivityMover) MoveFIT(source, filename string) {
+func (m *ActivityMover) MoveFIT(source, filename string) error {
 	if err := os.MkdirAll(m.destinationDir, os.ModePerm); err != nil {
-		m.logger.Fatalf("Error creating directory: %v", err)
+		return fmt.Errorf("error creating directory: %w", err)
 	}
 
 	destination := filepath.Join(m.destinationDir, filename)
 	if err := os.Rename(source, destination); err != nil {
-		m.logger.Fatalf("Error moving file: %v", err)
+		return fmt.Errorf("error moving file: %w", err)
 	}
 
 	m.logger.Debugf("Moved file to: %s\n", destination)
+	return nil
 }
@@ -0,0 +1,308 @@
+package fit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/muktihari/fit/decoder"
+	"github.com/muktihari/fit/profile/filedef"
+	"github.com/muktihari/fit/profile/mesgdef"
+	"github.com/muktihari/fit/profile/typedef"
+	"github.com/mxdc/nrc2strava/report"
+	"github.com/mxdc/nrc2strava/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// distanceTolerance is the relative difference allowed between the session
+// total distance and the distance of the last record
+const distanceTolerance = 0.02
+
+// durationTolerance is the difference in seconds allowed between the session
+// elapsed time and the time covered by the records
+const durationTolerance = 2.0
+
+// ActivityValidator checks FIT files before they are uploaded
+type ActivityValidator struct {
+	FitDir string
+
+	// Report records the outcome of each validation, if set
+	Report *report.Report
+
+	// logger
+	logger *logrus.Logger
+}
+
+// InitActivityValidator returns an initialized ActivityValidator
+func InitActivityValidator(fitDir string) *ActivityValidator {
+	var validator ActivityValidator
+
+	validator.FitDir = fitDir
+	validator.logger = utils.Logger
+
+	return &validator
+}
+
+// ValidateActivities validates every FIT file of the directory and returns the number of invalid files
+func (v *ActivityValidator) ValidateActivities() (int, error) {
+	files, err := os.ReadDir(v.FitDir)
+	if err != nil {
+		return 0, fmt.Errorf("error reading directory: %w", err)
+	}
+
+	// Count .fit files
+	fitFiles := []os.DirEntry{}
+	for _, file := range files {
+		if filepath.Ext(file.Name()) == ".fit" {
+			fitFiles = append(fitFiles, file)
+		}
+	}
+
+	total := len(fitFiles)
+	if total == 0 {
+		v.logger.Error("No .fit files to validate")
+		return 0, nil
+	}
+
+	v.logger.Infof("Validating %d activities...\n", total)
+
+	invalidCount := 0
+	for _, file := range fitFiles {
+		filePath := filepath.Join(v.FitDir, file.Name())
+		if problems := v.ValidateFIT(filePath); len(problems) > 0 {
+			invalidCount++
+		}
+	}
+
+	v.logger.Infof("✓ Finished validating %d activities, %d valid, %d invalid\n", total, total-invalidCount, invalidCount)
+	return invalidCount, nil
+}
+
+// ValidateFIT decodes a FIT file and returns the problems found, if any
+func (v *ActivityValidator) ValidateFIT(filePath string) []string {
+	v.logger.Debugf("Validating file: %s\n", filePath)
+
+	problems := validateFile(filePath)
+	for _, problem := range problems {
+		v.logger.Warnf("✗ %s: %s\n", filepath.Base(filePath), problem)
+	}
+
+	if len(problems) == 0 {
+		v.logger.Infof("✓ %s\n", filepath.Base(filePath))
+		v.Report.AddProcessed("", filePath)
+	} else {
+		v.Report.AddFailed("", filePath, errors.New(strings.Join(problems, "; ")))
+	}
+
+	return problems
+}
+
+func validateFile(filePath string) []string {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return []string{fmt.Sprintf("error opening file: %v", err)}
+	}
+	defer file.Close()
+
+	// The decoder verifies the header and file CRC while decoding
+	fit, err := decoder.New(file).Decode()
+	if err != nil {
+		if errors.Is(err, decoder.ErrCRCChecksumMismatch) {
+			return []string{"CRC checksum mismatch"}
+		}
+		return []string{fmt.Sprintf("error decoding file: %v", err)}
+	}
+
+	problems := []string{}
+
+	// Required messages
+	counts := map[typedef.MesgNum]int{}
+	for _, mesg := range fit.Messages {
+		counts[mesg.Num]++
+	}
+
+	required := []typedef.MesgNum{
+		typedef.MesgNumFileId,
+		typedef.MesgNumSession,
+		typedef.MesgNumLap,
+		typedef.MesgNumActivity,
+	}
+	for _, num := range required {
+		if counts[num] == 0 {
+			problems = append(problems, fmt.Sprintf("missing required %s message", num))
+		}
+	}
+
+	activity := filedef.NewActivity(fit.Messages...)
+
+	problems = append(problems, validateRecords(activity.Records)...)
+	if len(activity.Records) == 0 {
+		return problems
+	}
+
+	// Each session is checked against the records between its start and end
+	problems = append(problems, validateRecordsInSessions(activity.Sessions, activity.Records)...)
+	for _, session := range activity.Sessions {
+		records, startDistance := sessionRecords(session, activity.Records)
+		problems = append(problems, validateSession(session, records, startDistance)...)
+	}
+
+	return problems
+}
+
+// validateRecords checks timestamps are monotonic and distance never decreases
+func validateRecords(records []*mesgdef.Record) []string {
+	problems := []string{}
+
+	if len(records) == 0 {
+		return append(problems, "no records")
+	}
+
+	previousDistance := math.NaN()
+	for i, record := range records {
+		if i > 0 && record.Timestamp.Before(records[i-1].Timestamp) {
+			problems = append(problems, fmt.Sprintf(
+				"record %d: timestamp %s is before previous timestamp %s",
+				i, record.Timestamp.Format("15:04:05"), records[i-1].Timestamp.Format("15:04:05"),
+			))
+		}
+
+		distance := record.DistanceScaled()
+		if math.IsNaN(distance) {
+			continue
+		}
+
+		if !math.IsNaN(previousDistance) && distance < previousDistance {
+			problems = append(problems, fmt.Sprintf(
+				"record %d: distance decreases from %.2fm to %.2fm",
+				i, previousDistance, distance,
+			))
+		}
+		previousDistance = distance
+	}
+
+	return problems
+}
+
+// validateRecordsInSessions checks every record falls within a session, the first one outside is reported
+func validateRecordsInSessions(sessions []*mesgdef.Session, records []*mesgdef.Record) []string {
+	problems := []string{}
+
+	if len(sessions) == 0 {
+		return problems
+	}
+
+	for i, record := range records {
+		inSession := false
+		for _, session := range sessions {
+			inSession = inSession || withinSession(session, record)
+		}
+
+		if !inSession {
+			problems = append(problems, fmt.Sprintf(
+				"record %d: timestamp %s is outside every session",
+				i, record.Timestamp.Format("15:04:05"),
+			))
+			break
+		}
+	}
+
+	return problems
+}
+
+// withinSession reports whether the record is between the session start and end
+func withinSession(session *mesgdef.Session, record *mesgdef.Record) bool {
+	return !record.Timestamp.Before(session.StartTime) && !record.Timestamp.After(session.Timestamp)
+}
+
+// sessionRecords returns the records of the session, and the distance of the last record before it.
+// The record distances are cumulated over the file, the session covers the distance from there.
+func sessionRecords(session *mesgdef.Session, records []*mesgdef.Record) ([]*mesgdef.Record, float64) {
+	within := []*mesgdef.Record{}
+	startDistance := 0.0
+
+	for _, record := range records {
+		if withinSession(session, record) {
+			within = append(within, record)
+		} else if distance := record.DistanceScaled(); record.Timestamp.Before(session.StartTime) && !math.IsNaN(distance) {
+			startDistance = distance
+		}
+	}
+
+	return within, startDistance
+}
+
+// validateSession checks the session totals are consistent with its records
+func validateSession(session *mesgdef.Session, records []*mesgdef.Record, startDistance float64) []string {
+	problems := []string{}
+
+	if len(records) == 0 {
+		return append(problems, fmt.Sprintf(
+			"session: no records between %s and %s",
+			session.StartTime.Format("15:04:05"), session.Timestamp.Format("15:04:05"),
+		))
+	}
+
+	first := records[0]
+	last := records[len(records)-1]
+
+	elapsedTime := session.TotalElapsedTimeScaled()
+	recordsDuration := last.Timestamp.Sub(first.Timestamp).Seconds()
+	if !math.IsNaN(elapsedTime) && recordsDuration-elapsedTime > durationTolerance {
+		problems = append(problems, fmt.Sprintf(
+			"session: records cover %.0fs but total elapsed time is %.0fs",
+			recordsDuration, elapsedTime,
+		))
+	}
+
+	timerTime := session.TotalTimerTimeScaled()
+	if !math.IsNaN(elapsedTime) && !math.IsNaN(timerTime) && timerTime > elapsedTime {
+		problems = append(problems, fmt.Sprintf(
+			"session: total timer time %.0fs exceeds total elapsed time %.0fs",
+			timerTime, elapsedTime,
+		))
+	}
+
+	totalDistance := session.TotalDistanceScaled()
+	recordsDistance := lastRecordDistance(records) - startDistance
+	if !math.IsNaN(totalDistance) && !math.IsNaN(recordsDistance) {
+		if math.Abs(totalDistance-recordsDistance) > totalDistance*distanceTolerance {
+			problems = append(problems, fmt.Sprintf(
+				"session: total distance %.2fm differs from records distance %.2fm",
+				totalDistance, recordsDistance,
+			))
+		}
+	}
+
+	maxSpeed := session.MaxSpeedScaled()
+	if !math.IsNaN(maxSpeed) {
+		for _, record := range records {
+			speed := record.SpeedScaled()
+			// max speed is stored in mm/s, allow the rounding error
+			if !math.IsNaN(speed) && speed-maxSpeed > 0.001 {
+				problems = append(problems, fmt.Sprintf(
+					"session: record at %s speed %.3fm/s exceeds max speed %.3fm/s",
+					record.Timestamp.Format("15:04:05"), speed, maxSpeed,
+				))
+				break
+			}
+		}
+	}
+
+	return problems
+}
+
+// lastRecordDistance returns the distance of the last record having one
+func lastRecordDistance(records []*mesgdef.Record) float64 {
+	for i := len(records) - 1; i >= 0; i-- {
+		distance := records[i].DistanceScaled()
+		if !math.IsNaN(distance) {
+			return distance
+		}
+	}
+
+	return math.NaN()
+}
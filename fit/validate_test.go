@@ -0,0 +1,209 @@
+package fit_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/muktihari/fit/encoder"
+	"github.com/muktihari/fit/profile/typedef"
+	"github.com/muktihari/fit/proto"
+	"github.com/mxdc/nrc2strava/converter"
+	"github.com/mxdc/nrc2strava/fit"
+	"github.com/mxdc/nrc2strava/parser"
+	"github.com/mxdc/nrc2strava/report"
+	"github.com/mxdc/nrc2strava/types"
+)
+
+// convertCorpusRun converts a run of the converter corpus
+func convertCorpusRun(t *testing.T, name string) types.Run {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("../converter/testdata/corpus", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	nikeActivity, err := parser.ParseActivity(f)
+	if err != nil {
+		t.Fatalf("ParseActivity() error = %v", err)
+	}
+
+	return converter.InitActivitiesConverter().ConvertRun(nikeActivity)
+}
+
+// unchanged keeps the messages of the run
+func unchanged(*proto.FIT) {}
+
+// writeMessages encodes the run into a FIT file of the directory, with its messages altered by corrupt.
+// The messages are encoded as is, Activity.ToFIT would sort the records again.
+func writeMessages(t *testing.T, dir string, run types.Run, corrupt func(*proto.FIT)) string {
+	t.Helper()
+
+	filePath := filepath.Join(dir, run.Id+".fit")
+	f, err := os.Create(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	messages := run.Activity.ToFIT(nil)
+	corrupt(&messages)
+	if err := encoder.New(f, encoder.WithProtocolVersion(proto.V2)).Encode(&messages); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	return filePath
+}
+
+// withoutMessages removes the messages of the kind
+func withoutMessages(num typedef.MesgNum) func(*proto.FIT) {
+	return func(messages *proto.FIT) {
+		kept := messages.Messages[:0]
+		for _, mesg := range messages.Messages {
+			if mesg.Num != num {
+				kept = append(kept, mesg)
+			}
+		}
+		messages.Messages = kept
+	}
+}
+
+// swapRecordTimestamps swaps the timestamps of the records 10 and 11
+func swapRecordTimestamps(messages *proto.FIT) {
+	records := []*proto.Message{}
+	for i := range messages.Messages {
+		if messages.Messages[i].Num == typedef.MesgNumRecord {
+			records = append(records, &messages.Messages[i])
+		}
+	}
+
+	first, second := records[10].FieldByNum(proto.FieldNumTimestamp), records[11].FieldByNum(proto.FieldNumTimestamp)
+	first.Value, second.Value = second.Value, first.Value
+}
+
+func TestValidateFIT(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(*proto.FIT)
+		want    string
+	}{
+		{"valid", unchanged, ""},
+		{"no records", withoutMessages(typedef.MesgNumRecord), "no records"},
+		{"timestamps going backwards", swapRecordTimestamps, "record 11: timestamp"},
+		{"no session", withoutMessages(typedef.MesgNumSession), "missing required session message"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := convertCorpusRun(t, "outdoor")
+			run.Id = strings.ReplaceAll(tt.name, " ", "_")
+			filePath := writeMessages(t, t.TempDir(), run, tt.corrupt)
+
+			validator := fit.InitActivityValidator("")
+			validator.Report = report.NewReport("validate")
+			problems := validator.ValidateFIT(filePath)
+
+			if len(tt.want) == 0 {
+				if len(problems) > 0 || validator.Report.Processed != 1 {
+					t.Errorf("ValidateFIT() = %v, want no problem", problems)
+				}
+				return
+			}
+
+			found := false
+			for _, problem := range problems {
+				found = found || strings.Contains(problem, tt.want)
+			}
+			if !found || validator.Report.Failed != 1 {
+				t.Errorf("ValidateFIT() = %v, want a problem containing %q", problems, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateActivities(t *testing.T) {
+	dir := t.TempDir()
+
+	writeMessages(t, dir, convertCorpusRun(t, "outdoor"), unchanged)
+	writeMessages(t, dir, convertCorpusRun(t, "treadmill"), withoutMessages(typedef.MesgNumRecord))
+
+	invalidCount, err := fit.InitActivityValidator(dir).ValidateActivities()
+	if err != nil || invalidCount != 1 {
+		t.Errorf("ValidateActivities() = %d, %v, want 1 invalid file", invalidCount, err)
+	}
+}
+
+// splitSession splits the session of the run in two, the second session starting at the record
+func splitSession(run types.Run, at int) {
+	records := run.Activity.Records
+	first := run.Activity.Sessions[0]
+	second := *first
+
+	end := records[at-1]
+	duration := end.Timestamp.Sub(first.StartTime).Seconds()
+	first.SetTimestamp(end.Timestamp).
+		SetTotalElapsedTimeScaled(duration).
+		SetTotalTimerTimeScaled(duration).
+		SetTotalDistanceScaled(end.DistanceScaled())
+
+	start := records[at]
+	duration = second.Timestamp.Sub(start.Timestamp).Seconds()
+	second.SetStartTime(start.Timestamp).
+		SetTotalElapsedTimeScaled(duration).
+		SetTotalTimerTimeScaled(duration).
+		SetTotalDistanceScaled(second.TotalDistanceScaled() - end.DistanceScaled())
+
+	run.Activity.Sessions = append(run.Activity.Sessions, &second)
+	run.Activity.Activity.SetNumSessions(2)
+}
+
+// TestValidateFITSessions checks each session against the records between its start and end
+func TestValidateFITSessions(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(run types.Run)
+		want   string
+	}{
+		{"two sessions", func(run types.Run) { splitSession(run, 60) }, ""},
+		{"second session distance", func(run types.Run) {
+			splitSession(run, 60)
+			second := run.Activity.Sessions[1]
+			second.SetTotalDistanceScaled(second.TotalDistanceScaled() * 2)
+		}, "session: total distance"},
+		{"records between the sessions", func(run types.Run) {
+			splitSession(run, 60)
+			run.Activity.Sessions[1].SetStartTime(run.Activity.Records[70].Timestamp)
+		}, "record 60: timestamp"},
+		{"record before the session", func(run types.Run) {
+			session := run.Activity.Sessions[0]
+			session.SetStartTime(session.StartTime.Add(time.Second))
+		}, "record 0: timestamp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := convertCorpusRun(t, "outdoor")
+			tt.modify(run)
+			filePath := writeMessages(t, t.TempDir(), run, unchanged)
+
+			problems := fit.InitActivityValidator("").ValidateFIT(filePath)
+			if len(tt.want) == 0 {
+				if len(problems) > 0 {
+					t.Errorf("ValidateFIT() = %v, want no problem", problems)
+				}
+				return
+			}
+
+			found := false
+			for _, problem := range problems {
+				found = found || strings.Contains(problem, tt.want)
+			}
+			if !found {
+				t.Errorf("ValidateFIT() = %v, want a problem containing %q", problems, tt.want)
+			}
+		})
+	}
+}
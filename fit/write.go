@@ -1,11 +1,14 @@
 package fit
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
 	"github.com/muktihari/fit/encoder"
 	"github.com/muktihari/fit/profile/typedef"
+	"github.com/muktihari/fit/proto"
 	"github.com/mxdc/nrc2strava/types"
 	"github.com/mxdc/nrc2strava/utils"
 	"github.com/sirupsen/logrus"
@@ -24,38 +27,47 @@ func InitActivityWriter(outputDir string) *ActivityWriter {
 	var writer ActivityWriter
 
 	writer.OutputDir = outputDir
-	writer.logger = logrus.New()
-	writer.logger.SetFormatter(utils.LogFormat)
+	writer.logger = utils.Logger
 
 	return &writer
 }
 
-// LoadActivities load JSON files into memory
-func (w *ActivityWriter) WriteFIT(run types.Run) string {
+// WriteFIT encodes the run into a FIT file of the output directory and returns its path
+func (w *ActivityWriter) WriteFIT(run types.Run) (string, error) {
 	// Ensure the output directory exists
 	if err := os.MkdirAll(w.OutputDir, os.ModePerm); err != nil {
-		panic(err)
+		return "", fmt.Errorf("error creating output directory: %w", err)
 	}
 
-	// Convert back to FIT protocol messages
-	fit := run.Activity.ToFIT(nil)
-
 	outputFilename := w.generateFilename(run)
 
 	w.logger.Debugf("Writing file at %s", outputFilename)
 
 	f, err := os.OpenFile(outputFilename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
 	if err != nil {
-		w.logger.Fatalf("Error opening file: %v", err)
+		return "", fmt.Errorf("error opening file: %w", err)
 	}
 	defer f.Close()
 
-	enc := encoder.New(f)
+	if err := WriteFIT(f, run); err != nil {
+		return "", err
+	}
+
+	return outputFilename, nil
+}
+
+// WriteFIT encodes the run as a FIT file into the writer
+func WriteFIT(w io.Writer, run types.Run) error {
+	// Convert back to FIT protocol messages
+	fit := run.Activity.ToFIT(nil)
+
+	// Developer fields require the protocol version 2.0
+	enc := encoder.New(w, encoder.WithProtocolVersion(proto.V2))
 	if err := enc.Encode(&fit); err != nil {
-		w.logger.Fatalf("Error encoding FIT file: %v", err)
+		return fmt.Errorf("error encoding FIT file: %w", err)
 	}
 
-	return outputFilename
+	return nil
 }
 
 func (w *ActivityWriter) generateFilename(run types.Run) string {
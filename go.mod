@@ -6,6 +6,7 @@ require (
 	github.com/alecthomas/kingpin/v2 v2.4.0
 	github.com/muktihari/fit v0.24.5
 	golang.org/x/net v0.39.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -1,59 +1,89 @@
 package migrator
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/mxdc/nrc2strava/converter"
 	"github.com/mxdc/nrc2strava/fit"
 	"github.com/mxdc/nrc2strava/nrc"
+	"github.com/mxdc/nrc2strava/report"
 	"github.com/mxdc/nrc2strava/strava"
 	"github.com/mxdc/nrc2strava/types"
 	"github.com/mxdc/nrc2strava/utils"
 	"github.com/sirupsen/logrus"
 )
 
+// DefaultUploadInterval is the pause between two uploads, to stay under the Strava rate limit
+const DefaultUploadInterval = 10 * time.Second
+
 // Migrator represents the Migrator client
 type Migrator struct {
 	nikeApi      *nrc.NikeApi
 	stravaWeb    *strava.StravaWeb
 	FitOutputDir string
-	logger       *logrus.Logger
+	GearMapping  map[string]string
+
+	// UploadInterval is the pause between two activities
+	UploadInterval time.Duration
+
+	// ActivitiesConverter converts the downloaded activities, it can be configured before migrating
+	ActivitiesConverter *converter.ActivitiesConverter
+
+	// Report records the outcome of each activity, if set
+	Report *report.Report
+
+	logger *logrus.Logger
 }
 
 // NewMigrator initializes a new NewMigrator instance
 func NewMigrator(nikeApi *nrc.NikeApi, stravaWeb *strava.StravaWeb, FitOutputDir string) *Migrator {
-	logger := logrus.New()
-	logger.SetFormatter(utils.LogFormat)
+	logger := utils.Logger
 
 	return &Migrator{
 		nikeApi:      nikeApi,
 		stravaWeb:    stravaWeb,
 		FitOutputDir: FitOutputDir,
-		logger:       logger,
+
+		UploadInterval: DefaultUploadInterval,
+
+		ActivitiesConverter: converter.InitActivitiesConverter(),
+
+		logger: logger,
 	}
 }
 
-// MigrateActivities migrates activities from Nike to Strava
-func (m *Migrator) MigrateActivities() {
-	activitiesIds, err := m.nikeApi.GetActivityList()
+// MigrateActivities migrates activities from Nike to Strava, the activities which fail are skipped
+// unless the error would repeat for the remaining ones
+func (m *Migrator) MigrateActivities(ctx context.Context) error {
+	activitiesIds, err := m.nikeApi.GetActivityList(ctx)
 	if err != nil {
-		m.logger.Errorf("Error fetching activity list: %v\n", err)
-		return
+		return err
 	}
 
 	m.logger.Infof("Total activity(s) to migrate: %d\n", len(activitiesIds))
 
-	activitiesConverter := converter.InitActivitiesConverter()
 	activityWriter := fit.InitActivityWriter(m.FitOutputDir)
 
 	total := len(activitiesIds)
 	for index, activityID := range activitiesIds {
+		// Stop between two activities when canceled
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		m.logger.Debugf("Migrating activity ID: %s\n", activityID)
 
 		// Fetch activity details with retry logic
-		activityDetails, err := m.nikeApi.GetActivityDetailsWithRetry(activityID, 3)
+		activityDetails, err := m.nikeApi.GetActivityDetailsWithRetry(ctx, activityID, 3)
 		if err != nil {
+			m.Report.AddFailed(activityID, "", err)
+			if utils.ShouldAbort(err) || ctx.Err() != nil {
+				return fmt.Errorf("migration error: %w", err)
+			}
+
 			m.logger.Errorf("Migration error: %v\n", err)
 			continue
 		}
@@ -63,16 +93,40 @@ func (m *Migrator) MigrateActivities() {
 		err = json.Unmarshal(activityDetails, &activity)
 		if err != nil {
 			m.logger.Errorf("Error parsing JSON:, %v", err)
+			m.Report.AddFailed(activityID, "", fmt.Errorf("error parsing JSON: %w", err))
 			continue
 		}
 
-		run := activitiesConverter.ConvertRun(&activity)
-		outputFilename := activityWriter.WriteFIT(run)
+		if m.ActivitiesConverter.IsExcluded(&activity) {
+			m.logger.Infof("Skipping excluded activity ID: %s\n", activityID)
+			m.Report.AddSkipped(activityID, "", "excluded by override")
+			continue
+		}
+
+		run := m.ActivitiesConverter.ConvertRun(&activity)
+		outputFilename, err := activityWriter.WriteFIT(run)
+		if err != nil {
+			m.logger.Errorf("Error writing activity ID %s: %v\n", activityID, err)
+			m.Report.AddFailed(activityID, "", err)
+			continue
+		}
 		stravaUploader := strava.NewStravaUploader(outputFilename, m.stravaWeb)
-		stravaUploader.UploadActivity(outputFilename)
+		stravaUploader.GearMapping = m.GearMapping
+		stravaUploader.Report = m.Report
+		if err := stravaUploader.UploadActivity(ctx, outputFilename); err != nil {
+			if utils.ShouldAbort(err) || ctx.Err() != nil {
+				return fmt.Errorf("migration error: %w", err)
+			}
+
+			m.logger.Errorf("Error uploading activity ID %s: %v\n", activityID, err)
+		}
 		if index < total-1 {
-			m.logger.Debug("Waiting for 10 seconds before processing the next file...")
-			time.Sleep(10 * time.Second)
+			m.logger.Debugf("Waiting for %s before processing the next file...\n", m.UploadInterval)
+			if err := utils.Sleep(ctx, m.UploadInterval); err != nil {
+				return err
+			}
 		}
 	}
+
+	return nil
 }
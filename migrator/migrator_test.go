@@ -0,0 +1,124 @@
+package migrator_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mxdc/nrc2strava/migrator"
+	"github.com/mxdc/nrc2strava/nrc"
+	"github.com/mxdc/nrc2strava/nrc/nrctest"
+	"github.com/mxdc/nrc2strava/report"
+	"github.com/mxdc/nrc2strava/strava"
+	"github.com/mxdc/nrc2strava/strava/stravatest"
+	"github.com/mxdc/nrc2strava/utils"
+)
+
+const (
+	accessToken = "test-token"
+	session     = "test-session"
+)
+
+// newMigrator returns a migrator between a fake NRC API and a fake Strava website
+func newMigrator(t *testing.T) (*migrator.Migrator, *nrctest.Server, *stravatest.Server) {
+	t.Helper()
+
+	nrcServer, err := nrctest.NewServer(filepath.Join("..", "nrc", "testdata", "activities"), accessToken)
+	if err != nil {
+		t.Fatalf("error starting the fake NRC server: %v", err)
+	}
+	t.Cleanup(nrcServer.Close)
+
+	stravaServer := stravatest.NewServer(session)
+	t.Cleanup(stravaServer.Close)
+
+	nikeApi := nrc.NewNikeApi(accessToken)
+	nikeApi.SetBaseURL(nrcServer.URL)
+	nikeApi.HTTPClient = nrcServer.Client()
+	nikeApi.RetryDelay = 0
+
+	stravaWeb := strava.NewStravaWeb(session)
+	stravaWeb.SetBaseURL(stravaServer.URL)
+	stravaWeb.HTTPClient = stravaServer.Client()
+
+	migrate := migrator.NewMigrator(nikeApi, stravaWeb, t.TempDir())
+	migrate.UploadInterval = 0
+	migrate.Report = report.NewReport("migrate")
+
+	return migrate, nrcServer, stravaServer
+}
+
+func TestMigrateActivities(t *testing.T) {
+	migrate, _, stravaServer := newMigrator(t)
+	migrate.GearMapping = map[string]string{"abc-123": "g12345678"}
+
+	if err := migrate.MigrateActivities(context.Background()); err != nil {
+		t.Fatalf("MigrateActivities() error = %v", err)
+	}
+
+	// The manual run and the cycling activity aren't migrated
+	activities := stravaServer.Activities()
+	if len(activities) != 3 {
+		t.Fatalf("Strava has %d activities, want 3", len(activities))
+	}
+
+	for _, activity := range activities {
+		if activity.StartTime.IsZero() || activity.Distance <= 0 {
+			t.Errorf("activity %q created with start %s and distance %.0f", activity.Name, activity.StartTime, activity.Distance)
+		}
+	}
+
+	// Activities are sorted from the newest, the first NRC run is the last one
+	if gearID := activities[2].GearID; gearID != "g12345678" {
+		t.Errorf("first run gear = %q, want the mapped gear", gearID)
+	}
+
+	files, err := filepath.Glob(filepath.Join(migrate.FitOutputDir, "*.fit"))
+	if err != nil || len(files) != 3 {
+		t.Errorf("MigrateActivities() wrote %d FIT files, want 3", len(files))
+	}
+
+	if migrate.Report.Processed != 3 || migrate.Report.Failed != 0 {
+		t.Errorf("report processed = %d, failed = %d, want 3 and 0", migrate.Report.Processed, migrate.Report.Failed)
+	}
+}
+
+func TestMigrateActivitiesSkipsFailedDownload(t *testing.T) {
+	migrate, nrcServer, stravaServer := newMigrator(t)
+	nrcServer.FailDetails("0a1b2c3d-0002", http.StatusNotFound)
+
+	if err := migrate.MigrateActivities(context.Background()); err != nil {
+		t.Fatalf("MigrateActivities() error = %v", err)
+	}
+
+	if uploads := stravaServer.Uploads(); len(uploads) != 2 {
+		t.Errorf("Strava received %d uploads, want 2", len(uploads))
+	}
+
+	if migrate.Report.Processed != 2 || migrate.Report.Failed != 1 {
+		t.Errorf("report processed = %d, failed = %d, want 2 and 1", migrate.Report.Processed, migrate.Report.Failed)
+	}
+}
+
+func TestMigrateActivitiesAbortsOnRateLimit(t *testing.T) {
+	migrate, _, stravaServer := newMigrator(t)
+	stravaServer.FailUploads(http.StatusTooManyRequests)
+
+	err := migrate.MigrateActivities(context.Background())
+	if !errors.Is(err, utils.ErrRateLimited) {
+		t.Fatalf("MigrateActivities() error = %v, want ErrRateLimited", err)
+	}
+
+	// The FIT file of the first run is kept to be uploaded later
+	files, _ := os.ReadDir(migrate.FitOutputDir)
+	if len(files) != 1 {
+		t.Errorf("MigrateActivities() wrote %d FIT files, want 1", len(files))
+	}
+
+	if migrate.Report.Failed != 1 {
+		t.Errorf("report failed = %d, want 1", migrate.Report.Failed)
+	}
+}
@@ -1,37 +1,64 @@
 package nrc
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/mxdc/nrc2strava/utils"
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	// DefaultBaseURL is the base URL of the Nike API
+	DefaultBaseURL = "https://api.nike.com"
+
+	// DefaultRetryDelay is the pause between two attempts to fetch the activity details
+	DefaultRetryDelay = 10 * time.Second
+)
+
 // NikeApi represents the Nike API client
 type NikeApi struct {
 	ActivityListURL        string
 	ActivityListPagination string
 	ActivityDetailsURL     string
 	AccessToken            string
-	logger                 *logrus.Logger
+
+	// HTTPClient sends the requests, it can be replaced to set timeouts or a transport
+	HTTPClient *http.Client
+
+	// RetryDelay is the pause between two attempts to fetch the activity details
+	RetryDelay time.Duration
+
+	logger *logrus.Logger
 }
 
 // NewNikeApi initializes a new NikeApi instance
 func NewNikeApi(accessToken string) *NikeApi {
-	logger := logrus.New()
-	logger.SetFormatter(utils.LogFormat)
-
-	return &NikeApi{
-		ActivityListURL:    "https://api.nike.com/plus/v3/activities/before_id/v3",
-		ActivityDetailsURL: "https://api.nike.com/sport/v3/me/activity/%s?metrics=ALL",
-		AccessToken:        accessToken,
-		logger:             logger,
+	logger := utils.Logger
+
+	nikeApi := &NikeApi{
+		AccessToken: accessToken,
+		HTTPClient:  utils.NewHTTPClient(utils.DefaultHTTPTimeouts),
+		RetryDelay:  DefaultRetryDelay,
+		logger:      logger,
 	}
+	nikeApi.SetBaseURL(DefaultBaseURL)
+
+	return nikeApi
+}
+
+// SetBaseURL points the endpoints to another server, e.g. a proxy or a fake server in tests
+func (n *NikeApi) SetBaseURL(baseURL string) {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	n.ActivityListURL = baseURL + "/plus/v3/activities/before_id/v3"
+	n.ActivityDetailsURL = baseURL + "/sport/v3/me/activity/%s?metrics=ALL"
 }
 
 type ActivitiesListResponse struct {
@@ -66,9 +93,9 @@ func (n *NikeApi) buildActivityListURL(beforeID string, params url.Values) (*url
 	return baseURL, nil
 }
 
-func (n *NikeApi) fetchActivityList(url string) (*ActivitiesListResponse, error) {
+func (n *NikeApi) fetchActivityList(ctx context.Context, url string) (*ActivitiesListResponse, error) {
 	// Create the HTTP request
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
@@ -77,7 +104,7 @@ func (n *NikeApi) fetchActivityList(url string) (*ActivitiesListResponse, error)
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", n.AccessToken))
 
 	// Send the request
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := n.HTTPClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("error sending request: %w", err)
 	}
@@ -85,7 +112,7 @@ func (n *NikeApi) fetchActivityList(url string) (*ActivitiesListResponse, error)
 
 	// Check for HTTP errors
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, utils.StatusError(resp)
 	}
 
 	// Parse the response
@@ -97,7 +124,7 @@ func (n *NikeApi) fetchActivityList(url string) (*ActivitiesListResponse, error)
 	return &response, nil
 }
 
-func (n *NikeApi) GetActivityList() ([]string, error) {
+func (n *NikeApi) GetActivityList(ctx context.Context) ([]string, error) {
 	n.logger.Info("Collecting activities from Nike API...")
 
 	var activityIDs []string
@@ -119,7 +146,7 @@ func (n *NikeApi) GetActivityList() ([]string, error) {
 		n.logger.Debugf("Opening page: %s\n", baseURL.String())
 
 		// Make the HTTP request
-		response, err := n.fetchActivityList(baseURL.String())
+		response, err := n.fetchActivityList(ctx, baseURL.String())
 		if err != nil {
 			return nil, fmt.Errorf("error fetching activity list: %w", err)
 		}
@@ -146,39 +173,48 @@ func (n *NikeApi) GetActivityList() ([]string, error) {
 	return activityIDs, nil
 }
 
-func (n *NikeApi) GetActivityDetailsWithRetry(activityID string, maxRetries int) ([]byte, error) {
+func (n *NikeApi) GetActivityDetailsWithRetry(ctx context.Context, activityID string, maxRetries int) ([]byte, error) {
 	var body []byte
 	var err error
 
 	for attempt := 1; attempt <= maxRetries; attempt++ {
 		n.logger.Debugf("Attempt %d to fetch activity details for %s\n", attempt, activityID)
 
-		body, err = n.GetActivityDetails(activityID)
+		body, err = n.GetActivityDetails(ctx, activityID)
 		if err == nil {
 			return body, nil
 		}
 
+		// Retrying doesn't help with an invalid token, a rate limit or a canceled migration
+		if utils.ShouldAbort(err) || ctx.Err() != nil {
+			return nil, err
+		}
+
 		n.logger.Warnf("Error fetching activity details (attempt %d): %v\n", attempt, err)
-		time.Sleep(10 * time.Second)
+		if attempt == maxRetries {
+			break
+		}
+		if err := utils.Sleep(ctx, n.RetryDelay); err != nil {
+			return nil, err
+		}
 	}
 
 	return nil, fmt.Errorf("failed to fetch activity details for %s after %d attempts: %w", activityID, maxRetries, err)
 }
 
-func (n *NikeApi) GetActivityDetails(activityID string) ([]byte, error) {
+func (n *NikeApi) GetActivityDetails(ctx context.Context, activityID string) ([]byte, error) {
 	// Construct the request
 	url := fmt.Sprintf(n.ActivityDetailsURL, activityID)
 	n.logger.Debugf("New GET Request on: %s\n", url)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", n.AccessToken))
 
 	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := n.HTTPClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("error sending request: %w", err)
 	}
@@ -187,7 +223,7 @@ func (n *NikeApi) GetActivityDetails(activityID string) ([]byte, error) {
 	// Print the response status
 	n.logger.Debugf("Response status: %s\n", resp.Status)
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("error getting activity details: %s", resp.Status)
+		return nil, fmt.Errorf("error getting activity details: %w", utils.StatusError(resp))
 	}
 
 	// Read the response body
@@ -0,0 +1,129 @@
+package nrc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/mxdc/nrc2strava/nrc"
+	"github.com/mxdc/nrc2strava/nrc/nrctest"
+	"github.com/mxdc/nrc2strava/utils"
+)
+
+const (
+	fixturesDir = "testdata/activities"
+	accessToken = "test-token"
+)
+
+func newFakeServer(t *testing.T) *nrctest.Server {
+	t.Helper()
+
+	server, err := nrctest.NewServer(fixturesDir, accessToken)
+	if err != nil {
+		t.Fatalf("error starting the fake server: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func newNikeApi(server *nrctest.Server, token string) *nrc.NikeApi {
+	nikeApi := nrc.NewNikeApi(token)
+	nikeApi.SetBaseURL(server.URL)
+	nikeApi.HTTPClient = server.Client()
+	return nikeApi
+}
+
+func TestGetActivityListPaginatesAndFilters(t *testing.T) {
+	server := newFakeServer(t)
+
+	activityIDs, err := newNikeApi(server, accessToken).GetActivityList(context.Background())
+	if err != nil {
+		t.Fatalf("GetActivityList() error = %v", err)
+	}
+
+	// Newest first, without the manual run (0004) and the cycling activity (0005)
+	expected := []string{"0a1b2c3d-0003", "0a1b2c3d-0002", "0a1b2c3d-0001"}
+	if !slices.Equal(activityIDs, expected) {
+		t.Errorf("GetActivityList() = %v, want %v", activityIDs, expected)
+	}
+}
+
+func TestGetActivityListSinglePage(t *testing.T) {
+	server := newFakeServer(t)
+	server.PageSize = 100
+
+	activityIDs, err := newNikeApi(server, accessToken).GetActivityList(context.Background())
+	if err != nil {
+		t.Fatalf("GetActivityList() error = %v", err)
+	}
+
+	if len(activityIDs) != 3 {
+		t.Errorf("GetActivityList() returned %d activities, want 3", len(activityIDs))
+	}
+}
+
+func TestGetActivityListUnauthorized(t *testing.T) {
+	server := newFakeServer(t)
+
+	_, err := newNikeApi(server, "expired-token").GetActivityList(context.Background())
+	if !errors.Is(err, utils.ErrUnauthorized) {
+		t.Errorf("GetActivityList() error = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestGetActivityDetails(t *testing.T) {
+	server := newFakeServer(t)
+
+	details, err := newNikeApi(server, accessToken).GetActivityDetails(context.Background(), "0a1b2c3d-0001")
+	if err != nil {
+		t.Fatalf("GetActivityDetails() error = %v", err)
+	}
+
+	if string(details) != string(server.Details("0a1b2c3d-0001")) {
+		t.Error("GetActivityDetails() didn't return the fixture")
+	}
+}
+
+func TestGetActivityDetailsRateLimited(t *testing.T) {
+	server := newFakeServer(t)
+	server.FailDetails("0a1b2c3d-0001", http.StatusTooManyRequests)
+
+	_, err := newNikeApi(server, accessToken).GetActivityDetails(context.Background(), "0a1b2c3d-0001")
+	if !errors.Is(err, utils.ErrRateLimited) {
+		t.Errorf("GetActivityDetails() error = %v, want ErrRateLimited", err)
+	}
+}
+
+func TestGetActivityDetailsWithRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		want     error
+		requests int
+	}{
+		{"stops on unauthorized", http.StatusUnauthorized, utils.ErrUnauthorized, 1},
+		{"stops on rate limit", http.StatusTooManyRequests, utils.ErrRateLimited, 1},
+		{"retries a server error", http.StatusInternalServerError, nil, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeServer(t)
+			server.FailDetails("0a1b2c3d-0001", tt.status)
+
+			nikeApi := newNikeApi(server, accessToken)
+			nikeApi.RetryDelay = 0
+			_, err := nikeApi.GetActivityDetailsWithRetry(context.Background(), "0a1b2c3d-0001", 3)
+			if err == nil || (tt.want != nil && !errors.Is(err, tt.want)) {
+				t.Errorf("GetActivityDetailsWithRetry() error = %v, want %v", err, tt.want)
+			}
+
+			if requests := server.DetailsRequests("0a1b2c3d-0001"); requests != tt.requests {
+				t.Errorf("GetActivityDetailsWithRetry() sent %d requests, want %d", requests, tt.requests)
+			}
+		})
+	}
+}
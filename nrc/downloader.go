@@ -1,11 +1,13 @@
 package nrc
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"time"
 
+	"github.com/mxdc/nrc2strava/report"
 	"github.com/mxdc/nrc2strava/utils"
 	"github.com/sirupsen/logrus"
 )
@@ -14,13 +16,16 @@ import (
 type NikeDownloader struct {
 	downloadActivitiesDir string
 	nikeApi               *NikeApi
-	logger                *logrus.Logger
+
+	// Report records the outcome of each download, if set
+	Report *report.Report
+
+	logger *logrus.Logger
 }
 
 // NewNikeDownloader initializes a new NewNikeDownloader instance
 func NewNikeDownloader(nikeApi *NikeApi, downloadActivitiesDir string) *NikeDownloader {
-	logger := logrus.New()
-	logger.SetFormatter(utils.LogFormat)
+	logger := utils.Logger
 
 	return &NikeDownloader{
 		downloadActivitiesDir: downloadActivitiesDir,
@@ -29,31 +34,40 @@ func NewNikeDownloader(nikeApi *NikeApi, downloadActivitiesDir string) *NikeDown
 	}
 }
 
-func (n *NikeDownloader) DownloadActivities() {
+// DownloadActivities saves the NRC activities as JSON files, the activities which fail are skipped
+func (n *NikeDownloader) DownloadActivities(ctx context.Context) error {
 	n.logger.Info("Downloading activities...")
 
 	// Create the directory if it doesn't exist
 	if _, err := os.Stat(n.downloadActivitiesDir); os.IsNotExist(err) {
 		if err := os.Mkdir(n.downloadActivitiesDir, os.ModePerm); err != nil {
-			n.logger.Errorf("Error creating activities folder: %v\n", err)
-			return
+			return fmt.Errorf("error creating activities folder: %w", err)
 		}
 	}
 
-	activities, err := n.nikeApi.GetActivityList()
+	activities, err := n.nikeApi.GetActivityList(ctx)
 	if err != nil {
-		n.logger.Errorf("Error fetching activity list: %v\n", err)
-		return
+		return err
 	}
 
 	total := len(activities)
 	downloadedCount := 0
 
 	for _, activityID := range activities {
+		// Stop between two activities when canceled
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		n.logger.Debugf("Downloading activity ID: %s\n", activityID)
 
-		activityDetails, err := n.nikeApi.GetActivityDetails(activityID)
+		activityDetails, err := n.nikeApi.GetActivityDetails(ctx, activityID)
 		if err != nil {
+			n.Report.AddFailed(activityID, "", err)
+			if utils.ShouldAbort(err) {
+				return fmt.Errorf("error downloading activity ID %s: %w", activityID, err)
+			}
+
 			n.logger.Errorf("Error downloading activity ID %s: %v\n", activityID, err)
 			continue
 		}
@@ -62,15 +76,21 @@ func (n *NikeDownloader) DownloadActivities() {
 		err = n.SaveActivity(activityDetails, filepath)
 		if err != nil {
 			n.logger.Errorf("Error saving activity ID %s: %v\n", activityID, err)
+			n.Report.AddFailed(activityID, filepath, err)
 			continue
 		}
 
+		n.Report.AddProcessed(activityID, filepath)
+
 		downloadedCount++
 		n.logger.Infof("✓ Downloaded %d/%d activities\n", downloadedCount, total)
-		time.Sleep(200 * time.Millisecond)
+		if err := utils.Sleep(ctx, 200*time.Millisecond); err != nil {
+			return err
+		}
 	}
 
 	n.logger.Infof("✓ Finished downloading %d activities\n", downloadedCount)
+	return nil
 }
 
 func (n *NikeDownloader) SaveActivity(activityDetails []byte, filepath string) error {
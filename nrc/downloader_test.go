@@ -0,0 +1,116 @@
+package nrc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mxdc/nrc2strava/nrc"
+	"github.com/mxdc/nrc2strava/report"
+	"github.com/mxdc/nrc2strava/utils"
+)
+
+func TestDownloadActivities(t *testing.T) {
+	server := newFakeServer(t)
+	downloadDir := filepath.Join(t.TempDir(), "downloaded")
+
+	downloader := nrc.NewNikeDownloader(newNikeApi(server, accessToken), downloadDir)
+	downloader.Report = report.NewReport("download")
+
+	if err := downloader.DownloadActivities(context.Background()); err != nil {
+		t.Fatalf("DownloadActivities() error = %v", err)
+	}
+
+	files, err := os.ReadDir(downloadDir)
+	if err != nil {
+		t.Fatalf("error reading the download directory: %v", err)
+	}
+	if len(files) != 3 {
+		t.Errorf("DownloadActivities() saved %d files, want 3", len(files))
+	}
+
+	for _, activityID := range []string{"0a1b2c3d-0001", "0a1b2c3d-0002", "0a1b2c3d-0003"} {
+		data, err := os.ReadFile(filepath.Join(downloadDir, activityID+".json"))
+		if err != nil {
+			t.Errorf("activity %s not saved: %v", activityID, err)
+			continue
+		}
+
+		if string(data) != string(server.Details(activityID)) {
+			t.Errorf("activity %s saved with a different content", activityID)
+		}
+	}
+
+	if downloader.Report.Processed != 3 || downloader.Report.Failed != 0 {
+		t.Errorf("report processed = %d, failed = %d, want 3 and 0", downloader.Report.Processed, downloader.Report.Failed)
+	}
+}
+
+func TestDownloadActivitiesSkipsFailedActivity(t *testing.T) {
+	server := newFakeServer(t)
+	server.FailDetails("0a1b2c3d-0002", http.StatusInternalServerError)
+	downloadDir := t.TempDir()
+
+	downloader := nrc.NewNikeDownloader(newNikeApi(server, accessToken), downloadDir)
+	downloader.Report = report.NewReport("download")
+
+	if err := downloader.DownloadActivities(context.Background()); err != nil {
+		t.Fatalf("DownloadActivities() error = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(downloadDir, "0a1b2c3d-0002.json")); !os.IsNotExist(err) {
+		t.Error("failed activity saved")
+	}
+
+	if downloader.Report.Processed != 2 || downloader.Report.Failed != 1 {
+		t.Errorf("report processed = %d, failed = %d, want 2 and 1", downloader.Report.Processed, downloader.Report.Failed)
+	}
+}
+
+func TestDownloadActivitiesAbortsOnRateLimit(t *testing.T) {
+	server := newFakeServer(t)
+	server.FailDetails("0a1b2c3d-0003", http.StatusTooManyRequests)
+
+	downloader := nrc.NewNikeDownloader(newNikeApi(server, accessToken), t.TempDir())
+
+	err := downloader.DownloadActivities(context.Background())
+	if !errors.Is(err, utils.ErrRateLimited) {
+		t.Fatalf("DownloadActivities() error = %v, want ErrRateLimited", err)
+	}
+
+	// The newest activity is the first one requested, the others are never requested
+	if requests := server.DetailsRequests("0a1b2c3d-0002"); requests != 0 {
+		t.Errorf("activity requested %d times after the rate limit", requests)
+	}
+}
+
+func TestDownloadActivitiesCanceled(t *testing.T) {
+	server := newFakeServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	downloader := nrc.NewNikeDownloader(newNikeApi(server, accessToken), t.TempDir())
+	if err := downloader.DownloadActivities(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("DownloadActivities() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestDownloadActivitiesUnauthorized(t *testing.T) {
+	server := newFakeServer(t)
+
+	downloader := nrc.NewNikeDownloader(newNikeApi(server, "expired-token"), t.TempDir())
+	err := downloader.DownloadActivities(context.Background())
+	if !errors.Is(err, utils.ErrUnauthorized) {
+		t.Fatalf("DownloadActivities() error = %v, want ErrUnauthorized", err)
+	}
+
+	// The list error is wrapped once, by the API client
+	if count := strings.Count(err.Error(), "error fetching activity list"); count != 1 {
+		t.Errorf("DownloadActivities() error = %v, want the list context once", err)
+	}
+}
@@ -0,0 +1,212 @@
+// Package nrctest provides a fake Nike API server for the tests
+package nrctest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultPageSize is the number of activities of a list page, small to exercise the pagination
+const DefaultPageSize = 2
+
+// fixture is an activity served by the fake server, its details are the raw JSON file
+type fixture struct {
+	ID           string            `json:"id"`
+	Type         string            `json:"type"`
+	StartEpochMs int64             `json:"start_epoch_ms"`
+	Tags         map[string]string `json:"tags"`
+
+	details []byte
+}
+
+// Server is a fake Nike API serving the NRC activities of a fixtures directory
+type Server struct {
+	*httptest.Server
+
+	// AccessToken is the bearer token expected by the server
+	AccessToken string
+
+	// PageSize is the number of activities of a list page
+	PageSize int
+
+	// activities are sorted from the newest, like the Nike API
+	activities []fixture
+
+	// failures maps activity IDs to the status code returned for their details
+	failures map[string]int
+
+	// requests counts the details requests by activity ID
+	requests map[string]int
+
+	mutex sync.Mutex
+}
+
+// NewServer starts a fake Nike API serving the <activity ID>.json files of the directory
+func NewServer(fixturesDir, accessToken string) (*Server, error) {
+	files, err := filepath.Glob(filepath.Join(fixturesDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	activities := []fixture{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		var activity fixture
+		if err := json.Unmarshal(data, &activity); err != nil {
+			return nil, fmt.Errorf("error parsing fixture %s: %w", file, err)
+		}
+		activity.details = data
+
+		activities = append(activities, activity)
+	}
+
+	sort.Slice(activities, func(i, j int) bool {
+		return activities[i].StartEpochMs > activities[j].StartEpochMs
+	})
+
+	s := &Server{
+		AccessToken: accessToken,
+		PageSize:    DefaultPageSize,
+		activities:  activities,
+		failures:    map[string]int{},
+		requests:    map[string]int{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /plus/v3/activities/before_id/v3/{beforeID}", s.handleList)
+	mux.HandleFunc("GET /sport/v3/me/activity/{id}", s.handleDetails)
+	s.Server = httptest.NewServer(s.authorize(mux))
+
+	return s, nil
+}
+
+// FailDetails makes the server answer the details of the activity with the status code
+func (s *Server) FailDetails(activityID string, statusCode int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.failures[activityID] = statusCode
+}
+
+// DetailsRequests returns the number of details requests received for the activity
+func (s *Server) DetailsRequests(activityID string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.requests[activityID]
+}
+
+// Details returns the JSON served for the activity details
+func (s *Server) Details(activityID string) []byte {
+	for _, activity := range s.activities {
+		if activity.ID == activityID {
+			return activity.details
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+s.AccessToken {
+			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// listItem is the summary of an activity in the list pages
+type listItem struct {
+	ID   string            `json:"id"`
+	Type string            `json:"type"`
+	Tags map[string]string `json:"tags"`
+}
+
+type listResponse struct {
+	Activities []listItem `json:"activities"`
+	Paging     struct {
+		BeforeID string `json:"before_id,omitempty"`
+	} `json:"paging"`
+}
+
+// handleList serves the activities older than the before_id, "*" being the first page
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	beforeID := r.PathValue("beforeID")
+
+	start := 0
+	if beforeID != "*" {
+		start = -1
+		for i, activity := range s.activities {
+			if activity.ID == beforeID {
+				start = i + 1
+				break
+			}
+		}
+
+		if start < 0 {
+			http.Error(w, `{"error":"unknown before_id"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	end := min(start+s.PageSize, len(s.activities))
+
+	var response listResponse
+	response.Activities = []listItem{}
+	for _, activity := range s.activities[start:end] {
+		response.Activities = append(response.Activities, listItem{
+			ID:   activity.ID,
+			Type: activity.Type,
+			Tags: activity.Tags,
+		})
+	}
+
+	// The last page has no before_id
+	if end < len(s.activities) {
+		response.Paging.BeforeID = s.activities[end-1].ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handleDetails(w http.ResponseWriter, r *http.Request) {
+	activityID := r.PathValue("id")
+	if r.URL.Query().Get("metrics") != "ALL" {
+		http.Error(w, `{"error":"missing metrics"}`, http.StatusBadRequest)
+		return
+	}
+
+	s.mutex.Lock()
+	s.requests[activityID]++
+	statusCode, failing := s.failures[activityID]
+	s.mutex.Unlock()
+
+	if failing {
+		http.Error(w, `{"error":"`+strings.ToLower(http.StatusText(statusCode))+`"}`, statusCode)
+		return
+	}
+
+	details := s.Details(activityID)
+	if details == nil {
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(details)
+}
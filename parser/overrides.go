@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/muktihari/fit/profile/typedef"
+	"github.com/mxdc/nrc2strava/types"
+	"gopkg.in/yaml.v3"
+)
+
+// OverrideSuffix ends the name of the sidecar override files: <activity ID>.override.yaml
+const OverrideSuffix = ".override"
+
+// overrideExtensions are the extensions of the sidecar override files, JSON being a subset of YAML
+var overrideExtensions = []string{".yaml", ".yml", ".json"}
+
+// isOverrideFile reports whether the file is a sidecar override file
+func isOverrideFile(name string) bool {
+	extension := filepath.Ext(name)
+	return strings.HasSuffix(strings.TrimSuffix(name, extension), OverrideSuffix)
+}
+
+// LoadOverrides loads the overrides file, a map of NRC activity IDs to overrides,
+// then the sidecar override files of the activities directory which take precedence
+func (p *ActivitiesParser) LoadOverrides(overridesFile string) (map[string]types.Override, error) {
+	overrides := map[string]types.Override{}
+
+	if len(overridesFile) > 0 {
+		p.logger.Debugf("Loading overrides file: %s\n", overridesFile)
+
+		data, err := os.ReadFile(overridesFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading overrides file: %w", err)
+		}
+
+		if err := yaml.Unmarshal(data, &overrides); err != nil {
+			return nil, fmt.Errorf("error parsing overrides file %s: %w", overridesFile, err)
+		}
+
+		for activityID, override := range overrides {
+			if err := validateOverride(override); err != nil {
+				return nil, fmt.Errorf("error in overrides file %s, activity %s: %w", overridesFile, activityID, err)
+			}
+		}
+	}
+
+	if len(p.ActivitiesDir) == 0 {
+		return overrides, nil
+	}
+
+	files, err := os.ReadDir(p.ActivitiesDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading directory: %w", err)
+	}
+
+	for _, file := range files {
+		extension := filepath.Ext(file.Name())
+		if !isOverrideFile(file.Name()) || !slices.Contains(overrideExtensions, extension) {
+			continue
+		}
+
+		filePath := filepath.Join(p.ActivitiesDir, file.Name())
+		p.logger.Debugf("Loading override file: %s\n", filePath)
+
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading override file: %w", err)
+		}
+
+		var override types.Override
+		if err := yaml.Unmarshal(data, &override); err != nil {
+			return nil, fmt.Errorf("error parsing override file %s: %w", filePath, err)
+		}
+		if err := validateOverride(override); err != nil {
+			return nil, fmt.Errorf("error in override file %s: %w", filePath, err)
+		}
+
+		activityID := strings.TrimSuffix(strings.TrimSuffix(file.Name(), extension), OverrideSuffix)
+		overrides[activityID] = override
+	}
+
+	p.logger.Debugf("Loaded %d overrides\n", len(overrides))
+	return overrides, nil
+}
+
+// validateOverride checks the values parsed during the conversion, so that an invalid file fails before converting
+func validateOverride(override types.Override) error {
+	if len(override.StartShift) > 0 {
+		if _, err := time.ParseDuration(override.StartShift); err != nil {
+			return fmt.Errorf("invalid start shift %q: %w", override.StartShift, err)
+		}
+	}
+
+	if len(override.Sport) > 0 && typedef.SportFromString(override.Sport) == typedef.SportInvalid {
+		return fmt.Errorf("unknown sport %q", override.Sport)
+	}
+
+	if override.Distance < 0 {
+		return fmt.Errorf("invalid distance: %.3f", override.Distance)
+	}
+
+	return nil
+}
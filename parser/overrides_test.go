@@ -0,0 +1,63 @@
+package parser_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mxdc/nrc2strava/parser"
+)
+
+func TestLoadOverrides(t *testing.T) {
+	dir := t.TempDir()
+	overridesFile := filepath.Join(dir, "overrides.yaml")
+	if err := os.WriteFile(overridesFile, []byte("run-1:\n  title: Morning run\n  start_shift: -1h\nrun-2:\n  exclude: true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// The sidecar file takes precedence
+	if err := os.WriteFile(filepath.Join(dir, "run-1.override.yaml"), []byte("title: Evening run\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	overrides, err := parser.InitActivitiesParser(dir, "").LoadOverrides(overridesFile)
+	if err != nil {
+		t.Fatalf("LoadOverrides() error = %v", err)
+	}
+	if len(overrides) != 2 || overrides["run-1"].Title != "Evening run" || !overrides["run-2"].Exclude {
+		t.Errorf("LoadOverrides() = %+v", overrides)
+	}
+}
+
+// TestLoadOverridesInvalid checks an invalid override fails at startup instead of being dropped during the conversion
+func TestLoadOverridesInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"start shift", "overrides.yaml", "run-1:\n  title: Morning run\n  start_shift: abc\n"},
+		{"negative distance", "overrides.yaml", "run-1:\n  distance: -5\n"},
+		{"unknown sport", "overrides.yaml", "run-1:\n  sport: jogging\n"},
+		{"sidecar start shift", "run-1.override.yaml", "start_shift: 1 hour\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			filePath := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(filePath, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			overridesFile := ""
+			if !strings.Contains(tt.file, ".override.") {
+				overridesFile = filePath
+			}
+
+			if _, err := parser.InitActivitiesParser(dir, "").LoadOverrides(overridesFile); err == nil {
+				t.Errorf("LoadOverrides() of %q returned no error", tt.content)
+			}
+		})
+	}
+}
@@ -2,9 +2,12 @@ package parser
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
+	"github.com/mxdc/nrc2strava/report"
 	"github.com/mxdc/nrc2strava/types"
 	"github.com/mxdc/nrc2strava/utils"
 	"github.com/sirupsen/logrus"
@@ -15,6 +18,9 @@ type ActivitiesParser struct {
 	ActivitiesDir string
 	activityFile  string
 
+	// Report records the files which couldn't be parsed, if set
+	Report *report.Report
+
 	// logger
 	logger *logrus.Logger
 }
@@ -23,8 +29,7 @@ type ActivitiesParser struct {
 func InitActivitiesParser(activitiesDir, activityFile string) *ActivitiesParser {
 	var parser ActivitiesParser
 
-	logger := logrus.New()
-	logger.SetFormatter(utils.LogFormat)
+	logger := utils.Logger
 
 	parser.ActivitiesDir = activitiesDir
 	parser.activityFile = activityFile
@@ -33,51 +38,54 @@ func InitActivitiesParser(activitiesDir, activityFile string) *ActivitiesParser
 	return &parser
 }
 
-// LoadActivities load JSON files into memory
-func (p *ActivitiesParser) LoadActivities() []*types.Activity {
+// LoadActivities load JSON files into memory, the files which can't be parsed are skipped
+func (p *ActivitiesParser) LoadActivities() ([]*types.Activity, error) {
 	p.logger.Debugf("Opening file at %s", p.ActivitiesDir)
-	var activities []*types.Activity
 
-	if len(p.ActivitiesDir) > 0 {
-		activities = p.parseActivities()
+	if len(p.ActivitiesDir) == 0 {
+		return nil, nil
 	}
 
-	return activities
+	return p.parseActivities()
 }
 
-func (p *ActivitiesParser) LoadActivity() *types.Activity {
+// LoadActivity loads the activity file into memory
+func (p *ActivitiesParser) LoadActivity() (*types.Activity, error) {
 	p.logger.Debugf("Opening file at %s", p.activityFile)
 
-	if len(p.activityFile) > 0 {
-		activity := p.parseActivity(p.activityFile)
-		p.logger.Debugf("Activity ID: %s, Status: %s\n", activity.ID, activity.Status)
-		return activity
+	if len(p.activityFile) == 0 {
+		return nil, nil
+	}
+
+	activity, err := p.parseActivity(p.activityFile)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	p.logger.Debugf("Activity ID: %s, Status: %s\n", activity.ID, activity.Status)
+	return activity, nil
 }
 
-func (p *ActivitiesParser) parseActivities() []*types.Activity {
+func (p *ActivitiesParser) parseActivities() ([]*types.Activity, error) {
 	var activities []*types.Activity
 
 	// Read all files in the folder
 	files, err := os.ReadDir(p.ActivitiesDir)
 	if err != nil {
-		p.logger.Errorf("Error reading directory: %s", p.ActivitiesDir)
-		return activities
+		return nil, fmt.Errorf("error reading directory: %w", err)
 	}
 
 	// Count .json files
 	jsonFiles := []os.DirEntry{}
 	for _, file := range files {
-		if filepath.Ext(file.Name()) == ".json" {
+		if filepath.Ext(file.Name()) == ".json" && !isOverrideFile(file.Name()) {
 			jsonFiles = append(jsonFiles, file)
 		}
 	}
 
 	if len(jsonFiles) == 0 {
 		p.logger.Error("No JSON files to process")
-		return activities
+		return activities, nil
 	}
 
 	p.logger.Infof("Parsing %d activities...\n", len(jsonFiles))
@@ -86,8 +94,10 @@ func (p *ActivitiesParser) parseActivities() []*types.Activity {
 	for _, file := range jsonFiles {
 		filePath := filepath.Join(p.ActivitiesDir, file.Name())
 
-		activity := p.parseActivity(filePath)
-		if activity == nil {
+		activity, err := p.parseActivity(filePath)
+		if err != nil {
+			p.logger.Error(err)
+			p.Report.AddFailed("", filePath, err)
 			continue
 		}
 
@@ -96,26 +106,34 @@ func (p *ActivitiesParser) parseActivities() []*types.Activity {
 	}
 
 	p.logger.Infof("✓ Finished parsing %d activities\n", len(activities))
-	return activities
+	return activities, nil
 }
 
-func (p *ActivitiesParser) parseActivity(filePath string) *types.Activity {
+func (p *ActivitiesParser) parseActivity(filePath string) (*types.Activity, error) {
 	p.logger.Debugf("Processing file: %s", filePath)
 
-	// Open and read the file
-	data, err := os.ReadFile(filePath)
+	// Open the file
+	file, err := os.Open(filePath)
 	if err != nil {
-		p.logger.Errorf("Error reading file: %v", err)
-		return nil
+		return nil, fmt.Errorf("error reading file: %w", err)
 	}
+	defer file.Close()
 
-	// Unmarshal JSON into Go struct
-	var activity types.Activity
-	err = json.Unmarshal(data, &activity)
+	activity, err := ParseActivity(file)
 	if err != nil {
-		p.logger.Errorf("Error parsing JSON: %v", err)
-		return nil
+		return nil, fmt.Errorf("error parsing %s: %w", filePath, err)
+	}
+
+	activity.FilePath = filePath
+	return activity, nil
+}
+
+// ParseActivity decodes a NRC activity from its JSON
+func ParseActivity(r io.Reader) (*types.Activity, error) {
+	var activity types.Activity
+	if err := json.NewDecoder(r).Decode(&activity); err != nil {
+		return nil, fmt.Errorf("error parsing JSON: %w", err)
 	}
 
-	return &activity
+	return &activity, nil
 }
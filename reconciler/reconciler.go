@@ -0,0 +1,399 @@
+package reconciler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/muktihari/fit/profile/basetype"
+	"github.com/muktihari/fit/profile/filedef"
+	"github.com/muktihari/fit/profile/typedef"
+	"github.com/mxdc/nrc2strava/converter"
+	"github.com/mxdc/nrc2strava/fit"
+	"github.com/mxdc/nrc2strava/parser"
+	"github.com/mxdc/nrc2strava/report"
+	"github.com/mxdc/nrc2strava/strava"
+	"github.com/mxdc/nrc2strava/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// startTimeTolerance is the maximum difference between two start times of the same run
+	startTimeTolerance = 60 * time.Second
+
+	// Thresholds above which a difference is reported
+	distanceTolerance = 0.01 // relative
+	durationTolerance = 5.0  // s
+	caloriesTolerance = 5.0  // kcal
+	ascentTolerance   = 5.0  // m
+)
+
+// RunTotals holds the values compared between both sides of the migration, NaN when missing
+type RunTotals struct {
+	ID        string
+	Title     string
+	StartTime time.Time
+	Distance  float64 // m
+	Duration  float64 // s, timer time
+	Calories  float64 // kcal
+	Ascent    float64 // m
+}
+
+// Difference is a value that differs between the NRC run and the Strava activity
+type Difference struct {
+	Field  string `json:"field"`
+	NRC    string `json:"nrc"`
+	Strava string `json:"strava"`
+}
+
+// MatchedRun is a NRC run found on Strava
+type MatchedRun struct {
+	NRC         RunTotals    `json:"nrc"`
+	Strava      RunTotals    `json:"strava"`
+	Differences []Difference `json:"differences"`
+}
+
+// Report is the result of the reconciliation
+type Report struct {
+	Matched         []MatchedRun `json:"matched"`
+	MissingOnStrava []RunTotals  `json:"missing_on_strava"`
+	MissingOnNRC    []RunTotals  `json:"missing_on_nrc"`
+}
+
+// Reconciler compares the NRC activities with the activities downloaded from Strava
+type Reconciler struct {
+	nrcActivitiesDir    string
+	stravaActivitiesDir string
+
+	// Converter converts the NRC activities, with the corrections of the user such as the overrides
+	Converter *converter.ActivitiesConverter
+
+	// Report records the reconciled, skipped and unreadable activities, if set
+	Report *report.Report
+
+	logger *logrus.Logger
+}
+
+// NewReconciler initializes a new Reconciler instance
+func NewReconciler(nrcActivitiesDir, stravaActivitiesDir string) *Reconciler {
+	logger := utils.Logger
+
+	return &Reconciler{
+		nrcActivitiesDir:    nrcActivitiesDir,
+		stravaActivitiesDir: stravaActivitiesDir,
+		Converter:           converter.InitActivitiesConverter(),
+		logger:              logger,
+	}
+}
+
+// Reconcile matches the NRC runs with the Strava runs by start time
+func (r *Reconciler) Reconcile() (*Report, error) {
+	nrcRuns, err := r.loadNRCRuns()
+	if err != nil {
+		return nil, err
+	}
+
+	stravaRuns, err := r.loadStravaRuns()
+	if err != nil {
+		return nil, err
+	}
+
+	r.logger.Infof("Reconciling %d NRC runs with %d Strava runs...\n", len(nrcRuns), len(stravaRuns))
+
+	report := &Report{
+		Matched:         []MatchedRun{},
+		MissingOnStrava: []RunTotals{},
+		MissingOnNRC:    []RunTotals{},
+	}
+
+	matched := make([]bool, len(stravaRuns))
+	for _, nrcRun := range nrcRuns {
+		index := findClosestRun(nrcRun, stravaRuns, matched)
+		if index < 0 {
+			report.MissingOnStrava = append(report.MissingOnStrava, nrcRun)
+			continue
+		}
+
+		matched[index] = true
+		report.Matched = append(report.Matched, MatchedRun{
+			NRC:         nrcRun,
+			Strava:      stravaRuns[index],
+			Differences: compareRuns(nrcRun, stravaRuns[index]),
+		})
+	}
+
+	for i, stravaRun := range stravaRuns {
+		if !matched[i] {
+			report.MissingOnNRC = append(report.MissingOnNRC, stravaRun)
+		}
+	}
+
+	r.logger.Infof("✓ Finished reconciling: %d matched, %d missing on Strava, %d missing on NRC\n",
+		len(report.Matched), len(report.MissingOnStrava), len(report.MissingOnNRC))
+
+	return report, nil
+}
+
+func (r *Reconciler) loadNRCRuns() ([]RunTotals, error) {
+	activitiesParser := parser.InitActivitiesParser(r.nrcActivitiesDir, "")
+	activitiesParser.Report = r.Report
+
+	nikeActivities, err := activitiesParser.LoadActivities()
+	if err != nil {
+		return nil, err
+	}
+
+	runs := []RunTotals{}
+	for _, nikeActivity := range nikeActivities {
+		// The excluded activities are never migrated
+		if r.Converter.IsExcluded(nikeActivity) {
+			r.logger.Debugf("Skipping excluded activity: %s\n", nikeActivity.ID)
+			r.Report.AddSkipped(nikeActivity.ID, "", "excluded by override")
+			continue
+		}
+
+		run := r.Converter.ConvertRun(nikeActivity)
+		if len(run.Activity.Sessions) == 0 || run.Activity.Sessions[0].Sport != typedef.SportRunning {
+			r.logger.Debugf("Skipping non running activity: %s\n", nikeActivity.ID)
+			r.Report.AddSkipped(nikeActivity.ID, "", "not a run")
+			continue
+		}
+
+		totals := sessionTotals(run.Activity)
+		totals.ID = nikeActivity.ID
+		totals.Title = fit.DeveloperFieldValue(run.Activity.Sessions[0].DeveloperFields, fit.FieldTitle)
+		runs = append(runs, totals)
+		r.Report.AddProcessed(nikeActivity.ID, "")
+	}
+
+	sortRuns(runs)
+	return runs, nil
+}
+
+func (r *Reconciler) loadStravaRuns() ([]RunTotals, error) {
+	files, err := os.ReadDir(r.stravaActivitiesDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading directory: %w", err)
+	}
+
+	runs := []RunTotals{}
+	for _, file := range files {
+		if filepath.Ext(file.Name()) != ".fit" {
+			continue
+		}
+
+		filePath := filepath.Join(r.stravaActivitiesDir, file.Name())
+		r.logger.Debugf("Loading Strava activity: %s\n", filePath)
+
+		fitActivity, err := strava.NewFitActivity(filePath)
+		if err != nil {
+			r.logger.Warnf("Skipping unreadable Strava activity: %v\n", err)
+			r.Report.AddFailed("", filePath, err)
+			continue
+		}
+
+		activity := filedef.NewActivity(fitActivity.Fit.Messages...)
+		if len(activity.Sessions) == 0 || activity.Sessions[0].Sport != typedef.SportRunning {
+			r.logger.Debugf("Skipping non running activity: %s\n", file.Name())
+			r.Report.AddSkipped("", filePath, "not a run")
+			continue
+		}
+
+		totals := sessionTotals(activity)
+		totals.ID = file.Name()
+		totals.Title = fitActivity.ExtractActivityTitle()
+
+		// The Strava name and ID are only known from the downloaded filename
+		if id, name, ok := strava.ParseDownloadedFilename(file.Name()); ok {
+			totals.ID = fmt.Sprintf("%d", id)
+			totals.Title = name
+		}
+
+		runs = append(runs, totals)
+		r.Report.AddProcessed(totals.ID, filePath)
+	}
+
+	sortRuns(runs)
+	return runs, nil
+}
+
+func sessionTotals(activity *filedef.Activity) RunTotals {
+	session := activity.Sessions[0]
+
+	totals := RunTotals{
+		StartTime: session.StartTime,
+		Distance:  session.TotalDistanceScaled(),
+		Duration:  session.TotalTimerTimeScaled(),
+		Calories:  math.NaN(),
+		Ascent:    math.NaN(),
+	}
+
+	if session.TotalCalories != basetype.Uint16Invalid {
+		totals.Calories = float64(session.TotalCalories)
+	}
+
+	if session.TotalAscent != basetype.Uint16Invalid {
+		totals.Ascent = float64(session.TotalAscent)
+	}
+
+	return totals
+}
+
+func sortRuns(runs []RunTotals) {
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].StartTime.Before(runs[j].StartTime)
+	})
+}
+
+// findClosestRun returns the index of the unmatched run starting closest to the given run
+func findClosestRun(run RunTotals, candidates []RunTotals, matched []bool) int {
+	closest := -1
+	closestDelta := startTimeTolerance
+
+	for i, candidate := range candidates {
+		if matched[i] {
+			continue
+		}
+
+		delta := candidate.StartTime.Sub(run.StartTime)
+		if delta < 0 {
+			delta = -delta
+		}
+
+		if delta <= closestDelta {
+			closest = i
+			closestDelta = delta
+		}
+	}
+
+	return closest
+}
+
+func compareRuns(nrcRun, stravaRun RunTotals) []Difference {
+	differences := []Difference{}
+
+	if exceeds(nrcRun.Distance, stravaRun.Distance, nrcRun.Distance*distanceTolerance) {
+		differences = append(differences, Difference{"distance", formatValue(nrcRun.Distance, "%.0fm"), formatValue(stravaRun.Distance, "%.0fm")})
+	}
+
+	if exceeds(nrcRun.Duration, stravaRun.Duration, durationTolerance) {
+		differences = append(differences, Difference{"duration", formatValue(nrcRun.Duration, "%.0fs"), formatValue(stravaRun.Duration, "%.0fs")})
+	}
+
+	if exceeds(nrcRun.Calories, stravaRun.Calories, caloriesTolerance) {
+		differences = append(differences, Difference{"calories", formatValue(nrcRun.Calories, "%.0fkcal"), formatValue(stravaRun.Calories, "%.0fkcal")})
+	}
+
+	if exceeds(nrcRun.Ascent, stravaRun.Ascent, ascentTolerance) {
+		differences = append(differences, Difference{"elevation", formatValue(nrcRun.Ascent, "%.0fm"), formatValue(stravaRun.Ascent, "%.0fm")})
+	}
+
+	// Strava names are sanitized in the downloaded filenames
+	if strava.SanitizeFilename(nrcRun.Title) != strava.SanitizeFilename(stravaRun.Title) {
+		differences = append(differences, Difference{"title", nrcRun.Title, stravaRun.Title})
+	}
+
+	return differences
+}
+
+// exceeds reports whether both values differ by more than the tolerance, a missing value on one side only is a difference
+func exceeds(a, b, tolerance float64) bool {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) != math.IsNaN(b)
+	}
+
+	return math.Abs(a-b) > tolerance
+}
+
+func formatValue(value float64, format string) string {
+	if math.IsNaN(value) {
+		return "-"
+	}
+	return fmt.Sprintf(format, value)
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// runTotalsJSON is the JSON view of RunTotals, NaN can't be encoded so the missing values are omitted
+type runTotalsJSON struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	StartTime time.Time `json:"start_time"`
+	Distance  *float64  `json:"distance,omitempty"` // m
+	Duration  *float64  `json:"duration,omitempty"` // s, timer time
+	Calories  *float64  `json:"calories,omitempty"` // kcal
+	Ascent    *float64  `json:"ascent,omitempty"`   // m
+}
+
+// MarshalJSON encodes the totals without the missing values
+func (t RunTotals) MarshalJSON() ([]byte, error) {
+	return json.Marshal(runTotalsJSON{
+		ID:        t.ID,
+		Title:     t.Title,
+		StartTime: t.StartTime,
+		Distance:  optionalFloat(t.Distance),
+		Duration:  optionalFloat(t.Duration),
+		Calories:  optionalFloat(t.Calories),
+		Ascent:    optionalFloat(t.Ascent),
+	})
+}
+
+// optionalFloat returns nil for the missing (NaN) values
+func optionalFloat(value float64) *float64 {
+	if math.IsNaN(value) {
+		return nil
+	}
+	return &value
+}
+
+// WriteText writes the report in a human readable format
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "Differences:")
+	fmt.Fprintln(tw, "DATE\tNRC ID\tSTRAVA ID\tFIELD\tNRC\tSTRAVA")
+	for _, run := range r.Matched {
+		for _, difference := range run.Differences {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				run.NRC.StartTime.Format("2006-01-02 15:04"), run.NRC.ID, run.Strava.ID,
+				difference.Field, difference.NRC, difference.Strava)
+		}
+	}
+
+	fmt.Fprintln(tw, "\nMissing on Strava:")
+	fmt.Fprintln(tw, "DATE\tNRC ID\tTITLE\tDISTANCE")
+	for _, run := range r.MissingOnStrava {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n",
+			run.StartTime.Format("2006-01-02 15:04"), run.ID, run.Title, formatValue(run.Distance, "%.0fm"))
+	}
+
+	fmt.Fprintln(tw, "\nMissing on NRC:")
+	fmt.Fprintln(tw, "DATE\tSTRAVA ID\tTITLE\tDISTANCE")
+	for _, run := range r.MissingOnNRC {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n",
+			run.StartTime.Format("2006-01-02 15:04"), run.ID, run.Title, formatValue(run.Distance, "%.0fm"))
+	}
+
+	different := 0
+	for _, run := range r.Matched {
+		if len(run.Differences) > 0 {
+			different++
+		}
+	}
+
+	fmt.Fprintf(tw, "\n%d matched (%d with differences), %d missing on Strava, %d missing on NRC\n",
+		len(r.Matched), different, len(r.MissingOnStrava), len(r.MissingOnNRC))
+
+	return tw.Flush()
+}
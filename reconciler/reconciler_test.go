@@ -0,0 +1,129 @@
+package reconciler_test
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mxdc/nrc2strava/converter"
+	"github.com/mxdc/nrc2strava/fit"
+	"github.com/mxdc/nrc2strava/parser"
+	"github.com/mxdc/nrc2strava/reconciler"
+	"github.com/mxdc/nrc2strava/report"
+	"github.com/mxdc/nrc2strava/types"
+)
+
+const (
+	corpusDir       = "../converter/testdata/corpus"
+	outdoorID       = "c0a1b2c3-0001-4000-8000-000000000001"
+	treadmillID     = "c0a1b2c3-0002-4000-8000-000000000002"
+	overriddenTitle = "Evening run"
+)
+
+// newOverriddenConverter returns a converter renaming the outdoor run and excluding the treadmill run
+func newOverriddenConverter() *converter.ActivitiesConverter {
+	activitiesConverter := converter.InitActivitiesConverter()
+	activitiesConverter.Overrides = map[string]types.Override{
+		outdoorID:   {Title: overriddenTitle},
+		treadmillID: {Exclude: true},
+	}
+	return activitiesConverter
+}
+
+// writeMigratedRun writes the outdoor run as migrated with the overrides, into a Strava activities directory
+func writeMigratedRun(t *testing.T) string {
+	t.Helper()
+
+	f, err := os.Open(corpusDir + "/outdoor.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	nikeActivity, err := parser.ParseActivity(f)
+	if err != nil {
+		t.Fatalf("ParseActivity() error = %v", err)
+	}
+
+	stravaDir := t.TempDir()
+	run := newOverriddenConverter().ConvertRun(nikeActivity)
+	if _, err := fit.InitActivityWriter(stravaDir).WriteFIT(run); err != nil {
+		t.Fatalf("WriteFIT() error = %v", err)
+	}
+	return stravaDir
+}
+
+// TestReconcileOverrides checks the NRC runs are converted with the overrides used for the migration
+func TestReconcileOverrides(t *testing.T) {
+	stravaDir := writeMigratedRun(t)
+
+	runReconciler := reconciler.NewReconciler(corpusDir, stravaDir)
+	runReconciler.Converter = newOverriddenConverter()
+	runReconciler.Report = report.NewReport("reconcile")
+	reconciliation, err := runReconciler.Reconcile()
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if len(reconciliation.Matched) != 1 || reconciliation.Matched[0].NRC.ID != outdoorID {
+		t.Fatalf("Reconcile() matched %+v, want the outdoor run", reconciliation.Matched)
+	}
+	if matched := reconciliation.Matched[0]; matched.NRC.Title != overriddenTitle || len(matched.Differences) > 0 {
+		t.Errorf("outdoor run title %q, differences %+v, want the overridden title without difference", matched.NRC.Title, matched.Differences)
+	}
+	for _, run := range reconciliation.MissingOnStrava {
+		if run.ID == treadmillID {
+			t.Errorf("excluded treadmill run reported missing on Strava")
+		}
+	}
+
+	// The 6 NRC runs and the Strava run are processed, the excluded run is skipped
+	if outcome := runReconciler.Report; outcome.Processed != 7 || outcome.Skipped != 1 || outcome.Failed != 0 {
+		t.Errorf("run report processed %d, skipped %d, failed %d, want 7, 1, 0", outcome.Processed, outcome.Skipped, outcome.Failed)
+	}
+
+	// Without the overrides, the title differs
+	reconciliation, err = reconciler.NewReconciler(corpusDir, stravaDir).Reconcile()
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(reconciliation.Matched) != 1 || len(reconciliation.Matched[0].Differences) != 1 || reconciliation.Matched[0].Differences[0].Field != "title" {
+		t.Errorf("Reconcile() without overrides matched %+v, want a title difference", reconciliation.Matched)
+	}
+}
+
+// TestWriteJSON checks the missing values are left out, without changing the report
+func TestWriteJSON(t *testing.T) {
+	reconciliation := &reconciler.Report{
+		Matched:         []reconciler.MatchedRun{},
+		MissingOnStrava: []reconciler.RunTotals{},
+		MissingOnNRC: []reconciler.RunTotals{{
+			ID:        "123",
+			StartTime: time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC),
+			Distance:  5000,
+			Duration:  1500,
+			Calories:  math.NaN(),
+			Ascent:    0,
+		}},
+	}
+
+	var encoded bytes.Buffer
+	if err := reconciliation.WriteJSON(&encoded); err != nil {
+		t.Fatalf("WriteJSON() error = %v", err)
+	}
+
+	for _, want := range []string{`"distance": 5000`, `"ascent": 0`} {
+		if !strings.Contains(encoded.String(), want) {
+			t.Errorf("WriteJSON() misses %s:\n%s", want, encoded.String())
+		}
+	}
+	if strings.Contains(encoded.String(), "calories") {
+		t.Errorf("WriteJSON() encoded the missing calories:\n%s", encoded.String())
+	}
+	if !math.IsNaN(reconciliation.MissingOnNRC[0].Calories) {
+		t.Errorf("WriteJSON() changed the missing calories to %f", reconciliation.MissingOnNRC[0].Calories)
+	}
+}
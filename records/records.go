@@ -0,0 +1,326 @@
+// Package records finds the personal records across the NRC activities
+package records
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"text/tabwriter"
+	"time"
+
+	"github.com/muktihari/fit/profile/basetype"
+	"github.com/muktihari/fit/profile/mesgdef"
+	"github.com/muktihari/fit/profile/typedef"
+	"github.com/mxdc/nrc2strava/converter"
+	"github.com/mxdc/nrc2strava/fit"
+	"github.com/mxdc/nrc2strava/parser"
+	"github.com/mxdc/nrc2strava/report"
+	"github.com/mxdc/nrc2strava/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// Distance is a distance of the best efforts
+type Distance struct {
+	Name   string
+	Meters float64
+}
+
+// Distances are the distances of the best efforts, from the shortest
+var Distances = []Distance{
+	{"400m", 400},
+	{"1K", 1000},
+	{"1 mile", 1609.344},
+	{"5K", 5000},
+	{"10K", 10000},
+	{"Half marathon", 21097.5},
+	{"Marathon", 42195},
+}
+
+// Record is the best result of a run, or of a part of a run for the best efforts
+type Record struct {
+	Name       string    `json:"name"`
+	Distance   float64   `json:"distance"`         // m
+	Time       float64   `json:"time"`             // s, elapsed time of the effort, timer time of the run
+	Ascent     float64   `json:"ascent,omitempty"` // m
+	StartTime  time.Time `json:"start_time"`       // start of the effort
+	Date       time.Time `json:"date"`             // start of the run
+	Title      string    `json:"title"`
+	ActivityID string    `json:"activity_id"`
+	File       string    `json:"file,omitempty"` // NRC activity file of the run
+}
+
+// Report holds the personal records, the distances never run have no best effort
+type Report struct {
+	BestEfforts  []Record `json:"best_efforts"`
+	LongestRun   *Record  `json:"longest_run,omitempty"`
+	BiggestClimb *Record  `json:"biggest_climb,omitempty"`
+}
+
+// Finder scans the NRC activities for the personal records
+type Finder struct {
+	activitiesDir string
+
+	// Converter converts the activities, with the corrections of the user such as the overrides.
+	// Its record interval is ignored, the best efforts need a record per second.
+	Converter *converter.ActivitiesConverter
+
+	// Report records the searched, skipped and unreadable activities, if set
+	Report *report.Report
+
+	logger *logrus.Logger
+}
+
+// NewFinder initializes a new Finder instance
+func NewFinder(activitiesDir string) *Finder {
+	logger := utils.Logger
+
+	return &Finder{
+		activitiesDir: activitiesDir,
+		Converter:     converter.InitActivitiesConverter(),
+		logger:        logger,
+	}
+}
+
+// Find converts every run and returns its personal records
+func (f *Finder) Find() (*Report, error) {
+	activitiesParser := parser.InitActivitiesParser(f.activitiesDir, "")
+	activitiesParser.Report = f.Report
+
+	nikeActivities, err := activitiesParser.LoadActivities()
+	if err != nil {
+		return nil, err
+	}
+
+	// The best efforts are searched in the per second distance stream, the converter of the caller is left untouched
+	activitiesConverter := *f.Converter
+	activitiesConverter.RecordInterval = converter.DefaultRecordInterval
+
+	f.logger.Infof("Searching the personal records of %d activities...\n", len(nikeActivities))
+
+	report := &Report{BestEfforts: []Record{}}
+	bestEfforts := make([]*Record, len(Distances))
+
+	for _, nikeActivity := range nikeActivities {
+		if activitiesConverter.IsExcluded(nikeActivity) {
+			f.logger.Debugf("Skipping excluded activity: %s\n", nikeActivity.ID)
+			f.Report.AddSkipped(nikeActivity.ID, "", "excluded by override")
+			continue
+		}
+
+		run := activitiesConverter.ConvertRun(nikeActivity)
+		if len(run.Activity.Sessions) == 0 || run.Activity.Sessions[0].Sport != typedef.SportRunning {
+			f.logger.Debugf("Skipping non running activity: %s\n", nikeActivity.ID)
+			f.Report.AddSkipped(nikeActivity.ID, "", "not a run")
+			continue
+		}
+
+		session := run.Activity.Sessions[0]
+		base := Record{
+			Date:       session.StartTime,
+			StartTime:  session.StartTime,
+			Title:      fit.DeveloperFieldValue(session.DeveloperFields, fit.FieldTitle),
+			ActivityID: nikeActivity.ID,
+			File:       nikeActivity.FilePath,
+		}
+
+		stops := timerStops(run.Activity.Events)
+		for i, distance := range Distances {
+			effort, ok := bestEffort(run.Activity.Records, stops, distance.Meters)
+			if !ok || (bestEfforts[i] != nil && bestEfforts[i].Time <= effort.Time) {
+				continue
+			}
+
+			effort.Name = distance.Name
+			effort.Date, effort.Title, effort.ActivityID, effort.File = base.Date, base.Title, base.ActivityID, base.File
+			bestEfforts[i] = &effort
+		}
+
+		report.LongestRun = longest(report.LongestRun, base, session)
+		report.BiggestClimb = biggestClimb(report.BiggestClimb, base, session)
+		f.Report.AddProcessed(nikeActivity.ID, "")
+	}
+
+	for _, effort := range bestEfforts {
+		if effort != nil {
+			report.BestEfforts = append(report.BestEfforts, *effort)
+		}
+	}
+
+	f.logger.Infof("✓ Found %d best efforts\n", len(report.BestEfforts))
+	return report, nil
+}
+
+// bestEffort returns the fastest part of the records covering the distance, without a timer stop.
+// The start of the effort is interpolated between two records to cover the exact distance.
+func bestEffort(records []*mesgdef.Record, stops []time.Time, distance float64) (Record, bool) {
+	best := Record{Time: math.Inf(1)}
+
+	start := 0
+	for end := 1; end < len(records); end++ {
+		endDistance := records[end].DistanceScaled()
+		if math.IsNaN(endDistance) {
+			continue
+		}
+
+		// Move to the last record from which the distance is covered, skipping the records without distance
+		for next := start + 1; next < end; next++ {
+			nextDistance := records[next].DistanceScaled()
+			if math.IsNaN(nextDistance) {
+				continue
+			}
+			if endDistance-nextDistance < distance {
+				break
+			}
+			start = next
+		}
+		if !coveredFrom(records[start], endDistance, distance) {
+			continue
+		}
+
+		// Interpolate toward the next record having a distance, the end record at the latest
+		next := start + 1
+		for math.IsNaN(records[next].DistanceScaled()) {
+			next++
+		}
+
+		// The elapsed time of an effort across a pause would include the pause
+		startTime := effortStart(records[start], records[next], endDistance-distance)
+		if spansStop(stops, startTime, records[end].Timestamp) {
+			continue
+		}
+
+		if elapsed := records[end].Timestamp.Sub(startTime).Seconds(); elapsed > 0 && elapsed < best.Time {
+			best = Record{Distance: distance, Time: elapsed, StartTime: startTime}
+		}
+	}
+
+	return best, !math.IsInf(best.Time, 1)
+}
+
+// timerStops returns the times at which the timer was paused
+func timerStops(events []*mesgdef.Event) []time.Time {
+	var stops []time.Time
+	for _, event := range events {
+		if event.Event == typedef.EventTimer && event.EventType == typedef.EventTypeStop {
+			stops = append(stops, event.Timestamp)
+		}
+	}
+	return stops
+}
+
+// spansStop reports whether the timer was paused between the start and the end
+func spansStop(stops []time.Time, start, end time.Time) bool {
+	for _, stop := range stops {
+		if stop.After(start) && stop.Before(end) {
+			return true
+		}
+	}
+	return false
+}
+
+// coveredFrom reports whether the distance is covered from the record to the end distance
+func coveredFrom(record *mesgdef.Record, endDistance, distance float64) bool {
+	startDistance := record.DistanceScaled()
+	return !math.IsNaN(startDistance) && endDistance-startDistance >= distance
+}
+
+// effortStart returns the time at which the distance between both records reaches the target
+func effortStart(record, next *mesgdef.Record, target float64) time.Time {
+	startDistance, nextDistance := record.DistanceScaled(), next.DistanceScaled()
+	if math.IsNaN(nextDistance) || nextDistance <= startDistance || target <= startDistance {
+		return record.Timestamp
+	}
+
+	ratio := min((target-startDistance)/(nextDistance-startDistance), 1)
+	return record.Timestamp.Add(time.Duration(ratio * float64(next.Timestamp.Sub(record.Timestamp))))
+}
+
+// longest returns the longest of the current record and the run
+func longest(current *Record, base Record, session *mesgdef.Session) *Record {
+	distance := session.TotalDistanceScaled()
+	if math.IsNaN(distance) || (current != nil && current.Distance >= distance) {
+		return current
+	}
+
+	base.Name = "Longest run"
+	base.Distance = distance
+	base.Time = timerTime(session)
+	return &base
+}
+
+// biggestClimb returns the biggest climb of the current record and the run
+func biggestClimb(current *Record, base Record, session *mesgdef.Session) *Record {
+	if session.TotalAscent == basetype.Uint16Invalid || session.TotalAscent == 0 {
+		return current
+	}
+
+	ascent := float64(session.TotalAscent)
+	if current != nil && current.Ascent >= ascent {
+		return current
+	}
+
+	base.Name = "Biggest climb"
+	base.Distance = session.TotalDistanceScaled()
+	base.Time = timerTime(session)
+	base.Ascent = ascent
+	return &base
+}
+
+// timerTime returns the time of the run without its pauses, the elapsed time when NRC has no active duration
+func timerTime(session *mesgdef.Session) float64 {
+	if timerTime := session.TotalTimerTimeScaled(); !math.IsNaN(timerTime) {
+		return timerTime
+	}
+	return session.TotalElapsedTimeScaled()
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteText writes the report as a table
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "RECORD\tRESULT\tPACE\tDATE\tTITLE\tNRC ID\tFILE")
+	for _, effort := range r.BestEfforts {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			effort.Name, formatDuration(effort.Time), formatPace(effort.Distance, effort.Time),
+			effort.Date.Format("2006-01-02"), effort.Title, effort.ActivityID, effort.File)
+	}
+
+	if run := r.LongestRun; run != nil {
+		fmt.Fprintf(tw, "%s\t%.2fkm\t%s\t%s\t%s\t%s\t%s\n",
+			run.Name, run.Distance/1000, formatPace(run.Distance, run.Time),
+			run.Date.Format("2006-01-02"), run.Title, run.ActivityID, run.File)
+	}
+
+	if climb := r.BiggestClimb; climb != nil {
+		fmt.Fprintf(tw, "%s\t%.0fm\t%s\t%s\t%s\t%s\t%s\n",
+			climb.Name, climb.Ascent, "-",
+			climb.Date.Format("2006-01-02"), climb.Title, climb.ActivityID, climb.File)
+	}
+
+	return tw.Flush()
+}
+
+// formatDuration formats seconds as h:mm:ss or m:ss
+func formatDuration(seconds float64) string {
+	total := int(math.Round(seconds))
+	if total >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", total/3600, total%3600/60, total%60)
+	}
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
+
+// formatPace formats the pace in min/km
+func formatPace(distance, seconds float64) string {
+	if distance <= 0 || seconds <= 0 || math.IsNaN(seconds) {
+		return "-"
+	}
+	return formatDuration(seconds/distance*1000) + "/km"
+}
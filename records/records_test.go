@@ -0,0 +1,179 @@
+package records
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/muktihari/fit/profile/mesgdef"
+	"github.com/mxdc/nrc2strava/converter"
+	"github.com/mxdc/nrc2strava/report"
+	"github.com/mxdc/nrc2strava/types"
+)
+
+// recordsStart is the time of the first record of newRecords
+var recordsStart = time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+
+// newRecords returns a record per second covering the distances in meters
+func newRecords(distances ...float64) []*mesgdef.Record {
+	records := make([]*mesgdef.Record, len(distances))
+	for i, distance := range distances {
+		records[i] = mesgdef.NewRecord(nil).SetTimestamp(recordsStart.Add(time.Duration(i) * time.Second))
+		if !math.IsNaN(distance) {
+			records[i].SetDistanceScaled(distance)
+		}
+	}
+	return records
+}
+
+func TestBestEffort(t *testing.T) {
+	tests := []struct {
+		name      string
+		distances []float64
+		distance  float64
+		stops     []float64 // s after the first record
+		want      float64
+		found     bool
+	}{
+		{"too short", []float64{0, 3, 6, 9}, 10, nil, 0, false},
+		{"exact", []float64{0, 3, 6, 9}, 9, nil, 3, true},
+		// 4m/s between the seconds 2 and 4
+		{"fastest part", []float64{0, 3, 6, 10, 14, 17, 20}, 8, nil, 2, true},
+		// The effort starts in the middle of the first second
+		{"interpolated start", []float64{0, 4, 8, 12}, 10, nil, 2.5, true},
+		{"standing still", []float64{0, 3, 3, 3, 3, 6}, 6, nil, 5, true},
+		// The timer stopped between the seconds 1 and 4
+		{"across a timer stop", []float64{0, 3, 3, 3, 3, 6}, 6, []float64{1.5}, 0, false},
+		{"after a timer stop", []float64{0, 3, 3, 3, 3, 6, 9}, 6, []float64{1.5}, 2, true},
+		{"timer stop at the end of the effort", []float64{0, 3, 6, 9}, 9, []float64{3}, 3, true},
+		{"missing distances", []float64{math.NaN(), 0, math.NaN(), 4, 8}, 8, nil, 3, true},
+		// The start moves past the record without distance
+		{"gap before the fastest part", []float64{0, math.NaN(), 5, 10, 15, 20, 25}, 5, nil, 1, true},
+		// The start is interpolated across the gap
+		{"interpolated across a gap", []float64{0, math.NaN(), 10}, 5, nil, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stops := []time.Time{}
+			for _, stop := range tt.stops {
+				stops = append(stops, recordsStart.Add(time.Duration(stop*float64(time.Second))))
+			}
+
+			effort, found := bestEffort(newRecords(tt.distances...), stops, tt.distance)
+			if found != tt.found || (found && math.Abs(effort.Time-tt.want) > 1e-6) {
+				t.Errorf("bestEffort() = %.3fs, %t, want %.3fs, %t", effort.Time, found, tt.want, tt.found)
+			}
+		})
+	}
+}
+
+// TestFind searches the records of the converter corpus, whose runs are shorter than 1K
+func TestFind(t *testing.T) {
+	report, err := NewFinder("../converter/testdata/corpus").Find()
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+
+	if len(report.BestEfforts) != 1 || report.BestEfforts[0].Name != "400m" {
+		t.Fatalf("Find() best efforts = %+v, want the 400m only", report.BestEfforts)
+	}
+	if effort := report.BestEfforts[0]; effort.Time <= 0 || effort.Time > 400/2.5 || len(effort.ActivityID) == 0 {
+		t.Errorf("400m best effort = %+v", effort)
+	}
+
+	if report.LongestRun == nil || report.LongestRun.ActivityID != "c0a1b2c3-0001-4000-8000-000000000001" {
+		t.Errorf("longest run = %+v, want the outdoor run", report.LongestRun)
+	}
+	if file := filepath.Join("../converter/testdata/corpus", "outdoor.json"); report.LongestRun.File != file {
+		t.Errorf("longest run file = %q, want %q", report.LongestRun.File, file)
+	}
+	if report.BiggestClimb == nil || report.BiggestClimb.Ascent <= 0 {
+		t.Errorf("biggest climb = %+v", report.BiggestClimb)
+	}
+
+	var text bytes.Buffer
+	if err := report.WriteText(&text); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	for _, want := range []string{"400m", "Longest run", "Biggest climb", report.LongestRun.ActivityID, report.LongestRun.File} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("WriteText() misses %q:\n%s", want, text.String())
+		}
+	}
+
+	var encoded bytes.Buffer
+	if err := report.WriteJSON(&encoded); err != nil {
+		t.Fatalf("WriteJSON() error = %v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(encoded.Bytes(), &decoded); err != nil || len(decoded.BestEfforts) != 1 {
+		t.Errorf("WriteJSON() = %s, %v", encoded.String(), err)
+	}
+}
+
+// TestFindPaused checks the pause of the run is left out of its time and of its best efforts
+func TestFindPaused(t *testing.T) {
+	// The run covers 382m before its 60s pause, and 351m after
+	activitiesDir := t.TempDir()
+	data, err := os.ReadFile("../converter/testdata/corpus/paused.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(activitiesDir, "paused.json"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := NewFinder(activitiesDir).Find()
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+
+	if len(report.BestEfforts) != 0 {
+		t.Errorf("Find() best efforts = %+v, want none across the pause", report.BestEfforts)
+	}
+	if report.LongestRun == nil || report.LongestRun.Time != 240 {
+		t.Errorf("longest run = %+v, want the 240s timer time", report.LongestRun)
+	}
+}
+
+// TestFindOverrides checks the records have the title of the converted run and skip the excluded runs
+func TestFindOverrides(t *testing.T) {
+	finder := NewFinder("../converter/testdata/corpus")
+	finder.Converter.Overrides = map[string]types.Override{
+		"c0a1b2c3-0001-4000-8000-000000000001": {Title: "Evening run"},
+		"c0a1b2c3-0002-4000-8000-000000000002": {Exclude: true},
+	}
+	finder.Report = report.NewReport("records")
+
+	records, err := finder.Find()
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if records.LongestRun == nil || records.LongestRun.Title != "Evening run" {
+		t.Errorf("longest run = %+v, want the overridden title", records.LongestRun)
+	}
+
+	// The excluded treadmill run is skipped
+	if outcome := finder.Report; outcome.Processed != 6 || outcome.Skipped != 1 || outcome.Failed != 0 {
+		t.Errorf("run report processed %d, skipped %d, failed %d, want 6, 1, 0", outcome.Processed, outcome.Skipped, outcome.Failed)
+	}
+}
+
+// TestFindConverterUntouched checks the record interval of the caller converter is kept
+func TestFindConverterUntouched(t *testing.T) {
+	finder := NewFinder("../converter/testdata/corpus")
+	finder.Converter.RecordInterval = converter.RecordIntervalNative
+
+	if _, err := finder.Find(); err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if finder.Converter.RecordInterval != converter.RecordIntervalNative {
+		t.Errorf("Find() changed the converter record interval to %s", finder.Converter.RecordInterval)
+	}
+}
@@ -0,0 +1,121 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Status is the outcome of an activity
+type Status string
+
+const (
+	StatusProcessed Status = "processed"
+	StatusSkipped   Status = "skipped"
+	StatusFailed    Status = "failed"
+)
+
+// Entry is the outcome of a single activity
+type Entry struct {
+	ID     string `json:"id,omitempty"`
+	File   string `json:"file,omitempty"`
+	Status Status `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Report lists the activities processed, skipped and failed by a command.
+// A nil Report ignores the entries, so the components don't have to check it.
+type Report struct {
+	Command    string    `json:"command"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+
+	// Error is the error which stopped the command, if any
+	Error string `json:"error,omitempty"`
+
+	Processed int `json:"processed"`
+	Skipped   int `json:"skipped"`
+	Failed    int `json:"failed"`
+
+	Activities []Entry `json:"activities"`
+
+	mutex sync.Mutex
+}
+
+// NewReport initializes a new Report of the command
+func NewReport(command string) *Report {
+	return &Report{
+		Command:    command,
+		StartedAt:  time.Now().UTC(),
+		Activities: []Entry{},
+	}
+}
+
+// AddProcessed records a successfully processed activity
+func (r *Report) AddProcessed(id, file string) {
+	r.add(Entry{ID: id, File: file, Status: StatusProcessed})
+}
+
+// AddSkipped records an activity skipped on purpose
+func (r *Report) AddSkipped(id, file, reason string) {
+	r.add(Entry{ID: id, File: file, Status: StatusSkipped, Reason: reason})
+}
+
+// AddFailed records an activity which couldn't be processed
+func (r *Report) AddFailed(id, file string, err error) {
+	r.add(Entry{ID: id, File: file, Status: StatusFailed, Reason: err.Error()})
+}
+
+func (r *Report) add(entry Entry) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	switch entry.Status {
+	case StatusProcessed:
+		r.Processed++
+	case StatusSkipped:
+		r.Skipped++
+	case StatusFailed:
+		r.Failed++
+	}
+
+	r.Activities = append(r.Activities, entry)
+}
+
+// WriteJSON finishes the report and writes it as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.FinishedAt = time.Now().UTC()
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteFile writes the report to the file, or to the standard output for "-"
+func (r *Report) WriteFile(filePath string) error {
+	if filePath == "-" {
+		return r.WriteJSON(os.Stdout)
+	}
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("error creating report file: %w", err)
+	}
+	defer f.Close()
+
+	if err := r.WriteJSON(f); err != nil {
+		return fmt.Errorf("error writing report file: %w", err)
+	}
+
+	return nil
+}
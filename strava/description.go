@@ -0,0 +1,43 @@
+package strava
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mxdc/nrc2strava/types"
+)
+
+// BuildDescription returns the Strava activity description of the NRC run metadata
+func BuildDescription(metadata types.RunMetadata) string {
+	lines := []string{}
+
+	if len(metadata.Note) > 0 {
+		lines = append(lines, metadata.Note)
+	}
+
+	if len(metadata.ShoeName) > 0 {
+		lines = append(lines, "Shoes: "+metadata.ShoeName)
+	}
+
+	weather := metadata.Weather
+	if len(metadata.Temperature) > 0 {
+		weather = strings.TrimSpace(fmt.Sprintf("%s %s°C", weather, metadata.Temperature))
+	}
+	if len(weather) > 0 {
+		lines = append(lines, "Weather: "+weather)
+	}
+
+	if len(metadata.Terrain) > 0 {
+		lines = append(lines, "Terrain: "+metadata.Terrain)
+	}
+
+	if len(metadata.Mood) > 0 {
+		lines = append(lines, "Feeling: "+metadata.Mood)
+	}
+
+	if len(metadata.PerceivedEffort) > 0 {
+		lines = append(lines, "Perceived effort: "+metadata.PerceivedEffort+"/10")
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,38 @@
+package strava_test
+
+import (
+	"testing"
+
+	"github.com/mxdc/nrc2strava/strava"
+	"github.com/mxdc/nrc2strava/types"
+)
+
+func TestBuildDescription(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata types.RunMetadata
+		want     string
+	}{
+		{
+			"every field",
+			types.RunMetadata{
+				ShoeID: "abc-123", ShoeName: "Pegasus 40", Note: "Felt great", Weather: "sunny",
+				Temperature: "18", Terrain: "road", PerceivedEffort: "6", Mood: "amped",
+			},
+			"Felt great\nShoes: Pegasus 40\nWeather: sunny 18°C\nTerrain: road\nFeeling: amped\nPerceived effort: 6/10",
+		},
+		{"temperature without weather", types.RunMetadata{Temperature: "-2"}, "Weather: -2°C"},
+		{"weather without temperature", types.RunMetadata{Weather: "rainy"}, "Weather: rainy"},
+		// The shoe ID is only used to find the gear
+		{"unnamed shoe", types.RunMetadata{ShoeID: "abc-123", Note: "Easy"}, "Easy"},
+		{"no metadata", types.RunMetadata{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strava.BuildDescription(tt.metadata); got != tt.want {
+				t.Errorf("BuildDescription() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
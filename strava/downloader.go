@@ -2,30 +2,39 @@ package strava
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/muktihari/fit/decoder"
+	"github.com/mxdc/nrc2strava/report"
 	"github.com/mxdc/nrc2strava/utils"
 	"github.com/sirupsen/logrus"
 )
 
+// downloadedFilenameRegexp matches the filenames: 2025-01-30_<ID>_<activity name>.fit
+var downloadedFilenameRegexp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}_(\d+)_(.*)\.fit$`)
+
 // StravaDownloader represents the Strava API client
 type StravaDownloader struct {
 	downloadActivitiesDir string
 	stravaWeb             *StravaWeb
-	logger                *logrus.Logger
+
+	// Report records the outcome of each download, if set
+	Report *report.Report
+
+	logger *logrus.Logger
 }
 
 // NewStravaDownloader initializes a new NewStravaDownloader instance
 func NewStravaDownloader(stravaWeb *StravaWeb, downloadActivitiesDir string) *StravaDownloader {
-	logger := logrus.New()
-	logger.SetFormatter(utils.LogFormat)
+	logger := utils.Logger
 
 	return &StravaDownloader{
 		downloadActivitiesDir: downloadActivitiesDir,
@@ -34,66 +43,42 @@ func NewStravaDownloader(stravaWeb *StravaWeb, downloadActivitiesDir string) *St
 	}
 }
 
-func (s *StravaDownloader) DownloadActivities() {
+// DownloadActivities saves the original files of the Strava activities, the activities which fail are skipped
+func (s *StravaDownloader) DownloadActivities(ctx context.Context) error {
 	s.logger.Info("Downloading activities from Strava...")
 
 	// Create the directory if it doesn't exist
 	if _, err := os.Stat(s.downloadActivitiesDir); os.IsNotExist(err) {
 		if err := os.Mkdir(s.downloadActivitiesDir, os.ModePerm); err != nil {
-			s.logger.Errorf("Error creating activities folder: %v\n", err)
-			return
+			return fmt.Errorf("error creating activities folder: %w", err)
 		}
 	}
 
-	activities, err := s.stravaWeb.GetActivityList()
+	activities, err := s.stravaWeb.GetActivityList(ctx)
 	if err != nil {
-		s.logger.Errorf("Error fetching activity list: %v\n", err)
-		return
+		return err
 	}
 
 	total := len(activities)
 	downloadedCount := 0
 
 	for _, activity := range activities {
-		// Build the download URL
-		downloadURL := activity.ActivityURL + "/export_original"
-		s.logger.Debugf("Downloading from: %s\n", downloadURL)
+		// Stop between two activities when canceled
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
 		// Download the file
-		req, err := http.NewRequest("GET", downloadURL, nil)
+		bodyBytes, err := s.downloadOriginal(ctx, activity)
 		if err != nil {
-			s.logger.Errorf("Error creating request for activity %d: %v\n", activity.ID, err)
-			continue
-		}
+			s.Report.AddFailed(strconv.FormatInt(activity.ID, 10), "", err)
+			if utils.ShouldAbort(err) {
+				return fmt.Errorf("error downloading activity %d: %w", activity.ID, err)
+			}
 
-		// Add cookies
-		cookies := []http.Cookie{
-			{Name: "_strava4_session", Value: s.stravaWeb.Strava4Session},
-		}
-		for _, cookie := range cookies {
-			req.AddCookie(&cookie)
-		}
-
-		// Send the request
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
 			s.logger.Errorf("Error downloading activity %d: %v\n", activity.ID, err)
 			continue
 		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			s.logger.Errorf("Error downloading activity %d: status %s\n", activity.ID, resp.Status)
-			continue
-		}
-
-		// Read the response body
-		bodyBytes, err := io.ReadAll(resp.Body)
-		if err != nil {
-			s.logger.Errorf("Error reading response body for activity %d: %v\n", activity.ID, err)
-			continue
-		}
 
 		// Create a new FIT decoder
 		d := decoder.New(bytes.NewReader(bodyBytes))
@@ -102,12 +87,13 @@ func (s *StravaDownloader) DownloadActivities() {
 		_, err = d.Decode()
 		if err != nil {
 			s.logger.Errorf("Failed to decode FIT response: %v", err)
+			s.Report.AddFailed(strconv.FormatInt(activity.ID, 10), "", fmt.Errorf("error decoding FIT response: %w", err))
 			continue
 		}
 
 		// Format the filename: 2025-01-30_<ID>_<activity name>.fit
 		activityDate := time.Unix(activity.StartDateLocalRaw, 0).Format("2006-01-02")
-		sanitizedName := sanitizeFilename(activity.Name)
+		sanitizedName := SanitizeFilename(activity.Name)
 		finalFilename := fmt.Sprintf("%s_%d_%s.fit", activityDate, activity.ID, sanitizedName)
 
 		// Save the file
@@ -115,19 +101,79 @@ func (s *StravaDownloader) DownloadActivities() {
 		err = os.WriteFile(filePath, bodyBytes, 0644)
 		if err != nil {
 			s.logger.Errorf("Error saving activity %d: %v\n", activity.ID, err)
+			s.Report.AddFailed(strconv.FormatInt(activity.ID, 10), "", err)
 			continue
 		}
 
+		s.Report.AddProcessed(strconv.FormatInt(activity.ID, 10), filePath)
+
 		downloadedCount++
 		s.logger.Infof("✓ Downloaded %d/%d activities (%s)\n", downloadedCount, total, finalFilename)
-		time.Sleep(10 * time.Millisecond)
+		if err := utils.Sleep(ctx, 10*time.Millisecond); err != nil {
+			return err
+		}
 	}
 
 	s.logger.Infof("✓ Finished downloading %d activities\n", downloadedCount)
+	return nil
+}
+
+// downloadOriginal returns the original file of the activity, its response body is closed before the next download
+func (s *StravaDownloader) downloadOriginal(ctx context.Context, activity Activity) ([]byte, error) {
+	// Build the download URL
+	downloadURL := activity.ActivityURL + "/export_original"
+	s.logger.Debugf("Downloading from: %s\n", downloadURL)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	// Add cookies
+	cookies := []http.Cookie{
+		{Name: "_strava4_session", Value: s.stravaWeb.Strava4Session},
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(&cookie)
+	}
+
+	// Send the request
+	resp, err := s.stravaWeb.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, utils.StatusError(resp)
+	}
+
+	// Read the response body
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	return bodyBytes, nil
+}
+
+// ParseDownloadedFilename extracts the activity ID and sanitized name from a file saved by the downloader
+func ParseDownloadedFilename(filename string) (int64, string, bool) {
+	matches := downloadedFilenameRegexp.FindStringSubmatch(filepath.Base(filename))
+	if matches == nil {
+		return 0, "", false
+	}
+
+	id, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+
+	return id, matches[2], true
 }
 
-// sanitizeFilename replaces spaces and invisible characters with underscores
-func sanitizeFilename(name string) string {
+// SanitizeFilename replaces spaces and invisible characters with underscores
+func SanitizeFilename(name string) string {
 	// Replace spaces with underscores
 	name = regexp.MustCompile(`\s+`).ReplaceAllString(name, "_")
 	// Replace any non-alphanumeric characters (except hyphen, underscore) with underscores
@@ -0,0 +1,135 @@
+package strava_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mxdc/nrc2strava/report"
+	"github.com/mxdc/nrc2strava/strava"
+	"github.com/mxdc/nrc2strava/strava/stravatest"
+	"github.com/mxdc/nrc2strava/utils"
+)
+
+// addActivities adds the FIT fixture to the account under several names, one day apart
+func addActivities(t *testing.T, server *stravatest.Server, count int) []stravatest.Activity {
+	t.Helper()
+
+	data, err := os.ReadFile(writeFITFixture(t, t.TempDir()))
+	if err != nil {
+		t.Fatalf("error reading the FIT fixture: %v", err)
+	}
+
+	start := time.Date(2024, 1, 1, 7, 0, 0, 0, time.UTC)
+	activities := []stravatest.Activity{}
+	for i := range count {
+		activities = append(activities, server.AddActivity(stravatest.Activity{
+			Name:      fmt.Sprintf("Morning Run %d", i+1),
+			StartTime: start.AddDate(0, 0, i),
+			Distance:  5000,
+			Data:      data,
+		}))
+	}
+
+	return activities
+}
+
+func TestDownloadActivities(t *testing.T) {
+	server := newFakeServer(t)
+
+	// More than a page of 20 activities
+	activities := addActivities(t, server, 25)
+	downloadDir := filepath.Join(t.TempDir(), "strava-downloaded")
+
+	downloader := strava.NewStravaDownloader(newStravaWeb(server, session), downloadDir)
+	downloader.Report = report.NewReport("strava-download")
+
+	if err := downloader.DownloadActivities(context.Background()); err != nil {
+		t.Fatalf("DownloadActivities() error = %v", err)
+	}
+
+	files, err := os.ReadDir(downloadDir)
+	if err != nil {
+		t.Fatalf("error reading the download directory: %v", err)
+	}
+	if len(files) != len(activities) {
+		t.Errorf("DownloadActivities() saved %d files, want %d", len(files), len(activities))
+	}
+
+	first := activities[0]
+	filename := fmt.Sprintf("2024-01-01_%d_Morning_Run_1.fit", first.ID)
+	data, err := os.ReadFile(filepath.Join(downloadDir, filename))
+	if err != nil {
+		t.Fatalf("activity %d not saved as %s: %v", first.ID, filename, err)
+	}
+	if string(data) != string(first.Data) {
+		t.Errorf("activity %d saved with a different content", first.ID)
+	}
+
+	if id, name, ok := strava.ParseDownloadedFilename(filename); !ok || id != first.ID || name != "Morning_Run_1" {
+		t.Errorf("ParseDownloadedFilename(%q) = %d, %q, %t", filename, id, name, ok)
+	}
+
+	if downloader.Report.Processed != len(activities) {
+		t.Errorf("report processed = %d, want %d", downloader.Report.Processed, len(activities))
+	}
+}
+
+func TestDownloadActivitiesSkipsFailedActivity(t *testing.T) {
+	server := newFakeServer(t)
+	activities := addActivities(t, server, 3)
+	server.FailExport(activities[1].ID, http.StatusInternalServerError)
+
+	downloader := strava.NewStravaDownloader(newStravaWeb(server, session), t.TempDir())
+	downloader.Report = report.NewReport("strava-download")
+
+	if err := downloader.DownloadActivities(context.Background()); err != nil {
+		t.Fatalf("DownloadActivities() error = %v", err)
+	}
+
+	if downloader.Report.Processed != 2 || downloader.Report.Failed != 1 {
+		t.Errorf("report processed = %d, failed = %d, want 2 and 1", downloader.Report.Processed, downloader.Report.Failed)
+	}
+}
+
+func TestDownloadActivitiesAbortsOnRateLimit(t *testing.T) {
+	server := newFakeServer(t)
+	activities := addActivities(t, server, 3)
+
+	// The list is sorted from the newest, the last activity added is the first downloaded
+	server.FailExport(activities[2].ID, http.StatusTooManyRequests)
+
+	downloader := strava.NewStravaDownloader(newStravaWeb(server, session), t.TempDir())
+	downloader.Report = report.NewReport("strava-download")
+
+	err := downloader.DownloadActivities(context.Background())
+	if !errors.Is(err, utils.ErrRateLimited) {
+		t.Fatalf("DownloadActivities() error = %v, want ErrRateLimited", err)
+	}
+
+	if downloader.Report.Processed != 0 {
+		t.Errorf("report processed = %d, want 0", downloader.Report.Processed)
+	}
+}
+
+func TestDownloadActivitiesInvalidSession(t *testing.T) {
+	server := newFakeServer(t)
+	addActivities(t, server, 1)
+
+	downloader := strava.NewStravaDownloader(newStravaWeb(server, "expired-session"), t.TempDir())
+	err := downloader.DownloadActivities(context.Background())
+	if !errors.Is(err, utils.ErrUnauthorized) {
+		t.Errorf("DownloadActivities() error = %v, want ErrUnauthorized", err)
+	}
+
+	// The list error is wrapped once, by the web client
+	if count := strings.Count(fmt.Sprint(err), "error fetching activity list"); count != 1 {
+		t.Errorf("DownloadActivities() error = %v, want the list context once", err)
+	}
+}
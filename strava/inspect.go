@@ -0,0 +1,343 @@
+package strava
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/muktihari/fit/profile/basetype"
+	"github.com/muktihari/fit/profile/filedef"
+)
+
+// FitSummary is a human readable summary of a FIT activity
+type FitSummary struct {
+	File            string              `json:"file"`
+	FileId          FileIdSummary       `json:"file_id"`
+	Title           string              `json:"title"`
+	DeveloperFields map[string]string   `json:"developer_fields"`
+	Sport           string              `json:"sport"`
+	SubSport        string              `json:"sub_sport"`
+	Sessions        []LapSummary        `json:"sessions"`
+	Laps            []LapSummary        `json:"laps"`
+	Events          []EventSummary      `json:"events"`
+	RecordCount     int                 `json:"record_count"`
+	BoundingBox     *BoundingBox        `json:"bounding_box,omitempty"`
+	TimeInZones     []TimeInZoneSummary `json:"time_in_zones,omitempty"`
+}
+
+type FileIdSummary struct {
+	Type         string    `json:"type"`
+	Manufacturer string    `json:"manufacturer"`
+	Product      uint16    `json:"product"`
+	SerialNumber uint32    `json:"serial_number"`
+	TimeCreated  time.Time `json:"time_created"`
+}
+
+// LapSummary holds the totals of a session or a lap
+type LapSummary struct {
+	StartTime        time.Time `json:"start_time"`
+	Timestamp        time.Time `json:"timestamp"`
+	TotalElapsedTime *float64  `json:"total_elapsed_time,omitempty"` // s
+	TotalTimerTime   *float64  `json:"total_timer_time,omitempty"`   // s
+	TotalDistance    *float64  `json:"total_distance,omitempty"`     // m
+	AvgSpeed         *float64  `json:"avg_speed,omitempty"`          // m/s
+	MaxSpeed         *float64  `json:"max_speed,omitempty"`          // m/s
+	TotalAscent      *uint16   `json:"total_ascent,omitempty"`       // m
+	TotalDescent     *uint16   `json:"total_descent,omitempty"`      // m
+	TotalCalories    *uint16   `json:"total_calories,omitempty"`     // kcal
+	AvgCadence       *uint8    `json:"avg_cadence,omitempty"`        // rpm
+	AvgHeartRate     *uint8    `json:"avg_heart_rate,omitempty"`     // bpm
+	AvgPower         *uint16   `json:"avg_power,omitempty"`          // W
+	MaxPower         *uint16   `json:"max_power,omitempty"`          // W
+	NormalizedPower  *uint16   `json:"normalized_power,omitempty"`   // W
+}
+
+// TimeInZoneSummary holds the time spent in the zones of a session or a lap
+type TimeInZoneSummary struct {
+	Reference      string        `json:"reference"`
+	ReferenceIndex uint16        `json:"reference_index"`
+	HeartRate      []ZoneSummary `json:"heart_rate,omitempty"`
+	Speed          []ZoneSummary `json:"speed,omitempty"`
+}
+
+// ZoneSummary is the time spent in a zone, from the high boundary of the previous zone to its own
+type ZoneSummary struct {
+	Zone         int     `json:"zone"`
+	HighBoundary float64 `json:"high_boundary"` // bpm or m/s
+	Time         float64 `json:"time"`          // s
+}
+
+type EventSummary struct {
+	Timestamp time.Time `json:"timestamp"`
+	Event     string    `json:"event"`
+	EventType string    `json:"event_type"`
+}
+
+// BoundingBox is the area covered by the GPS records, in degrees
+type BoundingBox struct {
+	MinLatitude  float64 `json:"min_latitude"`
+	MinLongitude float64 `json:"min_longitude"`
+	MaxLatitude  float64 `json:"max_latitude"`
+	MaxLongitude float64 `json:"max_longitude"`
+}
+
+// Summarize builds a FitSummary of the decoded FIT file
+func (f *FitActivity) Summarize(fileName string) FitSummary {
+	activity := filedef.NewActivity(f.Fit.Messages...)
+
+	summary := FitSummary{
+		File: fileName,
+		FileId: FileIdSummary{
+			Type:         activity.FileId.Type.String(),
+			Manufacturer: activity.FileId.Manufacturer.String(),
+			Product:      activity.FileId.Product,
+			SerialNumber: activity.FileId.SerialNumber,
+			TimeCreated:  activity.FileId.TimeCreated,
+		},
+		Title:           f.ExtractActivityTitle(),
+		DeveloperFields: f.DeveloperFields(),
+		Sessions:        []LapSummary{},
+		Laps:            []LapSummary{},
+		Events:          []EventSummary{},
+		RecordCount:     len(activity.Records),
+	}
+
+	for _, session := range activity.Sessions {
+		summary.Sport = session.Sport.String()
+		summary.SubSport = session.SubSport.String()
+		summary.Sessions = append(summary.Sessions, LapSummary{
+			StartTime:        session.StartTime,
+			Timestamp:        session.Timestamp,
+			TotalElapsedTime: optionalFloat(session.TotalElapsedTimeScaled()),
+			TotalTimerTime:   optionalFloat(session.TotalTimerTimeScaled()),
+			TotalDistance:    optionalFloat(session.TotalDistanceScaled()),
+			AvgSpeed:         optionalFloat(session.AvgSpeedScaled()),
+			MaxSpeed:         optionalFloat(session.MaxSpeedScaled()),
+			TotalAscent:      optionalUint16(session.TotalAscent),
+			TotalDescent:     optionalUint16(session.TotalDescent),
+			TotalCalories:    optionalUint16(session.TotalCalories),
+			AvgCadence:       optionalUint8(session.AvgCadence),
+			AvgHeartRate:     optionalUint8(session.AvgHeartRate),
+			AvgPower:         optionalUint16(session.AvgPower),
+			MaxPower:         optionalUint16(session.MaxPower),
+			NormalizedPower:  optionalUint16(session.NormalizedPower),
+		})
+	}
+
+	for _, lap := range activity.Laps {
+		summary.Laps = append(summary.Laps, LapSummary{
+			StartTime:        lap.StartTime,
+			Timestamp:        lap.Timestamp,
+			TotalElapsedTime: optionalFloat(lap.TotalElapsedTimeScaled()),
+			TotalTimerTime:   optionalFloat(lap.TotalTimerTimeScaled()),
+			TotalDistance:    optionalFloat(lap.TotalDistanceScaled()),
+			AvgSpeed:         optionalFloat(lap.AvgSpeedScaled()),
+			MaxSpeed:         optionalFloat(lap.MaxSpeedScaled()),
+			TotalAscent:      optionalUint16(lap.TotalAscent),
+			TotalDescent:     optionalUint16(lap.TotalDescent),
+			TotalCalories:    optionalUint16(lap.TotalCalories),
+			AvgCadence:       optionalUint8(lap.AvgCadence),
+			AvgHeartRate:     optionalUint8(lap.AvgHeartRate),
+			AvgPower:         optionalUint16(lap.AvgPower),
+			MaxPower:         optionalUint16(lap.MaxPower),
+			NormalizedPower:  optionalUint16(lap.NormalizedPower),
+		})
+	}
+
+	for _, event := range activity.Events {
+		summary.Events = append(summary.Events, EventSummary{
+			Timestamp: event.Timestamp,
+			Event:     event.Event.String(),
+			EventType: event.EventType.String(),
+		})
+	}
+
+	for _, timeInZone := range activity.TimeInZones {
+		summary.TimeInZones = append(summary.TimeInZones, TimeInZoneSummary{
+			Reference:      timeInZone.ReferenceMesg.String(),
+			ReferenceIndex: uint16(timeInZone.ReferenceIndex),
+			HeartRate:      zoneSummaries(timeInZone.HrZoneHighBoundary, timeInZone.TimeInHrZoneScaled()),
+			Speed:          zoneSummaries(timeInZone.SpeedZoneHighBoundaryScaled(), timeInZone.TimeInSpeedZoneScaled()),
+		})
+	}
+
+	// Compute the bounding box from records having a position
+	for _, record := range activity.Records {
+		if record.PositionLat == basetype.Sint32Invalid || record.PositionLong == basetype.Sint32Invalid {
+			continue
+		}
+
+		latitude := record.PositionLatDegrees()
+		longitude := record.PositionLongDegrees()
+
+		if summary.BoundingBox == nil {
+			summary.BoundingBox = &BoundingBox{
+				MinLatitude:  latitude,
+				MinLongitude: longitude,
+				MaxLatitude:  latitude,
+				MaxLongitude: longitude,
+			}
+			continue
+		}
+
+		summary.BoundingBox.MinLatitude = math.Min(summary.BoundingBox.MinLatitude, latitude)
+		summary.BoundingBox.MinLongitude = math.Min(summary.BoundingBox.MinLongitude, longitude)
+		summary.BoundingBox.MaxLatitude = math.Max(summary.BoundingBox.MaxLatitude, latitude)
+		summary.BoundingBox.MaxLongitude = math.Max(summary.BoundingBox.MaxLongitude, longitude)
+	}
+
+	return summary
+}
+
+// zoneSummaries pairs the high boundaries of the zones with the time spent in them
+func zoneSummaries[T uint8 | float64](boundaries []T, times []float64) []ZoneSummary {
+	zones := []ZoneSummary{}
+	for i := range min(len(boundaries), len(times)) {
+		zones = append(zones, ZoneSummary{Zone: i, HighBoundary: float64(boundaries[i]), Time: times[i]})
+	}
+
+	if len(zones) == 0 {
+		return nil
+	}
+	return zones
+}
+
+// WriteJSON writes the summary as indented JSON
+func (s FitSummary) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
+
+// WriteText writes the summary in a human readable format
+func (s FitSummary) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "File:\t%s\n", s.File)
+	fmt.Fprintf(tw, "Title:\t%s\n", s.Title)
+	fmt.Fprintf(tw, "File ID:\t%s, %s, product %d, serial %d, created %s\n",
+		s.FileId.Type, s.FileId.Manufacturer, s.FileId.Product, s.FileId.SerialNumber,
+		s.FileId.TimeCreated.Format(time.RFC3339))
+	for _, name := range slices.Sorted(maps.Keys(s.DeveloperFields)) {
+		fmt.Fprintf(tw, "Developer field %s:\t%s\n", name, s.DeveloperFields[name])
+	}
+	fmt.Fprintf(tw, "Sport:\t%s / %s\n", s.Sport, s.SubSport)
+	fmt.Fprintf(tw, "Records:\t%d\n", s.RecordCount)
+	if s.BoundingBox != nil {
+		fmt.Fprintf(tw, "Bounding box:\t(%.6f, %.6f) - (%.6f, %.6f)\n",
+			s.BoundingBox.MinLatitude, s.BoundingBox.MinLongitude,
+			s.BoundingBox.MaxLatitude, s.BoundingBox.MaxLongitude)
+	} else {
+		fmt.Fprintf(tw, "Bounding box:\tno GPS records\n")
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w, "\nSessions:")
+	writeLapTable(w, s.Sessions)
+
+	fmt.Fprintln(w, "\nLaps:")
+	writeLapTable(w, s.Laps)
+
+	for _, timeInZone := range s.TimeInZones {
+		if len(timeInZone.HeartRate) > 0 {
+			fmt.Fprintf(w, "\nTime in heart rate zones (%s %d):\n", timeInZone.Reference, timeInZone.ReferenceIndex+1)
+			writeZoneTable(w, timeInZone.HeartRate, func(boundary float64) string { return fmt.Sprintf("%.0fbpm", boundary) })
+		}
+		if len(timeInZone.Speed) > 0 {
+			fmt.Fprintf(w, "\nTime in pace zones (%s %d):\n", timeInZone.Reference, timeInZone.ReferenceIndex+1)
+			writeZoneTable(w, timeInZone.Speed, formatPace)
+		}
+	}
+
+	fmt.Fprintln(w, "\nEvents:")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tEVENT\tTYPE")
+	for _, event := range s.Events {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", event.Timestamp.Format(time.RFC3339), event.Event, event.EventType)
+	}
+
+	return tw.Flush()
+}
+
+func writeLapTable(w io.Writer, laps []LapSummary) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tSTART\tELAPSED\tTIMER\tDISTANCE\tAVG SPEED\tMAX SPEED\tASCENT\tDESCENT\tCALORIES\tCADENCE\tHR\tPOWER")
+	for i, lap := range laps {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			i+1,
+			lap.StartTime.Format(time.RFC3339),
+			formatFloat(lap.TotalElapsedTime, "%.0fs"),
+			formatFloat(lap.TotalTimerTime, "%.0fs"),
+			formatFloat(lap.TotalDistance, "%.2fm"),
+			formatFloat(lap.AvgSpeed, "%.3fm/s"),
+			formatFloat(lap.MaxSpeed, "%.3fm/s"),
+			formatValue(lap.TotalAscent, "%dm"),
+			formatValue(lap.TotalDescent, "%dm"),
+			formatValue(lap.TotalCalories, "%dkcal"),
+			formatValue(lap.AvgCadence, "%drpm"),
+			formatValue(lap.AvgHeartRate, "%dbpm"),
+			formatValue(lap.AvgPower, "%dW"),
+		)
+	}
+	tw.Flush()
+}
+
+func writeZoneTable(w io.Writer, zones []ZoneSummary, formatBoundary func(float64) string) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ZONE\tUP TO\tTIME")
+	for _, zone := range zones {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", zone.Zone, formatBoundary(zone.HighBoundary), time.Duration(zone.Time*float64(time.Second)).Round(time.Second))
+	}
+	tw.Flush()
+}
+
+// formatPace formats a speed in m/s as a pace in min/km
+func formatPace(speed float64) string {
+	if speed <= 0 {
+		return "-"
+	}
+
+	seconds := int(math.Round(1000 / speed))
+	return fmt.Sprintf("%d:%02d/km", seconds/60, seconds%60)
+}
+
+func formatFloat(value *float64, format string) string {
+	if value == nil {
+		return "-"
+	}
+	return fmt.Sprintf(format, *value)
+}
+
+func formatValue[T uint8 | uint16](value *T, format string) string {
+	if value == nil {
+		return "-"
+	}
+	return fmt.Sprintf(format, *value)
+}
+
+// optionalFloat returns nil for invalid (NaN) scaled values
+func optionalFloat(value float64) *float64 {
+	if math.IsNaN(value) {
+		return nil
+	}
+	return &value
+}
+
+func optionalUint16(value uint16) *uint16 {
+	if value == basetype.Uint16Invalid {
+		return nil
+	}
+	return &value
+}
+
+func optionalUint8(value uint8) *uint8 {
+	if value == basetype.Uint8Invalid {
+		return nil
+	}
+	return &value
+}
@@ -1,12 +1,16 @@
 package strava
 
 import (
+	"fmt"
+	"io"
 	"os"
 
 	"github.com/muktihari/fit/decoder"
 	"github.com/muktihari/fit/profile/mesgdef"
 	"github.com/muktihari/fit/profile/typedef"
 	"github.com/muktihari/fit/proto"
+	"github.com/mxdc/nrc2strava/fit"
+	"github.com/mxdc/nrc2strava/types"
 	"github.com/mxdc/nrc2strava/utils"
 	"github.com/sirupsen/logrus"
 )
@@ -19,27 +23,34 @@ type FitActivity struct {
 }
 
 // NewFitActivity initializes a new FitActivity instance
-func NewFitActivity(fitActivityFilepath string) *FitActivity {
-	logger := logrus.New()
-	logger.SetFormatter(utils.LogFormat)
-
+func NewFitActivity(fitActivityFilepath string) (*FitActivity, error) {
 	// Open the .fit file
 	file, err := os.Open(fitActivityFilepath)
 	if err != nil {
-		logger.Fatalf("Failed to open FIT file: %v", err)
+		return nil, fmt.Errorf("error opening FIT file: %w", err)
 	}
 	defer file.Close()
 
+	fitActivity, err := ReadFitActivity(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", fitActivityFilepath, err)
+	}
+
+	return fitActivity, nil
+}
+
+// ReadFitActivity decodes a FitActivity from a FIT stream
+func ReadFitActivity(r io.Reader) (*FitActivity, error) {
 	// Create a new FIT decoder
-	d := decoder.New(file)
+	d := decoder.New(r)
 
 	// Decode the FIT file
 	fit, err := d.Decode()
 	if err != nil {
-		logger.Fatalf("Failed to decode FIT file: %v", err)
+		return nil, fmt.Errorf("error decoding FIT file: %w", err)
 	}
 
-	return &FitActivity{Fit: fit, logger: logger}
+	return &FitActivity{Fit: fit, logger: utils.Logger}, nil
 }
 
 func (f *FitActivity) IsTreadmill() bool {
@@ -60,7 +71,12 @@ func (f *FitActivity) IsTreadmill() bool {
 }
 
 func (f *FitActivity) ExtractActivityTitle() string {
-	// Iterate through the decoded messages
+	// The title is a developer field of the session
+	if title, ok := f.DeveloperFields()[fit.FieldTitle]; ok && len(title) > 0 {
+		return title
+	}
+
+	// Files converted by older versions store the title as an unknown FileId field
 	for _, mesg := range f.Fit.Messages {
 		// Check if the message is of type FileId
 		if mesg.Num == typedef.MesgNumFileId {
@@ -76,3 +92,13 @@ func (f *FitActivity) ExtractActivityTitle() string {
 
 	return "Imported from NRC"
 }
+
+// DeveloperFields returns the developer fields of the session, by field name
+func (f *FitActivity) DeveloperFields() map[string]string {
+	return fit.ResolveDeveloperFields(f.Fit, typedef.MesgNumSession)
+}
+
+// ExtractMetadata returns the NRC run metadata embedded in the session
+func (f *FitActivity) ExtractMetadata() types.RunMetadata {
+	return fit.MetadataFromFields(f.DeveloperFields())
+}
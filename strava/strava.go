@@ -1,23 +1,44 @@
 package strava
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mxdc/nrc2strava/fit"
+	"github.com/mxdc/nrc2strava/report"
+	"github.com/mxdc/nrc2strava/types"
 	"github.com/mxdc/nrc2strava/utils"
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	uploadProgressAttempts = 10
+	uploadProgressInterval = 3 * time.Second
+)
+
 // StravaUploader represents the Strava API client
 type StravaUploader struct {
 	FitActivityFile string
 	Client          *StravaWeb
 
+	// GearMapping maps NRC shoe IDs or names to Strava gear IDs
+	GearMapping map[string]string
+
+	// Report records the outcome of the uploads, if set
+	Report *report.Report
+
 	// logger
 	logger *logrus.Logger
 }
 
 // NewStravaUploader initializes a new StravaUploader instance
 func NewStravaUploader(fitActivityFile string, stravaWeb *StravaWeb) *StravaUploader {
-	logger := logrus.New()
-	logger.SetFormatter(utils.LogFormat)
+	logger := utils.Logger
 
 	return &StravaUploader{
 		FitActivityFile: fitActivityFile,
@@ -26,25 +47,123 @@ func NewStravaUploader(fitActivityFile string, stravaWeb *StravaWeb) *StravaUplo
 	}
 }
 
-func (s *StravaUploader) UploadActivity(fitActivityFilepath string) bool {
-	fitActivity := NewFitActivity(fitActivityFilepath)
+// UploadActivity uploads the FIT file, then sets the description and gear of the created activity
+func (s *StravaUploader) UploadActivity(ctx context.Context, fitActivityFilepath string) error {
+	file, err := os.Open(fitActivityFilepath)
+	if err != nil {
+		err = fmt.Errorf("error opening FIT file: %w", err)
+		s.Report.AddFailed("", fitActivityFilepath, err)
+		return err
+	}
+	defer file.Close()
+
+	return s.Upload(ctx, file, fitActivityFilepath)
+}
+
+// Upload uploads the FIT stream, the name is used by Strava to detect the format and in the report
+func (s *StravaUploader) Upload(ctx context.Context, r io.Reader, fitActivityFilepath string) error {
+	// The stream is decoded for the metadata, then sent as is
+	data, err := io.ReadAll(r)
+	if err != nil {
+		err = fmt.Errorf("error reading FIT file: %w", err)
+		s.Report.AddFailed("", fitActivityFilepath, err)
+		return err
+	}
+
+	fitActivity, err := ReadFitActivity(bytes.NewReader(data))
+	if err != nil {
+		s.Report.AddFailed("", fitActivityFilepath, err)
+		return err
+	}
+
 	activityTitle := fitActivity.ExtractActivityTitle()
 	isTreadmill := fitActivity.IsTreadmill()
 	s.logger.Debugf("Activity Title: %s | Is Treadmill: %t\n", activityTitle, isTreadmill)
 
-	token, err := s.Client.LoadAuthenticityToken(s.Client.EndpointForm)
+	developerFields := fitActivity.DeveloperFields()
+	activityID := developerFields[fit.FieldNRCActivityID]
+
+	token, err := s.Client.LoadAuthenticityToken(ctx, s.Client.EndpointForm)
 	if err != nil {
-		s.logger.Errorf("Error loading form requirements: %v\n", err)
-		return false
+		err = fmt.Errorf("error loading form requirements: %w", err)
+		s.Report.AddFailed(activityID, fitActivityFilepath, err)
+		return err
 	}
 	s.logger.Debug("Authenticity token for file upload found")
 
-	uploadActivity, err := s.Client.UploadActivity(fitActivityFilepath, token)
+	uploadActivity, err := s.Client.UploadActivity(ctx, bytes.NewReader(data), filepath.Base(fitActivityFilepath), token)
 	if err != nil {
-		s.logger.Errorf("Upload error: %v\n", err)
-		return false
+		err = fmt.Errorf("upload error: %w", err)
+		s.Report.AddFailed(activityID, fitActivityFilepath, err)
+		return err
 	}
 
 	s.logger.Debugf("Uploaded activity with progress ID: %d, and name: %s\n", uploadActivity.ID, activityTitle)
-	return true
+
+	// Description and gear can only be set once the activity is created
+	// The overrides of the conversion take precedence over the NRC metadata
+	metadata := fitActivity.ExtractMetadata()
+
+	description := developerFields[fit.FieldDescription]
+	if len(description) == 0 {
+		description = BuildDescription(metadata)
+	}
+
+	gearID := developerFields[fit.FieldGearID]
+	if len(gearID) == 0 {
+		gearID = s.findGear(metadata)
+	}
+	if len(description) > 0 || len(gearID) > 0 {
+		s.updateActivity(ctx, uploadActivity.ID, description, gearID)
+	}
+
+	s.Report.AddProcessed(activityID, fitActivityFilepath)
+	return nil
+}
+
+// findGear returns the Strava gear ID of the NRC shoe, if mapped
+func (s *StravaUploader) findGear(metadata types.RunMetadata) string {
+	if gearID, ok := s.GearMapping[metadata.ShoeID]; ok && len(metadata.ShoeID) > 0 {
+		return gearID
+	}
+
+	if gearID, ok := s.GearMapping[metadata.ShoeName]; ok && len(metadata.ShoeName) > 0 {
+		return gearID
+	}
+
+	return ""
+}
+
+// updateActivity waits for the upload to be processed and sets the description and gear
+func (s *StravaUploader) updateActivity(ctx context.Context, uploadID int64, description, gearID string) {
+	var activityID int64
+
+	for attempt := 1; attempt <= uploadProgressAttempts; attempt++ {
+		progress, err := s.Client.GetUploadProgress(ctx, uploadID)
+		if err != nil {
+			s.logger.Warnf("Error loading upload progress (attempt %d): %v\n", attempt, err)
+		} else if len(progress.Error) > 0 {
+			s.logger.Warnf("Upload %d failed: %s\n", uploadID, progress.Error)
+			return
+		} else if progress.ActivityID > 0 {
+			activityID = progress.ActivityID
+			break
+		}
+
+		if err := utils.Sleep(ctx, uploadProgressInterval); err != nil {
+			return
+		}
+	}
+
+	if activityID == 0 {
+		s.logger.Warnf("Upload %d is still processing, skipping description and gear\n", uploadID)
+		return
+	}
+
+	if err := s.Client.UpdateActivity(ctx, activityID, description, gearID); err != nil {
+		s.logger.Warnf("Error updating activity %d: %v\n", activityID, err)
+		return
+	}
+
+	s.logger.Debugf("Updated description and gear of activity %d\n", activityID)
 }
@@ -0,0 +1,224 @@
+package strava_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mxdc/nrc2strava/converter"
+	"github.com/mxdc/nrc2strava/fit"
+	"github.com/mxdc/nrc2strava/parser"
+	"github.com/mxdc/nrc2strava/report"
+	"github.com/mxdc/nrc2strava/strava"
+	"github.com/mxdc/nrc2strava/strava/stravatest"
+	"github.com/mxdc/nrc2strava/types"
+	"github.com/mxdc/nrc2strava/utils"
+)
+
+const (
+	session = "test-session"
+
+	// nrcActivityID is a NRC fixture with a title, a shoe and a note
+	nrcActivityID = "0a1b2c3d-0001"
+)
+
+func newFakeServer(t *testing.T) *stravatest.Server {
+	t.Helper()
+
+	server := stravatest.NewServer(session)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func newStravaWeb(server *stravatest.Server, session string) *strava.StravaWeb {
+	stravaWeb := strava.NewStravaWeb(session)
+	stravaWeb.SetBaseURL(server.URL)
+	stravaWeb.HTTPClient = server.Client()
+	return stravaWeb
+}
+
+// writeFITFixture converts the NRC fixture and writes the FIT file into the directory
+func writeFITFixture(t *testing.T, dir string) string {
+	t.Helper()
+
+	return writeRunFixture(t, dir, nil, types.Override{})
+}
+
+// writeRunFixture converts the NRC fixture with the tags changed, an empty value removes the tag, and the override applied
+func writeRunFixture(t *testing.T, dir string, tags map[string]string, override types.Override) string {
+	t.Helper()
+
+	jsonFile, err := os.Open(filepath.Join("..", "nrc", "testdata", "activities", nrcActivityID+".json"))
+	if err != nil {
+		t.Fatalf("error opening the NRC fixture: %v", err)
+	}
+	defer jsonFile.Close()
+
+	nikeActivity, err := parser.ParseActivity(jsonFile)
+	if err != nil {
+		t.Fatalf("error parsing the NRC fixture: %v", err)
+	}
+	for key, value := range tags {
+		if len(value) > 0 {
+			nikeActivity.Tags[key] = value
+		} else {
+			delete(nikeActivity.Tags, key)
+		}
+	}
+
+	activitiesConverter := converter.InitActivitiesConverter()
+	activitiesConverter.Overrides = map[string]types.Override{nikeActivity.ID: override}
+	run := activitiesConverter.ConvertRun(nikeActivity)
+
+	fitPath := filepath.Join(dir, nrcActivityID+".fit")
+	fitFile, err := os.Create(fitPath)
+	if err != nil {
+		t.Fatalf("error creating the FIT file: %v", err)
+	}
+	defer fitFile.Close()
+
+	if err := fit.WriteFIT(fitFile, run); err != nil {
+		t.Fatalf("error writing the FIT file: %v", err)
+	}
+
+	return fitPath
+}
+
+func TestUploadActivity(t *testing.T) {
+	server := newFakeServer(t)
+	fitPath := writeFITFixture(t, t.TempDir())
+
+	uploader := strava.NewStravaUploader(fitPath, newStravaWeb(server, session))
+	uploader.GearMapping = map[string]string{"abc-123": "g12345678"}
+	uploader.Report = report.NewReport("upload")
+
+	if err := uploader.UploadActivity(context.Background(), fitPath); err != nil {
+		t.Fatalf("UploadActivity() error = %v", err)
+	}
+
+	uploads := server.Uploads()
+	if len(uploads) != 1 || uploads[0].Filename != nrcActivityID+".fit" {
+		t.Fatalf("server received %+v, want a single %s.fit upload", uploads, nrcActivityID)
+	}
+
+	activities := server.Activities()
+	if len(activities) != 1 {
+		t.Fatalf("server has %d activities, want 1", len(activities))
+	}
+
+	activity := activities[0]
+	if activity.Name != "Test run "+nrcActivityID {
+		t.Errorf("activity name = %q, want the NRC title", activity.Name)
+	}
+	if !strings.Contains(activity.Description, "Felt great") {
+		t.Errorf("activity description = %q, want the NRC note", activity.Description)
+	}
+	if activity.GearID != "g12345678" {
+		t.Errorf("activity gear = %q, want the mapped gear", activity.GearID)
+	}
+
+	if uploader.Report.Processed != 1 {
+		t.Errorf("report processed = %d, want 1", uploader.Report.Processed)
+	}
+}
+
+// TestUploadActivityDescriptionAndGear checks the description and gear set after the upload, from the NRC metadata or the override
+func TestUploadActivityDescriptionAndGear(t *testing.T) {
+	fixtureDescription := "Felt great\nWeather: sunny 18°C\nTerrain: road\nFeeling: amped\nPerceived effort: 6/10"
+	shoeDescription := "Felt great\nShoes: Pegasus 40\nWeather: sunny 18°C\nTerrain: road\nFeeling: amped\nPerceived effort: 6/10"
+
+	tests := []struct {
+		name        string
+		tags        map[string]string
+		override    types.Override
+		gearMapping map[string]string
+		description string
+		gearID      string
+	}{
+		{"shoe ID", nil, types.Override{}, map[string]string{"abc-123": "g1"}, fixtureDescription, "g1"},
+		{"shoe name", map[string]string{"shoe_id": "", "shoe_name": "Pegasus 40"}, types.Override{}, map[string]string{"Pegasus 40": "g2"}, shoeDescription, "g2"},
+		{"shoe ID over shoe name", map[string]string{"shoe_name": "Pegasus 40"}, types.Override{}, map[string]string{"abc-123": "g1", "Pegasus 40": "g2"}, shoeDescription, "g1"},
+		{"unknown shoe", nil, types.Override{}, map[string]string{"other": "g1"}, fixtureDescription, ""},
+		{"no gear mapping", nil, types.Override{}, nil, fixtureDescription, ""},
+		{"override description and gear", nil, types.Override{Description: "Race day", Gear: "g3"}, map[string]string{"abc-123": "g1"}, "Race day", "g3"},
+		{"override description only", nil, types.Override{Description: "Race day"}, map[string]string{"abc-123": "g1"}, "Race day", "g1"},
+		{
+			"no metadata",
+			map[string]string{"shoe_id": "", "note": "", "com.nike.weather": "", "com.nike.temperature": "", "terrain": "", "emoji": "", "rpe": ""},
+			types.Override{}, map[string]string{"abc-123": "g1"}, "", "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeServer(t)
+			fitPath := writeRunFixture(t, t.TempDir(), tt.tags, tt.override)
+
+			uploader := strava.NewStravaUploader(fitPath, newStravaWeb(server, session))
+			uploader.GearMapping = tt.gearMapping
+			if err := uploader.UploadActivity(context.Background(), fitPath); err != nil {
+				t.Fatalf("UploadActivity() error = %v", err)
+			}
+
+			activities := server.Activities()
+			if len(activities) != 1 {
+				t.Fatalf("server has %d activities, want 1", len(activities))
+			}
+			activity := activities[0]
+			if activity.Description != tt.description {
+				t.Errorf("activity description = %q, want %q", activity.Description, tt.description)
+			}
+			if activity.GearID != tt.gearID {
+				t.Errorf("activity gear = %q, want %q", activity.GearID, tt.gearID)
+			}
+		})
+	}
+}
+
+func TestUploadActivityRateLimited(t *testing.T) {
+	server := newFakeServer(t)
+	server.FailUploads(http.StatusTooManyRequests)
+	fitPath := writeFITFixture(t, t.TempDir())
+
+	uploader := strava.NewStravaUploader(fitPath, newStravaWeb(server, session))
+	uploader.Report = report.NewReport("upload")
+
+	err := uploader.UploadActivity(context.Background(), fitPath)
+	if !errors.Is(err, utils.ErrRateLimited) {
+		t.Fatalf("UploadActivity() error = %v, want ErrRateLimited", err)
+	}
+
+	if uploader.Report.Failed != 1 {
+		t.Errorf("report failed = %d, want 1", uploader.Report.Failed)
+	}
+}
+
+func TestUploadActivityServerError(t *testing.T) {
+	server := newFakeServer(t)
+	server.FailUploads(http.StatusInternalServerError)
+	fitPath := writeFITFixture(t, t.TempDir())
+
+	err := strava.NewStravaUploader(fitPath, newStravaWeb(server, session)).UploadActivity(context.Background(), fitPath)
+	if err == nil || utils.ShouldAbort(err) {
+		t.Errorf("UploadActivity() error = %v, want an error which doesn't abort", err)
+	}
+}
+
+func TestUploadActivityInvalidSession(t *testing.T) {
+	server := newFakeServer(t)
+	fitPath := writeFITFixture(t, t.TempDir())
+
+	err := strava.NewStravaUploader(fitPath, newStravaWeb(server, "expired-session")).UploadActivity(context.Background(), fitPath)
+	if !errors.Is(err, utils.ErrUnauthorized) {
+		t.Errorf("UploadActivity() error = %v, want ErrUnauthorized", err)
+	}
+
+	if uploads := server.Uploads(); len(uploads) != 0 {
+		t.Errorf("server received %d uploads, want 0", len(uploads))
+	}
+}
@@ -0,0 +1,410 @@
+// Package stravatest provides a fake Strava website for the tests
+package stravatest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/muktihari/fit/decoder"
+	"github.com/muktihari/fit/profile/mesgdef"
+	"github.com/muktihari/fit/profile/typedef"
+	"github.com/mxdc/nrc2strava/fit"
+)
+
+// AuthenticityToken is the token of the forms served by the fake server
+const AuthenticityToken = "fake-authenticity-token"
+
+// Activity is an activity of the fake Strava account
+type Activity struct {
+	ID          int64
+	Name        string
+	SportType   string
+	Trainer     bool
+	StartTime   time.Time
+	Distance    float64
+	ElapsedTime int64
+	Description string
+	GearID      string
+
+	// Data is the original file, served by export_original
+	Data []byte
+}
+
+// Upload is a file received by the fake server
+type Upload struct {
+	ID         int64
+	ActivityID int64
+	Filename   string
+	Data       []byte
+
+	// Error is the processing error, e.g. a file which isn't a valid FIT file
+	Error string
+}
+
+// Server is a fake Strava website serving the endpoints of the upload and the download
+type Server struct {
+	*httptest.Server
+
+	// Session is the _strava4_session cookie expected by the server, other sessions are redirected to the login page
+	Session string
+
+	// activities are sorted from the newest, like the training activities page
+	activities []*Activity
+	uploads    []*Upload
+
+	// uploadStatus is the status code returned for the uploads, 0 for success
+	uploadStatus int
+
+	// exportFailures maps activity IDs to the status code returned for their original file
+	exportFailures map[int64]int
+
+	nextUploadID   int64
+	nextActivityID int64
+
+	mutex sync.Mutex
+}
+
+// NewServer starts a fake Strava website accepting the session
+func NewServer(session string) *Server {
+	s := &Server{
+		Session:        session,
+		exportFailures: map[int64]int{},
+		nextUploadID:   1000,
+		nextActivityID: 9000,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /login", s.handleLogin)
+	mux.HandleFunc("GET /upload/select", s.handleForm)
+	mux.HandleFunc("POST /upload/files", s.handleUpload)
+	mux.HandleFunc("GET /upload/progress.json", s.handleProgress)
+	mux.HandleFunc("GET /athlete/training_activities", s.handleActivityList)
+	mux.HandleFunc("GET /activities/{id}/edit", s.handleForm)
+	mux.HandleFunc("POST /activities/{id}", s.handleUpdate)
+	mux.HandleFunc("GET /activities/{id}/export_original", s.handleExport)
+	s.Server = httptest.NewServer(s.authorize(mux))
+
+	return s
+}
+
+// AddActivity adds an activity to the account and returns it, its ID is set by the server
+func (s *Server) AddActivity(activity Activity) Activity {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return *s.addActivity(activity)
+}
+
+func (s *Server) addActivity(activity Activity) *Activity {
+	s.nextActivityID++
+	activity.ID = s.nextActivityID
+	if len(activity.SportType) == 0 {
+		activity.SportType = "Run"
+	}
+
+	// Insert before the older activities
+	index := 0
+	for index < len(s.activities) && !s.activities[index].StartTime.Before(activity.StartTime) {
+		index++
+	}
+
+	added := &activity
+	s.activities = append(s.activities[:index], append([]*Activity{added}, s.activities[index:]...)...)
+
+	return added
+}
+
+// Activities returns the activities of the account, from the newest
+func (s *Server) Activities() []Activity {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	activities := make([]Activity, 0, len(s.activities))
+	for _, activity := range s.activities {
+		activities = append(activities, *activity)
+	}
+
+	return activities
+}
+
+// Uploads returns the files received, in order
+func (s *Server) Uploads() []Upload {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	uploads := make([]Upload, 0, len(s.uploads))
+	for _, upload := range s.uploads {
+		uploads = append(uploads, *upload)
+	}
+
+	return uploads
+}
+
+// FailUploads makes the server answer the next uploads with the status code, 0 accepts them again
+func (s *Server) FailUploads(statusCode int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.uploadStatus = statusCode
+}
+
+// FailExport makes the server answer the original file of the activity with the status code
+func (s *Server) FailExport(activityID int64, statusCode int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.exportFailures[activityID] = statusCode
+}
+
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("_strava4_session")
+		if r.URL.Path != "/login" && (err != nil || cookie.Value != s.Session) {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+	io.WriteString(w, `<html><body><form action="/session" method="post"><input name="email"></form></body></html>`)
+}
+
+// handleForm serves the upload and edit forms, Strava's source of the authenticity token
+func (s *Server) handleForm(w http.ResponseWriter, r *http.Request) {
+	if id := r.PathValue("id"); len(id) > 0 && s.findActivity(id) == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprintf(w, `<html><body><form method="post"><input type="hidden" name="authenticity_token" value="%s"></form></body></html>`, AuthenticityToken)
+}
+
+// checkToken reports whether the request sends the authenticity token of the forms
+func checkToken(r *http.Request) bool {
+	return r.Header.Get("x-csrf-token") == AuthenticityToken && r.FormValue("authenticity_token") == AuthenticityToken
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	uploadStatus := s.uploadStatus
+	s.mutex.Unlock()
+
+	if uploadStatus != 0 {
+		http.Error(w, http.StatusText(uploadStatus), uploadStatus)
+		return
+	}
+
+	if err := r.ParseMultipartForm(10 << 20); err != nil || !checkToken(r) {
+		http.Error(w, "invalid form", http.StatusUnprocessableEntity)
+		return
+	}
+
+	file, header, err := r.FormFile("files[]")
+	if err != nil {
+		http.Error(w, "missing file", http.StatusUnprocessableEntity)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.nextUploadID++
+	upload := &Upload{ID: s.nextUploadID, Filename: header.Filename, Data: data}
+	s.uploads = append(s.uploads, upload)
+
+	// Like Strava, the file is accepted and its processing errors are reported by the progress
+	activity, err := activityFromFIT(data)
+	if err != nil {
+		upload.Error = err.Error()
+	} else {
+		upload.ActivityID = s.addActivity(activity).ID
+	}
+
+	writeJSON(w, []map[string]any{{
+		"id":       upload.ID,
+		"progress": 0,
+		"workflow": "uploading",
+	}})
+}
+
+// activityFromFIT builds the activity created by an uploaded FIT file
+func activityFromFIT(data []byte) (Activity, error) {
+	decoded, err := decoder.New(bytes.NewReader(data)).Decode()
+	if err != nil {
+		return Activity{}, fmt.Errorf("The file is corrupt: %w", err)
+	}
+
+	activity := Activity{Name: "Morning Run", Data: data}
+	for _, mesg := range decoded.Messages {
+		if mesg.Num != typedef.MesgNumSession {
+			continue
+		}
+
+		session := mesgdef.NewSession(&mesg)
+		activity.StartTime = session.StartTime
+		activity.Distance = session.TotalDistanceScaled()
+		activity.ElapsedTime = int64(session.TotalElapsedTimeScaled())
+		activity.Trainer = session.SubSport == typedef.SubSportTreadmill
+		if session.Sport != typedef.SportRunning {
+			activity.SportType = "Workout"
+		}
+	}
+
+	if title := fit.ResolveDeveloperFields(decoded, typedef.MesgNumSession)[fit.FieldTitle]; len(title) > 0 {
+		activity.Name = title
+	}
+
+	return activity, nil
+}
+
+func (s *Server) handleProgress(w http.ResponseWriter, r *http.Request) {
+	uploadID, _ := strconv.ParseInt(r.URL.Query().Get("ids[]"), 10, 64)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	progress := []map[string]any{}
+	for _, upload := range s.uploads {
+		if upload.ID != uploadID {
+			continue
+		}
+
+		progress = append(progress, map[string]any{
+			"id":          upload.ID,
+			"activity_id": upload.ActivityID,
+			"progress":    100,
+			"workflow":    "uploaded",
+			"error":       upload.Error,
+		})
+	}
+
+	writeJSON(w, progress)
+}
+
+// handleActivityList serves a page of the training activities
+func (s *Server) handleActivityList(w http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = 20
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	start := min((page-1)*perPage, len(s.activities))
+	end := min(start+perPage, len(s.activities))
+
+	models := []map[string]any{}
+	for _, activity := range s.activities[start:end] {
+		models = append(models, map[string]any{
+			"id":                   activity.ID,
+			"name":                 activity.Name,
+			"start_date_local_raw": activity.StartTime.Unix(),
+			"distance_raw":         activity.Distance,
+			"short_unit":           "km",
+			"sport_type":           activity.SportType,
+			"trainer":              activity.Trainer,
+			"moving_time_raw":      activity.ElapsedTime,
+			"elapsed_time_raw":     activity.ElapsedTime,
+			"activity_url":         fmt.Sprintf("%s/activities/%d", s.URL, activity.ID),
+		})
+	}
+
+	writeJSON(w, map[string]any{
+		"models":  models,
+		"page":    page,
+		"perPage": perPage,
+		"total":   len(s.activities),
+	})
+}
+
+// handleUpdate saves the description and gear of the edit form, then redirects to the activity
+func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("_method") != "patch" || !checkToken(r) {
+		http.Error(w, "invalid form", http.StatusUnprocessableEntity)
+		return
+	}
+
+	activity := s.findActivity(r.PathValue("id"))
+	if activity == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mutex.Lock()
+	if description := r.PostForm.Get("activity[description]"); len(description) > 0 {
+		activity.Description = description
+	}
+	if gearID := r.PostForm.Get("activity[gear_id]"); len(gearID) > 0 {
+		activity.GearID = gearID
+	}
+	s.mutex.Unlock()
+
+	http.Redirect(w, r, fmt.Sprintf("/activities/%d", activity.ID), http.StatusFound)
+}
+
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	activity := s.findActivity(r.PathValue("id"))
+	if activity == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mutex.Lock()
+	statusCode, failing := s.exportFailures[activity.ID]
+	s.mutex.Unlock()
+
+	if failing {
+		http.Error(w, http.StatusText(statusCode), statusCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(activity.Data)
+}
+
+func (s *Server) findActivity(id string) *Activity {
+	activityID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, activity := range s.activities {
+		if activity.ID == activityID {
+			return activity
+		}
+	}
+
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
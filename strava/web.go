@@ -2,13 +2,14 @@ package strava
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/url"
-	"os"
+	"strings"
 	"time"
 
 	"github.com/mxdc/nrc2strava/utils"
@@ -16,6 +17,9 @@ import (
 	"golang.org/x/net/html"
 )
 
+// DefaultBaseURL is the base URL of the Strava website
+const DefaultBaseURL = "https://www.strava.com"
+
 // StravaWeb represents the Strava Web client
 type StravaWeb struct {
 	// Cookie Data | Domain: www.strava.com
@@ -25,6 +29,11 @@ type StravaWeb struct {
 	EndpointForm       string
 	EndpointUpload     string
 	EndpointActivities string
+	EndpointProgress   string
+	EndpointActivity   string
+
+	// HTTPClient sends the requests, it can be replaced to set timeouts or a transport
+	HTTPClient *http.Client
 
 	// logger
 	logger *logrus.Logger
@@ -32,29 +41,39 @@ type StravaWeb struct {
 
 // NewStravaWeb initializes a new StravaWeb instance
 func NewStravaWeb(strava4Session string) *StravaWeb {
-	logger := logrus.New()
-	logger.SetFormatter(utils.LogFormat)
+	logger := utils.Logger
 
-	return &StravaWeb{
+	web := &StravaWeb{
 		// Cookie Data | Domain: www.strava.com
 		Strava4Session: strava4Session,
 
-		// Endpoint
-		EndpointForm:       "https://www.strava.com/upload/select",
-		EndpointUpload:     "https://www.strava.com/upload/files",
-		EndpointActivities: "https://www.strava.com/athlete/training_activities",
+		HTTPClient: utils.NewHTTPClient(utils.DefaultHTTPTimeouts),
 
 		// logger
 		logger: logger,
 	}
+	web.SetBaseURL(DefaultBaseURL)
+
+	return web
+}
+
+// SetBaseURL points the endpoints to another server, e.g. a proxy or a fake server in tests
+func (web *StravaWeb) SetBaseURL(baseURL string) {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	web.EndpointForm = baseURL + "/upload/select"
+	web.EndpointUpload = baseURL + "/upload/files"
+	web.EndpointActivities = baseURL + "/athlete/training_activities"
+	web.EndpointProgress = baseURL + "/upload/progress.json"
+	web.EndpointActivity = baseURL + "/activities/%d"
 }
 
 // LoadAuthenticityToken performs a GET request and extracts the authenticity token from the HTML response
-func (web *StravaWeb) LoadAuthenticityToken(endpoint string) (string, error) {
+func (web *StravaWeb) LoadAuthenticityToken(ctx context.Context, endpoint string) (string, error) {
 	web.logger.Debugf("Loading authenticity token from: %s\n", endpoint)
 
 	// Create the HTTP request
-	req, err := http.NewRequest("GET", endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return "", fmt.Errorf("error creating request: %w", err)
 	}
@@ -69,8 +88,7 @@ func (web *StravaWeb) LoadAuthenticityToken(endpoint string) (string, error) {
 	}
 
 	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := web.HTTPClient.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("error sending request: %w", err)
 	}
@@ -79,7 +97,10 @@ func (web *StravaWeb) LoadAuthenticityToken(endpoint string) (string, error) {
 	// Print the response status
 	web.logger.Debugf("Response status: %s\n", resp.Status)
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("error loading authenticity token: %s", resp.Status)
+		return "", fmt.Errorf("error loading authenticity token: %w", utils.StatusError(resp))
+	}
+	if isLoginRedirect(resp) {
+		return "", fmt.Errorf("error loading authenticity token: redirected to the login page: %w", utils.ErrUnauthorized)
 	}
 
 	// Parse the HTML response to extract the authenticity token
@@ -91,6 +112,12 @@ func (web *StravaWeb) LoadAuthenticityToken(endpoint string) (string, error) {
 	return token, nil
 }
 
+// isLoginRedirect reports whether the request was redirected to the login page, Strava's answer to an invalid session
+func isLoginRedirect(resp *http.Response) bool {
+	return resp.Request != nil && resp.Request.URL != nil &&
+		(resp.Request.URL.Path == "/login" || resp.Request.URL.Path == "/session")
+}
+
 // extractAuthenticityToken parses the HTML and extracts the authenticity token
 func extractAuthenticityToken(body io.Reader) (string, error) {
 	// Parse the HTML document
@@ -134,12 +161,13 @@ func extractAuthenticityToken(body io.Reader) (string, error) {
 }
 
 type UploadedActivity struct {
-	ID        int64  `json:"id"`
-	Name      string `json:"name"`
-	Progress  int    `json:"progress"`
-	Workflow  string `json:"workflow"`
-	StartDate string `json:"start_date"`
-	Error     string `json:"error"`
+	ID         int64  `json:"id"`
+	ActivityID int64  `json:"activity_id"`
+	Name       string `json:"name"`
+	Progress   int    `json:"progress"`
+	Workflow   string `json:"workflow"`
+	StartDate  string `json:"start_date"`
+	Error      string `json:"error"`
 }
 
 type Activity struct {
@@ -162,22 +190,16 @@ type ActivitiesResponse struct {
 	Total   int        `json:"total"`
 }
 
-func (web *StravaWeb) UploadActivity(filePath, token string) (*UploadedActivity, error) {
-	web.logger.Debugf("Uploading activity file: %s\n", filePath)
-
-	// Open the file
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("error opening file: %w", err)
-	}
-	defer file.Close()
+// UploadActivity uploads the content of a FIT file, the filename is sent with the form
+func (web *StravaWeb) UploadActivity(ctx context.Context, file io.Reader, filename, token string) (*UploadedActivity, error) {
+	web.logger.Debugf("Uploading activity file: %s\n", filename)
 
 	// Create a multipart form
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 
 	// Add the file to the form
-	part, err := writer.CreateFormFile("files[]", filePath)
+	part, err := writer.CreateFormFile("files[]", filename)
 	if err != nil {
 		return nil, fmt.Errorf("error creating form file: %w", err)
 	}
@@ -194,7 +216,7 @@ func (web *StravaWeb) UploadActivity(filePath, token string) (*UploadedActivity,
 	writer.Close()
 
 	// Create the HTTP request
-	req, err := http.NewRequest("POST", web.EndpointUpload, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", web.EndpointUpload, body)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
@@ -215,8 +237,7 @@ func (web *StravaWeb) UploadActivity(filePath, token string) (*UploadedActivity,
 	}
 
 	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := web.HTTPClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("error sending request: %w", err)
 	}
@@ -226,9 +247,12 @@ func (web *StravaWeb) UploadActivity(filePath, token string) (*UploadedActivity,
 	web.logger.Debugf("Response status: %s\n", resp.Status)
 	if resp.StatusCode != http.StatusOK {
 		if resp.StatusCode == http.StatusTooManyRequests {
-			return nil, fmt.Errorf("strava upload limit reached. Please resume the upload tomorrow")
+			return nil, fmt.Errorf("strava upload limit reached, please resume the upload tomorrow: %w", utils.ErrRateLimited)
 		}
-		return nil, fmt.Errorf("server returned %s", resp.Status)
+		return nil, utils.StatusError(resp)
+	}
+	if isLoginRedirect(resp) {
+		return nil, fmt.Errorf("redirected to the login page: %w", utils.ErrUnauthorized)
 	}
 
 	// Read and parse the response body
@@ -250,7 +274,7 @@ func (web *StravaWeb) UploadActivity(filePath, token string) (*UploadedActivity,
 	return nil, fmt.Errorf("no activity uploaded")
 }
 
-func (s *StravaWeb) GetActivityList() ([]Activity, error) {
+func (s *StravaWeb) GetActivityList(ctx context.Context) ([]Activity, error) {
 	s.logger.Info("Collecting activities from Strava web...")
 
 	var activities []Activity
@@ -268,7 +292,7 @@ func (s *StravaWeb) GetActivityList() ([]Activity, error) {
 		s.logger.Debugf("Opening page: %s\n", fullURL)
 
 		// Make the HTTP request
-		response, err := s.fetchActivityList(fullURL)
+		response, err := s.fetchActivityList(ctx, fullURL)
 		if err != nil {
 			return nil, fmt.Errorf("error fetching activity list: %w", err)
 		}
@@ -289,7 +313,9 @@ func (s *StravaWeb) GetActivityList() ([]Activity, error) {
 			break
 		}
 
-		time.Sleep(10 * time.Millisecond)
+		if err := utils.Sleep(ctx, 10*time.Millisecond); err != nil {
+			return nil, err
+		}
 		page++
 	}
 
@@ -298,9 +324,9 @@ func (s *StravaWeb) GetActivityList() ([]Activity, error) {
 }
 
 // fetchActivityList makes an HTTP request to fetch the activity list
-func (s *StravaWeb) fetchActivityList(endpoint string) (*ActivitiesResponse, error) {
+func (s *StravaWeb) fetchActivityList(ctx context.Context, endpoint string) (*ActivitiesResponse, error) {
 	// Create the HTTP request
-	req, err := http.NewRequest("GET", endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
@@ -320,8 +346,7 @@ func (s *StravaWeb) fetchActivityList(endpoint string) (*ActivitiesResponse, err
 	}
 
 	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := s.HTTPClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("error sending request: %w", err)
 	}
@@ -330,7 +355,10 @@ func (s *StravaWeb) fetchActivityList(endpoint string) (*ActivitiesResponse, err
 	// Check response status
 	s.logger.Debugf("Response status: %s\n", resp.Status)
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned %s", resp.Status)
+		return nil, utils.StatusError(resp)
+	}
+	if isLoginRedirect(resp) {
+		return nil, fmt.Errorf("redirected to the login page: %w", utils.ErrUnauthorized)
 	}
 
 	// Read and parse the response body
@@ -347,3 +375,118 @@ func (s *StravaWeb) fetchActivityList(endpoint string) (*ActivitiesResponse, err
 
 	return &response, nil
 }
+
+// GetUploadProgress returns the processing status of an upload
+func (web *StravaWeb) GetUploadProgress(ctx context.Context, uploadID int64) (*UploadedActivity, error) {
+	params := url.Values{}
+	params.Set("ids[]", fmt.Sprintf("%d", uploadID))
+
+	fullURL := web.EndpointProgress + "?" + params.Encode()
+	web.logger.Debugf("Loading upload progress from: %s\n", fullURL)
+
+	// Create the HTTP request
+	req, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	// Add headers
+	req.Header.Set("accept", "application/json")
+	req.Header.Set("x-requested-with", "XMLHttpRequest")
+
+	// Add cookies
+	cookies := []http.Cookie{
+		{Name: "_strava4_session", Value: web.Strava4Session},
+	}
+
+	for _, cookie := range cookies {
+		req.AddCookie(&cookie)
+	}
+
+	// Send the request
+	resp, err := web.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Check response status
+	web.logger.Debugf("Response status: %s\n", resp.Status)
+	if resp.StatusCode != http.StatusOK {
+		return nil, utils.StatusError(resp)
+	}
+
+	// Parse the JSON response
+	var response []UploadedActivity
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("error unmarshaling JSON response: %w", err)
+	}
+
+	if len(response) == 0 {
+		return nil, fmt.Errorf("upload %d not found", uploadID)
+	}
+
+	return &response[0], nil
+}
+
+// UpdateActivity sets the description and the gear of an activity, empty values are left unchanged
+func (web *StravaWeb) UpdateActivity(ctx context.Context, activityID int64, description, gearID string) error {
+	endpoint := fmt.Sprintf(web.EndpointActivity, activityID)
+	web.logger.Debugf("Updating activity: %s\n", endpoint)
+
+	// The edit form provides the authenticity token
+	token, err := web.LoadAuthenticityToken(ctx, endpoint+"/edit")
+	if err != nil {
+		return fmt.Errorf("error loading form requirements: %w", err)
+	}
+
+	form := url.Values{}
+	form.Set("_method", "patch")
+	form.Set("authenticity_token", token)
+	if len(description) > 0 {
+		form.Set("activity[description]", description)
+	}
+	if len(gearID) > 0 {
+		form.Set("activity[gear_id]", gearID)
+	}
+
+	// Create the HTTP request
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	// Add headers
+	req.Header.Set("content-type", "application/x-www-form-urlencoded")
+	req.Header.Set("origin", "https://www.strava.com")
+	req.Header.Set("referer", endpoint+"/edit")
+	req.Header.Set("x-csrf-token", token)
+
+	// Add cookies
+	cookies := []http.Cookie{
+		{Name: "_strava4_session", Value: web.Strava4Session},
+	}
+
+	for _, cookie := range cookies {
+		req.AddCookie(&cookie)
+	}
+
+	// Send the request, the server redirects to the activity page on success
+	client := *web.HTTPClient
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Check response status
+	web.logger.Debugf("Response status: %s\n", resp.Status)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusFound {
+		return utils.StatusError(resp)
+	}
+
+	return nil
+}
@@ -20,6 +20,9 @@ type Activity struct {
 	MetricTypes     []string          `json:"metric_types"`
 	Metrics         []Metric          `json:"metrics"`
 	Moments         []Moment          `json:"moments"`
+
+	// FilePath is the file the activity was read from, empty when decoded from a reader
+	FilePath string `json:"-"`
 }
 
 type Summary struct {
@@ -62,3 +65,27 @@ type Run struct {
 	Id       string
 	Activity *filedef.Activity
 }
+
+// RunMetadata holds the user data NRC stores in the activity tags
+type RunMetadata struct {
+	ShoeID          string
+	ShoeName        string
+	Note            string
+	Weather         string
+	Temperature     string // °C
+	Terrain         string
+	PerceivedEffort string // 1 to 10
+	Mood            string
+}
+
+// Override holds the user corrections of a NRC activity, applied during the conversion and the upload
+type Override struct {
+	Title       string  `yaml:"title"`
+	Description string  `yaml:"description"`
+	Indoor      *bool   `yaml:"indoor"`
+	Sport       string  `yaml:"sport"`       // FIT sport, e.g. running, walking, hiking
+	Distance    float64 `yaml:"distance"`    // km
+	StartShift  string  `yaml:"start_shift"` // duration, e.g. -1h or 30s
+	Exclude     bool    `yaml:"exclude"`
+	Gear        string  `yaml:"gear"` // Strava gear ID
+}
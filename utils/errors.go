@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrUnauthorized is wrapped by the errors caused by a missing, invalid or expired token
+	ErrUnauthorized = errors.New("unauthorized, the token is invalid or expired")
+
+	// ErrRateLimited is wrapped by the errors caused by the rate limit of the API
+	ErrRateLimited = errors.New("rate limit reached")
+)
+
+// StatusError returns the error of an unexpected response status,
+// wrapping ErrUnauthorized or ErrRateLimited when the status is one of them
+func StatusError(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("server returned %s: %w", resp.Status, ErrUnauthorized)
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("server returned %s: %w", resp.Status, ErrRateLimited)
+	}
+
+	return fmt.Errorf("server returned %s", resp.Status)
+}
+
+// ShouldAbort reports whether the error would repeat for every remaining activity
+func ShouldAbort(err error) bool {
+	return errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrRateLimited)
+}
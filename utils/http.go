@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// HTTPTimeouts bounds the duration of the HTTP calls, a zero value disables the bound
+type HTTPTimeouts struct {
+	// Connect bounds the TCP connection and the TLS handshake
+	Connect time.Duration
+
+	// Read bounds the wait for the response headers once the request is sent
+	Read time.Duration
+
+	// Total bounds the whole request, including reading the response body
+	Total time.Duration
+}
+
+// DefaultHTTPTimeouts are used by the clients created without explicit timeouts
+var DefaultHTTPTimeouts = HTTPTimeouts{
+	Connect: 10 * time.Second,
+	Read:    30 * time.Second,
+	Total:   2 * time.Minute,
+}
+
+// NewHTTPClient returns a client with the timeouts, meant to be shared by the API clients
+func NewHTTPClient(timeouts HTTPTimeouts) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   timeouts.Connect,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = timeouts.Connect
+	transport.ResponseHeaderTimeout = timeouts.Read
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeouts.Total,
+	}
+}
+
+// Sleep pauses for the duration, or returns the context error as soon as it's canceled
+func Sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
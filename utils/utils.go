@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -10,8 +11,46 @@ var (
 	LogFormat = &logrus.TextFormatter{
 		DisableTimestamp: true,
 	}
+
+	// JSONLogFormat is the machine readable log format
+	JSONLogFormat = &logrus.JSONFormatter{}
+
+	// Logger is shared by all the packages, so the level and format are configured once
+	Logger = newLogger()
+)
+
+// Log formats
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
 )
 
+func newLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetFormatter(LogFormat)
+	return logger
+}
+
+// ConfigureLogger sets the level and the format of the shared logger
+func ConfigureLogger(level, format string) error {
+	parsedLevel, err := logrus.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("invalid log level: %w", err)
+	}
+	Logger.SetLevel(parsedLevel)
+
+	switch format {
+	case LogFormatText:
+		Logger.SetFormatter(LogFormat)
+	case LogFormatJSON:
+		Logger.SetFormatter(JSONLogFormat)
+	default:
+		return fmt.Errorf("invalid log format: %q", format)
+	}
+
+	return nil
+}
+
 func ParseTimeInMs(epochMs int64) time.Time {
 	// Convert milliseconds to seconds and nanoseconds
 	seconds := epochMs / 1000